@@ -10,6 +10,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/AlphaMinZ/myredis_go/datastore"
 	"github.com/AlphaMinZ/myredis_go/persist"
 )
 
@@ -20,6 +21,7 @@ type Config struct {
 	AppendFileName_         string `cfg:"appendfilename"`              // aof 文件名称
 	AppendFsync_            string `cfg:"appendfsync"`                 // aof 级别
 	AutoAofRewriteAfterCmd_ int    `cfg:"auto-aof-rewrite-after-cmds"` // 每执行多少次 aof 操作后，进行一次重写
+	SetMaxIntsetEntries_    int    `cfg:"set-max-intset-entries"`      // set 采用 intset 编码的元素个数上限
 }
 
 func (c *Config) Address() string {
@@ -42,6 +44,10 @@ func (c *Config) AutoAofRewriteAfterCmd() int {
 	return c.AutoAofRewriteAfterCmd_
 }
 
+func (c *Config) SetMaxIntsetEntries() int {
+	return c.SetMaxIntsetEntries_
+}
+
 var (
 	confOnce   sync.Once
 	globalConf *Config
@@ -51,6 +57,10 @@ func PersistThinker() persist.Thinker {
 	return SetUpConfig()
 }
 
+func DataStoreThinker() datastore.Thinker {
+	return SetUpConfig()
+}
+
 func SetUpConfig() *Config {
 	confOnce.Do(func() {
 		defer func() {
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/AlphaMinZ/myredis_go/handler"
+)
+
+// 阻塞指令的响应. handler 返回该类型时，executor 会将指令挂起，直到 keys 有数据就绪、超时或者连接断开
+type BlockReply struct {
+	keys         []string
+	timeout      time.Duration // 为 0 时永久阻塞
+	timeoutReply handler.Reply
+	args         [][]byte // 重试时使用的参数，为 nil 时沿用原指令的参数
+}
+
+func NewBlockReply(keys []string, timeout time.Duration, timeoutReply handler.Reply) *BlockReply {
+	return &BlockReply{
+		keys:         keys,
+		timeout:      timeout,
+		timeoutReply: timeoutReply,
+	}
+}
+
+// 指定重试时使用的参数. 如 xread 中的 $ 需要在挂起时固定为当时的最新 id
+func (b *BlockReply) WithArgs(args [][]byte) *BlockReply {
+	b.args = args
+	return b
+}
+
+func (b *BlockReply) ToBytes() []byte {
+	return b.timeoutReply.ToBytes()
+}
+
+// 被挂起的指令
+type waiter struct {
+	cmd          *Command
+	cmdFunc      CmdHandler
+	timeoutReply handler.Reply
+	elems        map[string]*list.Element // 在各个 key 等待队列中的位置
+	done         chan struct{}
+}
+
+// 阻塞指令的等待队列，只在 executor 协程中访问，不考虑并发问题
+type blockingQueue struct {
+	waiters map[string]*list.List // key -> 按阻塞先后排列的 waiter
+}
+
+func newBlockingQueue() *blockingQueue {
+	return &blockingQueue{
+		waiters: make(map[string]*list.List),
+	}
+}
+
+func (b *blockingQueue) push(w *waiter, keys []string) {
+	for _, key := range keys {
+		if _, ok := w.elems[key]; ok {
+			continue
+		}
+		waiters, ok := b.waiters[key]
+		if !ok {
+			waiters = list.New()
+			b.waiters[key] = waiters
+		}
+		w.elems[key] = waiters.PushBack(w)
+	}
+}
+
+// 将 waiter 从所有 key 的等待队列中移除. 返回 false 代表 waiter 已经不在队列中
+func (b *blockingQueue) remove(w *waiter) bool {
+	if len(w.elems) == 0 {
+		return false
+	}
+	for key, elem := range w.elems {
+		waiters := b.waiters[key]
+		waiters.Remove(elem)
+		if waiters.Len() == 0 {
+			delete(b.waiters, key)
+		}
+	}
+	w.elems = nil
+	return true
+}
+
+func (b *blockingQueue) get(key string) []*waiter {
+	waiters, ok := b.waiters[key]
+	if !ok {
+		return nil
+	}
+	ws := make([]*waiter, 0, waiters.Len())
+	for elem := waiters.Front(); elem != nil; elem = elem.Next() {
+		ws = append(ws, elem.Value.(*waiter))
+	}
+	return ws
+}
+
+// 挂起指令，并异步监听超时和连接断开事件
+func (e *DBExecutor) block(cmd *Command, cmdFunc CmdHandler, reply *BlockReply) {
+	if reply.args != nil {
+		cmd.args = reply.args
+	}
+	w := waiter{
+		cmd:          cmd,
+		cmdFunc:      cmdFunc,
+		timeoutReply: reply.timeoutReply,
+		elems:        make(map[string]*list.Element, len(reply.keys)),
+		done:         make(chan struct{}),
+	}
+	e.blocking.push(&w, reply.keys)
+
+	var canceled <-chan struct{}
+	if ctx := cmd.Ctx(); ctx != nil {
+		canceled = ctx.Done()
+	}
+
+	// 挂起的指令数量不受限制，不占用协程池，避免协程池耗尽时 executor 无法继续处理指令
+	go func() {
+		var timeout <-chan time.Time
+		if reply.timeout > 0 {
+			timer := time.NewTimer(reply.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		select {
+		case <-w.done:
+			return
+		case <-timeout:
+		case <-canceled:
+		}
+
+		// 交由 executor 协程解除挂起
+		select {
+		case <-w.done:
+		case <-e.ctx.Done():
+		case e.wakeup <- &w:
+		}
+	}()
+}
+
+// 解除挂起，并将 reply 返回给指令的发起方
+func (e *DBExecutor) unblock(w *waiter, reply handler.Reply) {
+	if !e.blocking.remove(w) {
+		return
+	}
+	close(w.done)
+	w.cmd.receiver <- reply
+}
+
+// 有 key 数据就绪时，按照阻塞先后顺序重新执行挂起的指令
+func (e *DBExecutor) serveBlocked() {
+	for {
+		keys := e.dataStore.ReadyKeys()
+		if len(keys) == 0 {
+			return
+		}
+
+		for _, key := range keys {
+			for _, w := range e.blocking.get(key) {
+				// 可能已经因为其他 key 就绪而解除挂起
+				if len(w.elems) == 0 {
+					continue
+				}
+				// 连接已经断开，但 wakeup 事件尚未被处理，不再重试
+				if ctx := w.cmd.Ctx(); ctx != nil && ctx.Err() != nil {
+					e.unblock(w, w.timeoutReply)
+					continue
+				}
+				reply := w.cmdFunc(w.cmd)
+				if _, ok := reply.(*BlockReply); ok {
+					continue
+				}
+				e.unblock(w, reply)
+			}
+		}
+	}
+}
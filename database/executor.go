@@ -18,6 +18,10 @@ type DBExecutor struct {
 	dataStore   DataStore
 
 	gcTicker *time.Ticker
+
+	// 阻塞指令的等待队列
+	blocking *blockingQueue
+	wakeup   chan *waiter
 }
 
 func NewDBExecutor(dataStore DataStore) Executor {
@@ -28,38 +32,229 @@ func NewDBExecutor(dataStore DataStore) Executor {
 		ctx:       ctx,
 		cancel:    cancel,
 		gcTicker:  time.NewTicker(time.Minute),
+		blocking:  newBlockingQueue(),
+		wakeup:    make(chan *waiter),
 	}
 	e.cmdHandlers = map[CmdType]CmdHandler{
-		CmdTypeExpire:   e.dataStore.Expire,
-		CmdTypeExpireAt: e.dataStore.ExpireAt,
+		// keyspace
+		CmdTypeDel:       e.dataStore.Del,
+		CmdTypeExists:    e.dataStore.Exists,
+		CmdTypeType:      e.dataStore.Type,
+		CmdTypeRename:    e.dataStore.Rename,
+		CmdTypeRenameNx:  e.dataStore.RenameNx,
+		CmdTypeRandomKey: e.dataStore.RandomKey,
+		CmdTypeDBSize:    e.dataStore.DBSize,
+		CmdTypeKeys:      e.dataStore.Keys,
+		CmdTypeScan:      e.dataStore.Scan,
+		CmdTypeObject:    e.dataStore.Object,
+
+		// expire
+		CmdTypeExpire:      e.dataStore.Expire,
+		CmdTypeExpireAt:    e.dataStore.ExpireAt,
+		CmdTypePExpire:     e.dataStore.PExpire,
+		CmdTypePExpireAt:   e.dataStore.PExpireAt,
+		CmdTypePersist:     e.dataStore.Persist,
+		CmdTypeTTL:         e.dataStore.TTL,
+		CmdTypePTTL:        e.dataStore.PTTL,
+		CmdTypeExpireTime:  e.dataStore.ExpireTime,
+		CmdTypePExpireTime: e.dataStore.PExpireTime,
 
 		// string
-		CmdTypeGet:  e.dataStore.Get,
-		CmdTypeSet:  e.dataStore.Set,
-		CmdTypeMGet: e.dataStore.MGet,
-		CmdTypeMSet: e.dataStore.MSet,
+		CmdTypeGet:         e.dataStore.Get,
+		CmdTypeSet:         e.dataStore.Set,
+		CmdTypeMGet:        e.dataStore.MGet,
+		CmdTypeMSet:        e.dataStore.MSet,
+		CmdTypeIncr:        e.dataStore.Incr,
+		CmdTypeDecr:        e.dataStore.Decr,
+		CmdTypeIncrBy:      e.dataStore.IncrBy,
+		CmdTypeDecrBy:      e.dataStore.DecrBy,
+		CmdTypeIncrByFloat: e.dataStore.IncrByFloat,
+		CmdTypeAppend:      e.dataStore.Append,
+		CmdTypeStrLen:      e.dataStore.StrLen,
+		CmdTypeGetRange:    e.dataStore.GetRange,
+		CmdTypeSetRange:    e.dataStore.SetRange,
+		CmdTypeGetSet:      e.dataStore.GetSet,
+		CmdTypeGetDel:      e.dataStore.GetDel,
+		CmdTypeGetEx:       e.dataStore.GetEx,
+
+		// bitmap
+		CmdTypeSetBit:   e.dataStore.SetBit,
+		CmdTypeGetBit:   e.dataStore.GetBit,
+		CmdTypeBitCount: e.dataStore.BitCount,
+		CmdTypeBitPos:   e.dataStore.BitPos,
+		CmdTypeBitOp:    e.dataStore.BitOp,
+		CmdTypeBitField: e.dataStore.BitField,
 
 		// list
-		CmdTypeLPush:  e.dataStore.LPush,
-		CmdTypeLPop:   e.dataStore.LPop,
-		CmdTypeRPush:  e.dataStore.RPush,
-		CmdTypeRPop:   e.dataStore.RPop,
-		CmdTypeLRange: e.dataStore.LRange,
+		CmdTypeLPush:   e.dataStore.LPush,
+		CmdTypeLPop:    e.dataStore.LPop,
+		CmdTypeRPush:   e.dataStore.RPush,
+		CmdTypeRPop:    e.dataStore.RPop,
+		CmdTypeLRange:  e.dataStore.LRange,
+		CmdTypeLPushX:  e.dataStore.LPushX,
+		CmdTypeRPushX:  e.dataStore.RPushX,
+		CmdTypeLLen:    e.dataStore.LLen,
+		CmdTypeLIndex:  e.dataStore.LIndex,
+		CmdTypeLSet:    e.dataStore.LSet,
+		CmdTypeLInsert: e.dataStore.LInsert,
+		CmdTypeLRem:    e.dataStore.LRem,
+		CmdTypeLTrim:   e.dataStore.LTrim,
+		CmdTypeLPos:    e.dataStore.LPos,
+		CmdTypeLMove:   e.dataStore.LMove,
+		CmdTypeBLPop:   e.dataStore.BLPop,
+		CmdTypeBRPop:   e.dataStore.BRPop,
+		CmdTypeBLMove:  e.dataStore.BLMove,
 
 		// set
-		CmdTypeSAdd:      e.dataStore.SAdd,
-		CmdTypeSIsMember: e.dataStore.SIsMember,
-		CmdTypeSRem:      e.dataStore.SRem,
+		CmdTypeSAdd:        e.dataStore.SAdd,
+		CmdTypeSIsMember:   e.dataStore.SIsMember,
+		CmdTypeSRem:        e.dataStore.SRem,
+		CmdTypeSScan:       e.dataStore.SScan,
+		CmdTypeSMembers:    e.dataStore.SMembers,
+		CmdTypeSCard:       e.dataStore.SCard,
+		CmdTypeSMIsMember:  e.dataStore.SMIsMember,
+		CmdTypeSPop:        e.dataStore.SPop,
+		CmdTypeSRandMember: e.dataStore.SRandMember,
+		CmdTypeSMove:       e.dataStore.SMove,
+		CmdTypeSInter:      e.dataStore.SInter,
+		CmdTypeSUnion:      e.dataStore.SUnion,
+		CmdTypeSDiff:       e.dataStore.SDiff,
+		CmdTypeSInterStore: e.dataStore.SInterStore,
+		CmdTypeSUnionStore: e.dataStore.SUnionStore,
+		CmdTypeSDiffStore:  e.dataStore.SDiffStore,
+		CmdTypeSInterCard:  e.dataStore.SInterCard,
 
 		// hash
-		CmdTypeHSet: e.dataStore.HSet,
-		CmdTypeHGet: e.dataStore.HGet,
-		CmdTypeHDel: e.dataStore.HDel,
+		CmdTypeHSet:         e.dataStore.HSet,
+		CmdTypeHGet:         e.dataStore.HGet,
+		CmdTypeHDel:         e.dataStore.HDel,
+		CmdTypeHScan:        e.dataStore.HScan,
+		CmdTypeHSetNx:       e.dataStore.HSetNx,
+		CmdTypeHMGet:        e.dataStore.HMGet,
+		CmdTypeHGetAll:      e.dataStore.HGetAll,
+		CmdTypeHKeys:        e.dataStore.HKeys,
+		CmdTypeHVals:        e.dataStore.HVals,
+		CmdTypeHExists:      e.dataStore.HExists,
+		CmdTypeHLen:         e.dataStore.HLen,
+		CmdTypeHStrLen:      e.dataStore.HStrLen,
+		CmdTypeHIncrBy:      e.dataStore.HIncrBy,
+		CmdTypeHIncrByFloat: e.dataStore.HIncrByFloat,
+		CmdTypeHRandField:   e.dataStore.HRandField,
+		CmdTypeHExpire:      e.dataStore.HExpire,
+		CmdTypeHPExpire:     e.dataStore.HPExpire,
+		CmdTypeHExpireAt:    e.dataStore.HExpireAt,
+		CmdTypeHPExpireAt:   e.dataStore.HPExpireAt,
+		CmdTypeHTTL:         e.dataStore.HTTL,
+		CmdTypeHPTTL:        e.dataStore.HPTTL,
+		CmdTypeHPersist:     e.dataStore.HPersist,
 
 		// sorted set
-		CmdTypeZAdd:          e.dataStore.ZAdd,
-		CmdTypeZRangeByScore: e.dataStore.ZRangeByScore,
-		CmdTypeZRem:          e.dataStore.ZRem,
+		CmdTypeZAdd:             e.dataStore.ZAdd,
+		CmdTypeZRangeByScore:    e.dataStore.ZRangeByScore,
+		CmdTypeZRevRangeByScore: e.dataStore.ZRevRangeByScore,
+		CmdTypeZRem:             e.dataStore.ZRem,
+		CmdTypeZScan:            e.dataStore.ZScan,
+		CmdTypeZRange:           e.dataStore.ZRange,
+		CmdTypeZRank:            e.dataStore.ZRank,
+		CmdTypeZRevRank:         e.dataStore.ZRevRank,
+		CmdTypeZCard:            e.dataStore.ZCard,
+		CmdTypeZCount:           e.dataStore.ZCount,
+		CmdTypeZScore:           e.dataStore.ZScore,
+		CmdTypeZIncrBy:          e.dataStore.ZIncrBy,
+		CmdTypeZRangeByLex:      e.dataStore.ZRangeByLex,
+		CmdTypeZRevRangeByLex:   e.dataStore.ZRevRangeByLex,
+		CmdTypeZLexCount:        e.dataStore.ZLexCount,
+		CmdTypeZRemRangeByScore: e.dataStore.ZRemRangeByScore,
+		CmdTypeZRemRangeByLex:   e.dataStore.ZRemRangeByLex,
+		CmdTypeZRemRangeByRank:  e.dataStore.ZRemRangeByRank,
+		CmdTypeZUnion:           e.dataStore.ZUnion,
+		CmdTypeZInter:           e.dataStore.ZInter,
+		CmdTypeZDiff:            e.dataStore.ZDiff,
+		CmdTypeZUnionStore:      e.dataStore.ZUnionStore,
+		CmdTypeZInterStore:      e.dataStore.ZInterStore,
+		CmdTypeZDiffStore:       e.dataStore.ZDiffStore,
+		CmdTypeZPopMin:          e.dataStore.ZPopMin,
+		CmdTypeZPopMax:          e.dataStore.ZPopMax,
+		CmdTypeZRandMember:      e.dataStore.ZRandMember,
+		CmdTypeBZPopMin:         e.dataStore.BZPopMin,
+		CmdTypeBZPopMax:         e.dataStore.BZPopMax,
+		CmdTypeBZMPop:           e.dataStore.BZMPop,
+
+		// stream
+		CmdTypeXAdd:      e.dataStore.XAdd,
+		CmdTypeXRange:    e.dataStore.XRange,
+		CmdTypeXRevRange: e.dataStore.XRevRange,
+		CmdTypeXLen:      e.dataStore.XLen,
+		CmdTypeXTrim:     e.dataStore.XTrim,
+		CmdTypeXDel:      e.dataStore.XDel,
+		CmdTypeXSetID:    e.dataStore.XSetID,
+		CmdTypeXRead:     e.dataStore.XRead,
+
+		// stream 消费者组
+		CmdTypeXGroup:     e.dataStore.XGroup,
+		CmdTypeXReadGroup: e.dataStore.XReadGroup,
+		CmdTypeXAck:       e.dataStore.XAck,
+		CmdTypeXPending:   e.dataStore.XPending,
+		CmdTypeXClaim:     e.dataStore.XClaim,
+		CmdTypeXAutoClaim: e.dataStore.XAutoClaim,
+		CmdTypeXInfo:      e.dataStore.XInfo,
+
+		// hyperloglog
+		CmdTypePFAdd:   e.dataStore.PFAdd,
+		CmdTypePFCount: e.dataStore.PFCount,
+		CmdTypePFMerge: e.dataStore.PFMerge,
+
+		// geo
+		CmdTypeGeoAdd:         e.dataStore.GeoAdd,
+		CmdTypeGeoDist:        e.dataStore.GeoDist,
+		CmdTypeGeoPos:         e.dataStore.GeoPos,
+		CmdTypeGeoHash:        e.dataStore.GeoHash,
+		CmdTypeGeoSearch:      e.dataStore.GeoSearch,
+		CmdTypeGeoSearchStore: e.dataStore.GeoSearchStore,
+
+		// bloom filter
+		CmdTypeBFReserve:   e.dataStore.BFReserve,
+		CmdTypeBFAdd:       e.dataStore.BFAdd,
+		CmdTypeBFMAdd:      e.dataStore.BFMAdd,
+		CmdTypeBFExists:    e.dataStore.BFExists,
+		CmdTypeBFMExists:   e.dataStore.BFMExists,
+		CmdTypeBFInfo:      e.dataStore.BFInfo,
+		CmdTypeBFScanDump:  e.dataStore.BFScanDump,
+		CmdTypeBFLoadChunk: e.dataStore.BFLoadChunk,
+
+		// cuckoo filter
+		CmdTypeCFReserve:   e.dataStore.CFReserve,
+		CmdTypeCFAdd:       e.dataStore.CFAdd,
+		CmdTypeCFAddNX:     e.dataStore.CFAddNX,
+		CmdTypeCFDel:       e.dataStore.CFDel,
+		CmdTypeCFExists:    e.dataStore.CFExists,
+		CmdTypeCFCount:     e.dataStore.CFCount,
+		CmdTypeCFScanDump:  e.dataStore.CFScanDump,
+		CmdTypeCFLoadChunk: e.dataStore.CFLoadChunk,
+
+		// count-min sketch
+		CmdTypeCMSInitByDim: e.dataStore.CMSInitByDim,
+		CmdTypeCMSIncrBy:    e.dataStore.CMSIncrBy,
+		CmdTypeCMSQuery:     e.dataStore.CMSQuery,
+		CmdTypeCMSMerge:     e.dataStore.CMSMerge,
+		CmdTypeCMSLoadChunk: e.dataStore.CMSLoadChunk,
+
+		// top-k
+		CmdTypeTopKReserve:   e.dataStore.TopKReserve,
+		CmdTypeTopKAdd:       e.dataStore.TopKAdd,
+		CmdTypeTopKIncrBy:    e.dataStore.TopKIncrBy,
+		CmdTypeTopKList:      e.dataStore.TopKList,
+		CmdTypeTopKQuery:     e.dataStore.TopKQuery,
+		CmdTypeTopKLoadChunk: e.dataStore.TopKLoadChunk,
+
+		// json
+		CmdTypeJSONSet:       e.dataStore.JSONSet,
+		CmdTypeJSONGet:       e.dataStore.JSONGet,
+		CmdTypeJSONDel:       e.dataStore.JSONDel,
+		CmdTypeJSONType:      e.dataStore.JSONType,
+		CmdTypeJSONArrAppend: e.dataStore.JSONArrAppend,
+		CmdTypeJSONNumIncrBy: e.dataStore.JSONNumIncrBy,
+		CmdTypeJSONObjKeys:   e.dataStore.JSONObjKeys,
 	}
 
 	pool.Submit(e.run)
@@ -89,6 +284,10 @@ func (e *DBExecutor) run() {
 		case <-e.gcTicker.C:
 			e.dataStore.GC()
 
+		// 阻塞指令超时或者连接断开
+		case w := <-e.wakeup:
+			e.unblock(w, w.timeoutReply)
+
 		case cmd := <-e.ch:
 			cmdFunc, ok := e.cmdHandlers[cmd.cmd]
 			if !ok {
@@ -96,8 +295,19 @@ func (e *DBExecutor) run() {
 				continue
 			}
 
-			e.dataStore.ExpirePreprocess(string(cmd.args[0])) // 懒加载机制实现过期 key 删除
-			cmd.receiver <- cmdFunc(cmd)
+			e.dataStore.SetLoading(cmd.Loading())
+			if len(cmd.args) > 0 {
+				e.dataStore.ExpirePreprocess(string(cmd.args[0])) // 懒加载机制实现过期 key 删除
+			}
+			reply := cmdFunc(cmd)
+			if blockReply, ok := reply.(*BlockReply); ok {
+				e.block(cmd, cmdFunc, blockReply)
+			} else {
+				cmd.receiver <- reply
+			}
+
+			// 指令执行后可能有 key 数据就绪，唤醒挂起的阻塞指令
+			e.serveBlocked()
 		}
 	}
 }
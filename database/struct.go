@@ -21,56 +21,306 @@ func (c CmdType) String() string {
 }
 
 const (
-	CmdTypeExpire   CmdType = "expire"
-	CmdTypeExpireAt CmdType = "expireat"
+	// keyspace
+	CmdTypeDel       CmdType = "del"
+	CmdTypeExists    CmdType = "exists"
+	CmdTypeType      CmdType = "type"
+	CmdTypeRename    CmdType = "rename"
+	CmdTypeRenameNx  CmdType = "renamenx"
+	CmdTypeRandomKey CmdType = "randomkey"
+	CmdTypeDBSize    CmdType = "dbsize"
+	CmdTypeKeys      CmdType = "keys"
+	CmdTypeScan      CmdType = "scan"
+	CmdTypeObject    CmdType = "object"
+
+	// expire
+	CmdTypeExpire      CmdType = "expire"
+	CmdTypeExpireAt    CmdType = "expireat"
+	CmdTypePExpire     CmdType = "pexpire"
+	CmdTypePExpireAt   CmdType = "pexpireat"
+	CmdTypePersist     CmdType = "persist"
+	CmdTypeTTL         CmdType = "ttl"
+	CmdTypePTTL        CmdType = "pttl"
+	CmdTypeExpireTime  CmdType = "expiretime"
+	CmdTypePExpireTime CmdType = "pexpiretime"
 
 	// string
-	CmdTypeGet  CmdType = "get"
-	CmdTypeSet  CmdType = "set"
-	CmdTypeMGet CmdType = "mget"
-	CmdTypeMSet CmdType = "mset"
+	CmdTypeGet         CmdType = "get"
+	CmdTypeSet         CmdType = "set"
+	CmdTypeMGet        CmdType = "mget"
+	CmdTypeMSet        CmdType = "mset"
+	CmdTypeIncr        CmdType = "incr"
+	CmdTypeDecr        CmdType = "decr"
+	CmdTypeIncrBy      CmdType = "incrby"
+	CmdTypeDecrBy      CmdType = "decrby"
+	CmdTypeIncrByFloat CmdType = "incrbyfloat"
+	CmdTypeAppend      CmdType = "append"
+	CmdTypeStrLen      CmdType = "strlen"
+	CmdTypeGetRange    CmdType = "getrange"
+	CmdTypeSetRange    CmdType = "setrange"
+	CmdTypeGetSet      CmdType = "getset"
+	CmdTypeGetDel      CmdType = "getdel"
+	CmdTypeGetEx       CmdType = "getex"
+
+	// bitmap
+	CmdTypeSetBit   CmdType = "setbit"
+	CmdTypeGetBit   CmdType = "getbit"
+	CmdTypeBitCount CmdType = "bitcount"
+	CmdTypeBitPos   CmdType = "bitpos"
+	CmdTypeBitOp    CmdType = "bitop"
+	CmdTypeBitField CmdType = "bitfield"
 
 	// list
-	CmdTypeLPush  CmdType = "lpush"
-	CmdTypeLPop   CmdType = "lpop"
-	CmdTypeRPush  CmdType = "rpush"
-	CmdTypeRPop   CmdType = "rpop"
-	CmdTypeLRange CmdType = "lrange"
+	CmdTypeLPush   CmdType = "lpush"
+	CmdTypeLPop    CmdType = "lpop"
+	CmdTypeRPush   CmdType = "rpush"
+	CmdTypeRPop    CmdType = "rpop"
+	CmdTypeLRange  CmdType = "lrange"
+	CmdTypeLPushX  CmdType = "lpushx"
+	CmdTypeRPushX  CmdType = "rpushx"
+	CmdTypeLLen    CmdType = "llen"
+	CmdTypeLIndex  CmdType = "lindex"
+	CmdTypeLSet    CmdType = "lset"
+	CmdTypeLInsert CmdType = "linsert"
+	CmdTypeLRem    CmdType = "lrem"
+	CmdTypeLTrim   CmdType = "ltrim"
+	CmdTypeLPos    CmdType = "lpos"
+	CmdTypeLMove   CmdType = "lmove"
+	CmdTypeBLPop   CmdType = "blpop"
+	CmdTypeBRPop   CmdType = "brpop"
+	CmdTypeBLMove  CmdType = "blmove"
 
 	// hash
-	CmdTypeHSet CmdType = "hset"
-	CmdTypeHGet CmdType = "hget"
-	CmdTypeHDel CmdType = "hdel"
+	CmdTypeHSet         CmdType = "hset"
+	CmdTypeHGet         CmdType = "hget"
+	CmdTypeHDel         CmdType = "hdel"
+	CmdTypeHScan        CmdType = "hscan"
+	CmdTypeHSetNx       CmdType = "hsetnx"
+	CmdTypeHMGet        CmdType = "hmget"
+	CmdTypeHGetAll      CmdType = "hgetall"
+	CmdTypeHKeys        CmdType = "hkeys"
+	CmdTypeHVals        CmdType = "hvals"
+	CmdTypeHExists      CmdType = "hexists"
+	CmdTypeHLen         CmdType = "hlen"
+	CmdTypeHStrLen      CmdType = "hstrlen"
+	CmdTypeHIncrBy      CmdType = "hincrby"
+	CmdTypeHIncrByFloat CmdType = "hincrbyfloat"
+	CmdTypeHRandField   CmdType = "hrandfield"
+	CmdTypeHExpire      CmdType = "hexpire"
+	CmdTypeHPExpire     CmdType = "hpexpire"
+	CmdTypeHExpireAt    CmdType = "hexpireat"
+	CmdTypeHPExpireAt   CmdType = "hpexpireat"
+	CmdTypeHTTL         CmdType = "httl"
+	CmdTypeHPTTL        CmdType = "hpttl"
+	CmdTypeHPersist     CmdType = "hpersist"
 
 	// set
-	CmdTypeSAdd      CmdType = "sadd"
-	CmdTypeSIsMember CmdType = "sismember"
-	CmdTypeSRem      CmdType = "srem"
+	CmdTypeSAdd        CmdType = "sadd"
+	CmdTypeSIsMember   CmdType = "sismember"
+	CmdTypeSRem        CmdType = "srem"
+	CmdTypeSScan       CmdType = "sscan"
+	CmdTypeSMembers    CmdType = "smembers"
+	CmdTypeSCard       CmdType = "scard"
+	CmdTypeSMIsMember  CmdType = "smismember"
+	CmdTypeSPop        CmdType = "spop"
+	CmdTypeSRandMember CmdType = "srandmember"
+	CmdTypeSMove       CmdType = "smove"
+	CmdTypeSInter      CmdType = "sinter"
+	CmdTypeSUnion      CmdType = "sunion"
+	CmdTypeSDiff       CmdType = "sdiff"
+	CmdTypeSInterStore CmdType = "sinterstore"
+	CmdTypeSUnionStore CmdType = "sunionstore"
+	CmdTypeSDiffStore  CmdType = "sdiffstore"
+	CmdTypeSInterCard  CmdType = "sintercard"
 
 	// sorted set
-	CmdTypeZAdd          CmdType = "zadd"
-	CmdTypeZRangeByScore CmdType = "zrangebyscore"
-	CmdTypeZRem          CmdType = "zrem"
+	CmdTypeZAdd             CmdType = "zadd"
+	CmdTypeZRangeByScore    CmdType = "zrangebyscore"
+	CmdTypeZRevRangeByScore CmdType = "zrevrangebyscore"
+	CmdTypeZRem             CmdType = "zrem"
+	CmdTypeZScan            CmdType = "zscan"
+	CmdTypeZRange           CmdType = "zrange"
+	CmdTypeZRank            CmdType = "zrank"
+	CmdTypeZRevRank         CmdType = "zrevrank"
+	CmdTypeZCard            CmdType = "zcard"
+	CmdTypeZCount           CmdType = "zcount"
+	CmdTypeZScore           CmdType = "zscore"
+	CmdTypeZIncrBy          CmdType = "zincrby"
+	CmdTypeZRangeByLex      CmdType = "zrangebylex"
+	CmdTypeZRevRangeByLex   CmdType = "zrevrangebylex"
+	CmdTypeZLexCount        CmdType = "zlexcount"
+	CmdTypeZRemRangeByScore CmdType = "zremrangebyscore"
+	CmdTypeZRemRangeByLex   CmdType = "zremrangebylex"
+	CmdTypeZRemRangeByRank  CmdType = "zremrangebyrank"
+	CmdTypeZUnion           CmdType = "zunion"
+	CmdTypeZInter           CmdType = "zinter"
+	CmdTypeZDiff            CmdType = "zdiff"
+	CmdTypeZUnionStore      CmdType = "zunionstore"
+	CmdTypeZInterStore      CmdType = "zinterstore"
+	CmdTypeZDiffStore       CmdType = "zdiffstore"
+	CmdTypeZPopMin          CmdType = "zpopmin"
+	CmdTypeZPopMax          CmdType = "zpopmax"
+	CmdTypeZRandMember      CmdType = "zrandmember"
+	CmdTypeBZPopMin         CmdType = "bzpopmin"
+	CmdTypeBZPopMax         CmdType = "bzpopmax"
+	CmdTypeBZMPop           CmdType = "bzmpop"
+
+	// stream
+	CmdTypeXAdd      CmdType = "xadd"
+	CmdTypeXRange    CmdType = "xrange"
+	CmdTypeXRevRange CmdType = "xrevrange"
+	CmdTypeXLen      CmdType = "xlen"
+	CmdTypeXTrim     CmdType = "xtrim"
+	CmdTypeXDel      CmdType = "xdel"
+	CmdTypeXSetID    CmdType = "xsetid"
+	CmdTypeXRead     CmdType = "xread"
+
+	// stream 消费者组
+	CmdTypeXGroup     CmdType = "xgroup"
+	CmdTypeXReadGroup CmdType = "xreadgroup"
+	CmdTypeXAck       CmdType = "xack"
+	CmdTypeXPending   CmdType = "xpending"
+	CmdTypeXClaim     CmdType = "xclaim"
+	CmdTypeXAutoClaim CmdType = "xautoclaim"
+	CmdTypeXInfo      CmdType = "xinfo"
+
+	// hyperloglog
+	CmdTypePFAdd   CmdType = "pfadd"
+	CmdTypePFCount CmdType = "pfcount"
+	CmdTypePFMerge CmdType = "pfmerge"
+
+	// geo
+	CmdTypeGeoAdd         CmdType = "geoadd"
+	CmdTypeGeoDist        CmdType = "geodist"
+	CmdTypeGeoPos         CmdType = "geopos"
+	CmdTypeGeoHash        CmdType = "geohash"
+	CmdTypeGeoSearch      CmdType = "geosearch"
+	CmdTypeGeoSearchStore CmdType = "geosearchstore"
+
+	// bloom filter
+	CmdTypeBFReserve   CmdType = "bf.reserve"
+	CmdTypeBFAdd       CmdType = "bf.add"
+	CmdTypeBFMAdd      CmdType = "bf.madd"
+	CmdTypeBFExists    CmdType = "bf.exists"
+	CmdTypeBFMExists   CmdType = "bf.mexists"
+	CmdTypeBFInfo      CmdType = "bf.info"
+	CmdTypeBFScanDump  CmdType = "bf.scandump"
+	CmdTypeBFLoadChunk CmdType = "bf.loadchunk"
+
+	// cuckoo filter
+	CmdTypeCFReserve   CmdType = "cf.reserve"
+	CmdTypeCFAdd       CmdType = "cf.add"
+	CmdTypeCFAddNX     CmdType = "cf.addnx"
+	CmdTypeCFDel       CmdType = "cf.del"
+	CmdTypeCFExists    CmdType = "cf.exists"
+	CmdTypeCFCount     CmdType = "cf.count"
+	CmdTypeCFScanDump  CmdType = "cf.scandump"
+	CmdTypeCFLoadChunk CmdType = "cf.loadchunk"
+
+	// count-min sketch
+	CmdTypeCMSInitByDim CmdType = "cms.initbydim"
+	CmdTypeCMSIncrBy    CmdType = "cms.incrby"
+	CmdTypeCMSQuery     CmdType = "cms.query"
+	CmdTypeCMSMerge     CmdType = "cms.merge"
+	CmdTypeCMSLoadChunk CmdType = "cms.loadchunk"
+
+	// top-k
+	CmdTypeTopKReserve   CmdType = "topk.reserve"
+	CmdTypeTopKAdd       CmdType = "topk.add"
+	CmdTypeTopKIncrBy    CmdType = "topk.incrby"
+	CmdTypeTopKList      CmdType = "topk.list"
+	CmdTypeTopKQuery     CmdType = "topk.query"
+	CmdTypeTopKLoadChunk CmdType = "topk.loadchunk"
+
+	// json
+	CmdTypeJSONSet       CmdType = "json.set"
+	CmdTypeJSONGet       CmdType = "json.get"
+	CmdTypeJSONDel       CmdType = "json.del"
+	CmdTypeJSONType      CmdType = "json.type"
+	CmdTypeJSONArrAppend CmdType = "json.arrappend"
+	CmdTypeJSONNumIncrBy CmdType = "json.numincrby"
+	CmdTypeJSONObjKeys   CmdType = "json.objkeys"
 )
 
+// 无需携带参数的指令
+var keylessCmds = map[CmdType]struct{}{
+	CmdTypeRandomKey: {},
+	CmdTypeDBSize:    {},
+}
+
+func (c CmdType) Keyless() bool {
+	_, ok := keylessCmds[c]
+	return ok
+}
+
 type CmdAdapter interface {
 	ToCmd() [][]byte
 }
 
+// 无法通过单条指令完整还原的数据，如 hash 中 field 的过期时间，需要在 ToCmd 之后追加指令
+type MultiCmdAdapter interface {
+	CmdAdapter
+	ExtraCmds() [][][]byte
+}
+
 type DataStore interface {
 	ForEach(task func(key string, adapter CmdAdapter, expireAt *time.Time))
 
 	ExpirePreprocess(key string)
 	GC()
+	// 重放 aof 期间不回收过期数据，过期数据的删除以 aof 中记录的删除指令为准
+	SetLoading(loading bool)
+	// 返回上次调用以来新写入数据的 key，用于唤醒阻塞指令
+	ReadyKeys() []string
 
+	// keyspace
+	Del(*Command) handler.Reply
+	Exists(*Command) handler.Reply
+	Type(*Command) handler.Reply
+	Rename(*Command) handler.Reply
+	RenameNx(*Command) handler.Reply
+	RandomKey(*Command) handler.Reply
+	DBSize(*Command) handler.Reply
+	Keys(*Command) handler.Reply
+	Scan(*Command) handler.Reply
+	Object(*Command) handler.Reply
+
+	// expire
 	Expire(*Command) handler.Reply
 	ExpireAt(*Command) handler.Reply
+	PExpire(*Command) handler.Reply
+	PExpireAt(*Command) handler.Reply
+	Persist(*Command) handler.Reply
+	TTL(*Command) handler.Reply
+	PTTL(*Command) handler.Reply
+	ExpireTime(*Command) handler.Reply
+	PExpireTime(*Command) handler.Reply
 
 	// string
 	Get(*Command) handler.Reply
 	MGet(*Command) handler.Reply
 	Set(*Command) handler.Reply
 	MSet(*Command) handler.Reply
+	Incr(*Command) handler.Reply
+	Decr(*Command) handler.Reply
+	IncrBy(*Command) handler.Reply
+	DecrBy(*Command) handler.Reply
+	IncrByFloat(*Command) handler.Reply
+	Append(*Command) handler.Reply
+	StrLen(*Command) handler.Reply
+	GetRange(*Command) handler.Reply
+	SetRange(*Command) handler.Reply
+	GetSet(*Command) handler.Reply
+	GetDel(*Command) handler.Reply
+	GetEx(*Command) handler.Reply
+
+	// bitmap
+	SetBit(*Command) handler.Reply
+	GetBit(*Command) handler.Reply
+	BitCount(*Command) handler.Reply
+	BitPos(*Command) handler.Reply
+	BitOp(*Command) handler.Reply
+	BitField(*Command) handler.Reply
 
 	// list
 	LPush(*Command) handler.Reply
@@ -78,21 +328,170 @@ type DataStore interface {
 	RPush(*Command) handler.Reply
 	RPop(*Command) handler.Reply
 	LRange(*Command) handler.Reply
+	LPushX(*Command) handler.Reply
+	RPushX(*Command) handler.Reply
+	LLen(*Command) handler.Reply
+	LIndex(*Command) handler.Reply
+	LSet(*Command) handler.Reply
+	LInsert(*Command) handler.Reply
+	LRem(*Command) handler.Reply
+	LTrim(*Command) handler.Reply
+	LPos(*Command) handler.Reply
+	LMove(*Command) handler.Reply
+	BLPop(*Command) handler.Reply
+	BRPop(*Command) handler.Reply
+	BLMove(*Command) handler.Reply
 
 	// set
 	SAdd(*Command) handler.Reply
 	SIsMember(*Command) handler.Reply
 	SRem(*Command) handler.Reply
+	SScan(*Command) handler.Reply
+	SMembers(*Command) handler.Reply
+	SCard(*Command) handler.Reply
+	SMIsMember(*Command) handler.Reply
+	SPop(*Command) handler.Reply
+	SRandMember(*Command) handler.Reply
+	SMove(*Command) handler.Reply
+	SInter(*Command) handler.Reply
+	SUnion(*Command) handler.Reply
+	SDiff(*Command) handler.Reply
+	SInterStore(*Command) handler.Reply
+	SUnionStore(*Command) handler.Reply
+	SDiffStore(*Command) handler.Reply
+	SInterCard(*Command) handler.Reply
 
 	// hash
 	HSet(*Command) handler.Reply
 	HGet(*Command) handler.Reply
 	HDel(*Command) handler.Reply
+	HScan(*Command) handler.Reply
+	HSetNx(*Command) handler.Reply
+	HMGet(*Command) handler.Reply
+	HGetAll(*Command) handler.Reply
+	HKeys(*Command) handler.Reply
+	HVals(*Command) handler.Reply
+	HExists(*Command) handler.Reply
+	HLen(*Command) handler.Reply
+	HStrLen(*Command) handler.Reply
+	HIncrBy(*Command) handler.Reply
+	HIncrByFloat(*Command) handler.Reply
+	HRandField(*Command) handler.Reply
+	HExpire(*Command) handler.Reply
+	HPExpire(*Command) handler.Reply
+	HExpireAt(*Command) handler.Reply
+	HPExpireAt(*Command) handler.Reply
+	HTTL(*Command) handler.Reply
+	HPTTL(*Command) handler.Reply
+	HPersist(*Command) handler.Reply
 
 	// sorted set
 	ZAdd(*Command) handler.Reply
 	ZRangeByScore(*Command) handler.Reply
+	ZRevRangeByScore(*Command) handler.Reply
 	ZRem(*Command) handler.Reply
+	ZScan(*Command) handler.Reply
+	ZRange(*Command) handler.Reply
+	ZRank(*Command) handler.Reply
+	ZRevRank(*Command) handler.Reply
+	ZCard(*Command) handler.Reply
+	ZCount(*Command) handler.Reply
+	ZScore(*Command) handler.Reply
+	ZIncrBy(*Command) handler.Reply
+	ZRangeByLex(*Command) handler.Reply
+	ZRevRangeByLex(*Command) handler.Reply
+	ZLexCount(*Command) handler.Reply
+	ZRemRangeByScore(*Command) handler.Reply
+	ZRemRangeByLex(*Command) handler.Reply
+	ZRemRangeByRank(*Command) handler.Reply
+	ZUnion(*Command) handler.Reply
+	ZInter(*Command) handler.Reply
+	ZDiff(*Command) handler.Reply
+	ZUnionStore(*Command) handler.Reply
+	ZInterStore(*Command) handler.Reply
+	ZDiffStore(*Command) handler.Reply
+	ZPopMin(*Command) handler.Reply
+	ZPopMax(*Command) handler.Reply
+	ZRandMember(*Command) handler.Reply
+	BZPopMin(*Command) handler.Reply
+	BZPopMax(*Command) handler.Reply
+	BZMPop(*Command) handler.Reply
+
+	// stream
+	XAdd(*Command) handler.Reply
+	XRange(*Command) handler.Reply
+	XRevRange(*Command) handler.Reply
+	XLen(*Command) handler.Reply
+	XTrim(*Command) handler.Reply
+	XDel(*Command) handler.Reply
+	XSetID(*Command) handler.Reply
+	XRead(*Command) handler.Reply
+
+	// stream 消费者组
+	XGroup(*Command) handler.Reply
+	XReadGroup(*Command) handler.Reply
+	XAck(*Command) handler.Reply
+	XPending(*Command) handler.Reply
+	XClaim(*Command) handler.Reply
+	XAutoClaim(*Command) handler.Reply
+	XInfo(*Command) handler.Reply
+
+	// hyperloglog
+	PFAdd(*Command) handler.Reply
+	PFCount(*Command) handler.Reply
+	PFMerge(*Command) handler.Reply
+
+	// geo
+	GeoAdd(*Command) handler.Reply
+	GeoDist(*Command) handler.Reply
+	GeoPos(*Command) handler.Reply
+	GeoHash(*Command) handler.Reply
+	GeoSearch(*Command) handler.Reply
+	GeoSearchStore(*Command) handler.Reply
+
+	// bloom filter
+	BFReserve(*Command) handler.Reply
+	BFAdd(*Command) handler.Reply
+	BFMAdd(*Command) handler.Reply
+	BFExists(*Command) handler.Reply
+	BFMExists(*Command) handler.Reply
+	BFInfo(*Command) handler.Reply
+	BFScanDump(*Command) handler.Reply
+	BFLoadChunk(*Command) handler.Reply
+
+	// cuckoo filter
+	CFReserve(*Command) handler.Reply
+	CFAdd(*Command) handler.Reply
+	CFAddNX(*Command) handler.Reply
+	CFDel(*Command) handler.Reply
+	CFExists(*Command) handler.Reply
+	CFCount(*Command) handler.Reply
+	CFScanDump(*Command) handler.Reply
+	CFLoadChunk(*Command) handler.Reply
+
+	// count-min sketch
+	CMSInitByDim(*Command) handler.Reply
+	CMSIncrBy(*Command) handler.Reply
+	CMSQuery(*Command) handler.Reply
+	CMSMerge(*Command) handler.Reply
+	CMSLoadChunk(*Command) handler.Reply
+
+	// top-k
+	TopKReserve(*Command) handler.Reply
+	TopKAdd(*Command) handler.Reply
+	TopKIncrBy(*Command) handler.Reply
+	TopKList(*Command) handler.Reply
+	TopKQuery(*Command) handler.Reply
+	TopKLoadChunk(*Command) handler.Reply
+
+	// json
+	JSONSet(*Command) handler.Reply
+	JSONGet(*Command) handler.Reply
+	JSONDel(*Command) handler.Reply
+	JSONType(*Command) handler.Reply
+	JSONArrAppend(*Command) handler.Reply
+	JSONNumIncrBy(*Command) handler.Reply
+	JSONObjKeys(*Command) handler.Reply
 }
 
 type CmdHandler func(*Command) handler.Reply
@@ -115,6 +514,11 @@ func (c *Command) Ctx() context.Context {
 	return c.ctx
 }
 
+// 是否为重放 aof 时执行的指令
+func (c *Command) Loading() bool {
+	return c.ctx != nil && handler.IsLoadingPattern(c.ctx)
+}
+
 func (c *Command) Receiver() CmdReceiver {
 	return c.receiver
 }
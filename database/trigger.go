@@ -18,7 +18,7 @@ func NewDBTrigger(executor Executor) handler.DB {
 }
 
 func (d *DBTrigger) Do(ctx context.Context, cmdLine [][]byte) handler.Reply {
-	if len(cmdLine) < 2 {
+	if len(cmdLine) == 0 {
 		return handler.NewErrReply(fmt.Sprintf("invalid cmd line: %v", cmdLine))
 	}
 
@@ -27,6 +27,11 @@ func (d *DBTrigger) Do(ctx context.Context, cmdLine [][]byte) handler.Reply {
 		return handler.NewErrReply(fmt.Sprintf("unknown cmd '%s'", cmdLine[0]))
 	}
 
+	// 除个别指令外，至少需要携带一个 key
+	if len(cmdLine) < 2 && !cmdType.Keyless() {
+		return handler.NewErrReply(fmt.Sprintf("invalid cmd line: %v", cmdLine))
+	}
+
 	cmd := Command{
 		ctx:      ctx,
 		cmd:      cmdType,
@@ -0,0 +1,350 @@
+package datastore
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/AlphaMinZ/myredis_go/handler"
+)
+
+// bit 偏移量上限，对应 512MB 的字符串
+const maxBitOffset = maxStringLen<<3 - 1
+
+var (
+	errBitOffset            = errors.New("ERR bit offset is not an integer or out of range")
+	errBitValue             = errors.New("ERR bit is not an integer or out of range")
+	errBitfieldType         = errors.New("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	errBitfieldOverflowType = errors.New("ERR Invalid OVERFLOW type specified")
+)
+
+func parseBitOffset(b []byte) (int64, error) {
+	offset, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || offset < 0 || offset > maxBitOffset {
+		return 0, errBitOffset
+	}
+	return offset, nil
+}
+
+func parseBit(b []byte) (uint64, error) {
+	switch string(b) {
+	case "0":
+		return 0, nil
+	case "1":
+		return 1, nil
+	default:
+		return 0, errBitValue
+	}
+}
+
+// 解析 [start end [BYTE | BIT]] 区间，返回以 bit 为单位的闭区间. ok 为 false 代表区间为空
+func parseBitRange(args [][]byte, strLen int64) (startBit, endBit int64, endGiven, ok bool, err error) {
+	var start, end int64 = 0, -1
+	isBit := false
+	if len(args) > 0 {
+		if start, err = strconv.ParseInt(string(args[0]), 10, 64); err != nil {
+			return 0, 0, false, false, errNotInteger
+		}
+	}
+	if len(args) > 1 {
+		if end, err = strconv.ParseInt(string(args[1]), 10, 64); err != nil {
+			return 0, 0, false, false, errNotInteger
+		}
+		endGiven = true
+	}
+	if len(args) > 2 {
+		switch strings.ToLower(string(args[2])) {
+		case "byte":
+		case "bit":
+			isBit = true
+		default:
+			return 0, 0, false, false, handler.NewSyntaxErrReply()
+		}
+	}
+	if len(args) > 3 {
+		return 0, 0, false, false, handler.NewSyntaxErrReply()
+	}
+
+	total := strLen
+	if isBit {
+		total = strLen << 3
+	}
+	if start < 0 {
+		start += total
+	}
+	if end < 0 {
+		end += total
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= total {
+		end = total - 1
+	}
+	if start > end {
+		return 0, 0, endGiven, false, nil
+	}
+
+	if isBit {
+		return start, end, endGiven, true, nil
+	}
+	return start << 3, end<<3 + 7, endGiven, true, nil
+}
+
+// 统计闭区间 [startBit,endBit] 中取值为 1 的 bit 数量
+func bitCount(b []byte, startBit, endBit int64) int64 {
+	var cnt int64
+	for ; startBit <= endBit && startBit&7 != 0; startBit++ {
+		cnt += int64(b[startBit>>3]>>(7-startBit&7)) & 1
+	}
+	for ; startBit <= endBit && (endBit+1)&7 != 0; endBit-- {
+		cnt += int64(b[endBit>>3]>>(7-endBit&7)) & 1
+	}
+	for i := startBit >> 3; startBit <= endBit && i <= endBit>>3; i++ {
+		cnt += int64(bits.OnesCount8(b[i]))
+	}
+	return cnt
+}
+
+// 在闭区间 [startBit,endBit] 中查找首个取值为 bit 的位置，不存在时返回 -1
+func bitPos(b []byte, bit uint64, startBit, endBit int64) int64 {
+	for pos := startBit; pos <= endBit; pos++ {
+		// 整字节跳过
+		if pos&7 == 0 && pos+7 <= endBit {
+			if (bit == 1 && b[pos>>3] == 0) || (bit == 0 && b[pos>>3] == 0xff) {
+				pos += 7
+				continue
+			}
+		}
+		if uint64(b[pos>>3]>>(7-pos&7))&1 == bit {
+			return pos
+		}
+	}
+	return -1
+}
+
+// bitop 的按位运算，缺失的部分视为 0
+func bitOp(op string, srcs [][]byte) []byte {
+	var maxLen int
+	for _, src := range srcs {
+		if len(src) > maxLen {
+			maxLen = len(src)
+		}
+	}
+
+	res := make([]byte, maxLen)
+	for i := 0; i < maxLen; i++ {
+		var v byte
+		for j, src := range srcs {
+			var cur byte
+			if i < len(src) {
+				cur = src[i]
+			}
+			switch {
+			case op == "not":
+				v = ^cur
+			case j == 0:
+				v = cur
+			case op == "and":
+				v &= cur
+			case op == "or":
+				v |= cur
+			case op == "xor":
+				v ^= cur
+			}
+		}
+		res[i] = v
+	}
+	return res
+}
+
+// bitfield 溢出策略
+type bitfieldOverflow int
+
+const (
+	bitfieldOverflowWrap bitfieldOverflow = iota
+	bitfieldOverflowSat
+	bitfieldOverflowFail
+)
+
+type bitfieldOpKind int
+
+const (
+	bitfieldOpGet bitfieldOpKind = iota
+	bitfieldOpSet
+	bitfieldOpIncrBy
+)
+
+type bitfieldOp struct {
+	kind     bitfieldOpKind
+	signed   bool
+	bits     int
+	offset   int64
+	value    int64
+	overflow bitfieldOverflow
+}
+
+// [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP | SAT | FAIL]
+func parseBitfieldOps(args [][]byte) (ops []*bitfieldOp, write bool, err error) {
+	overflow := bitfieldOverflowWrap
+	for i := 0; i < len(args); {
+		sub := strings.ToLower(string(args[i]))
+		if sub == "overflow" {
+			if i+1 >= len(args) {
+				return nil, false, handler.NewSyntaxErrReply()
+			}
+			switch strings.ToLower(string(args[i+1])) {
+			case "wrap":
+				overflow = bitfieldOverflowWrap
+			case "sat":
+				overflow = bitfieldOverflowSat
+			case "fail":
+				overflow = bitfieldOverflowFail
+			default:
+				return nil, false, errBitfieldOverflowType
+			}
+			i += 2
+			continue
+		}
+
+		op := bitfieldOp{overflow: overflow}
+		argc := 3
+		switch sub {
+		case "get":
+			op.kind, argc = bitfieldOpGet, 2
+		case "set":
+			op.kind = bitfieldOpSet
+		case "incrby":
+			op.kind = bitfieldOpIncrBy
+		default:
+			return nil, false, handler.NewSyntaxErrReply()
+		}
+		if i+argc >= len(args) {
+			return nil, false, handler.NewSyntaxErrReply()
+		}
+
+		if op.signed, op.bits, err = parseBitfieldType(args[i+1]); err != nil {
+			return nil, false, err
+		}
+		if op.offset, err = parseBitfieldOffset(args[i+2], op.bits); err != nil {
+			return nil, false, err
+		}
+		if op.kind != bitfieldOpGet {
+			if op.value, err = strconv.ParseInt(string(args[i+3]), 10, 64); err != nil {
+				return nil, false, errNotInteger
+			}
+			write = true
+		}
+
+		ops = append(ops, &op)
+		i += argc + 1
+	}
+	return ops, write, nil
+}
+
+// i1~i64 或者 u1~u63
+func parseBitfieldType(b []byte) (bool, int, error) {
+	if len(b) < 2 || (b[0] != 'i' && b[0] != 'I' && b[0] != 'u' && b[0] != 'U') {
+		return false, 0, errBitfieldType
+	}
+	signed := b[0] == 'i' || b[0] == 'I'
+	n, err := strconv.Atoi(string(b[1:]))
+	if err != nil || n < 1 || (signed && n > 64) || (!signed && n > 63) {
+		return false, 0, errBitfieldType
+	}
+	return signed, n, nil
+}
+
+// 偏移量支持 #N 的形式，代表第 N 个 type 宽度的位置
+func parseBitfieldOffset(b []byte, width int) (int64, error) {
+	multiply := len(b) > 0 && b[0] == '#'
+	if multiply {
+		b = b[1:]
+	}
+	offset, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, errBitOffset
+	}
+	if multiply {
+		if offset > maxBitOffset/int64(width) {
+			return 0, errBitOffset
+		}
+		offset *= int64(width)
+	}
+	if offset+int64(width)-1 > maxBitOffset {
+		return 0, errBitOffset
+	}
+	return offset, nil
+}
+
+// 无符号字段 value + incr 的溢出检查. 发生溢出时返回按照策略处理后的结果
+func checkUnsignedBitfieldOverflow(value uint64, incr int64, width int, overflow bitfieldOverflow) (uint64, bool) {
+	max := uint64(1)<<width - 1
+	maxIncr := int64(max - value)
+	minIncr := -int64(value)
+
+	if value > max || incr > maxIncr {
+		if overflow == bitfieldOverflowWrap {
+			return (value + uint64(incr)) & max, true
+		}
+		return max, true
+	}
+	if incr < 0 && incr < minIncr {
+		if overflow == bitfieldOverflowWrap {
+			return (value + uint64(incr)) & max, true
+		}
+		return 0, true
+	}
+	return value + uint64(incr), false
+}
+
+// 有符号字段 value + incr 的溢出检查. 发生溢出时返回按照策略处理后的结果
+func checkSignedBitfieldOverflow(value, incr int64, width int, overflow bitfieldOverflow) (int64, bool) {
+	var max int64 = math.MaxInt64
+	if width < 64 {
+		max = int64(1)<<(width-1) - 1
+	}
+	min := -max - 1
+	maxIncr := max - value
+	minIncr := min - value
+
+	wrap := func() int64 {
+		c := uint64(value) + uint64(incr)
+		if width < 64 {
+			mask := ^uint64(0) << width
+			if c&(uint64(1)<<(width-1)) != 0 {
+				c |= mask
+			} else {
+				c &^= mask
+			}
+		}
+		return int64(c)
+	}
+
+	if value > max || (width != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr) {
+		if overflow == bitfieldOverflowWrap {
+			return wrap(), true
+		}
+		return max, true
+	}
+	if value < min || (width != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr) {
+		if overflow == bitfieldOverflowWrap {
+			return wrap(), true
+		}
+		return min, true
+	}
+	return value + incr, false
+}
+
+// 按照字段类型解释 bits 个 bit 的取值
+func bitfieldValue(raw uint64, signed bool, width int) int64 {
+	if signed && width < 64 && raw>>(width-1)&1 == 1 {
+		raw |= ^uint64(0) << width
+	}
+	return int64(raw)
+}
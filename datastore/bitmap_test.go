@@ -0,0 +1,116 @@
+package datastore
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bitfield_overflow(t *testing.T) {
+	db := newTestDB(t)
+	bitfield := func(args ...string) string {
+		return db.do(append([]string{"bitfield", "bf"}, args...)...)
+	}
+
+	t.Run("unsigned", func(t *testing.T) {
+		assert.Equal(t, "*1\r\n:0\r\n", bitfield("SET", "u8", "0", "255"))
+		assert.Equal(t, "*1\r\n:9\r\n", bitfield("INCRBY", "u8", "0", "10"))
+		assert.Equal(t, "*2\r\n:255\r\n:0\r\n", bitfield("OVERFLOW", "SAT", "INCRBY", "u8", "0", "300", "INCRBY", "u8", "0", "-300"))
+		assert.Equal(t, "*2\r\n$-1\r\n:0\r\n", bitfield("OVERFLOW", "FAIL", "INCRBY", "u8", "0", "-1", "GET", "u8", "0"))
+
+		// 溢出策略对 set 同样生效
+		assert.Equal(t, "*1\r\n:0\r\n", bitfield("SET", "u8", "0", "257"))
+		assert.Equal(t, "*1\r\n:1\r\n", bitfield("OVERFLOW", "SAT", "SET", "u8", "0", "300"))
+		assert.Equal(t, "*2\r\n$-1\r\n:255\r\n", bitfield("OVERFLOW", "FAIL", "SET", "u8", "0", "256", "GET", "u8", "0"))
+		assert.Equal(t, "*1\r\n$-1\r\n", bitfield("OVERFLOW", "FAIL", "INCRBY", "u8", "0", "1"))
+	})
+
+	t.Run("signed", func(t *testing.T) {
+		assert.Equal(t, "*1\r\n:0\r\n", bitfield("SET", "i8", "8", "127"))
+		assert.Equal(t, "*1\r\n:-128\r\n", bitfield("INCRBY", "i8", "8", "1"))
+		assert.Equal(t, "*2\r\n:127\r\n:-128\r\n", bitfield("OVERFLOW", "SAT", "INCRBY", "i8", "8", "300", "INCRBY", "i8", "8", "-300"))
+		assert.Equal(t, "*2\r\n$-1\r\n:-128\r\n", bitfield("OVERFLOW", "FAIL", "INCRBY", "i8", "8", "-1", "GET", "i8", "8"))
+
+		// 跨字节且不对齐的 i64
+		assert.Equal(t, "*1\r\n:0\r\n", bitfield("SET", "i64", "#1", "9223372036854775807"))
+		assert.Equal(t, "*2\r\n:-9223372036854775808\r\n:-9223372036854775808\r\n", bitfield("INCRBY", "i64", "#1", "1", "GET", "i64", "64"))
+		assert.Equal(t, "*1\r\n:-9223372036854775808\r\n", bitfield("OVERFLOW", "SAT", "INCRBY", "i64", "#1", "-1"))
+		assert.Equal(t, "*2\r\n$-1\r\n:-9223372036854775807\r\n", bitfield("OVERFLOW", "FAIL", "INCRBY", "i64", "#1", "-1", "INCRBY", "i64", "#1", "1"))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert.Equal(t, "-"+errBitfieldType.Error()+"\r\n", bitfield("GET", "u64", "0"))
+		assert.Equal(t, "-"+errBitfieldType.Error()+"\r\n", bitfield("GET", "i65", "0"))
+		assert.Equal(t, "-"+errBitfieldOverflowType.Error()+"\r\n", bitfield("OVERFLOW", "FOO", "GET", "u8", "0"))
+		assert.Equal(t, "-"+errBitOffset.Error()+"\r\n", bitfield("GET", "u8", "-1"))
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		replayed := db.replay(t)
+		assert.Equal(t, db.do("get", "bf"), replayed.do("get", "bf"))
+	})
+}
+
+func Test_bitpos(t *testing.T) {
+	db := newTestDB(t)
+	bitpos := func(key string, args ...string) int64 {
+		reply := db.do(append([]string{"bitpos", key}, args...)...)
+		pos, err := strconv.ParseInt(reply[1:len(reply)-2], 10, 64)
+		assert.Nil(t, err, reply)
+		return pos
+	}
+	assert.Equal(t, "+OK\r\n", db.do("set", "k", "\xff\xf0\x00"))
+	assert.Equal(t, "+OK\r\n", db.do("set", "ones", "\xff\xff"))
+	assert.Equal(t, "+OK\r\n", db.do("set", "empty", ""))
+
+	// 不存在的 key 视为全 0 的字符串
+	assert.Equal(t, int64(-1), bitpos("none", "1"))
+	assert.Equal(t, int64(0), bitpos("none", "0"))
+	assert.Equal(t, int64(-1), bitpos("empty", "0"))
+
+	assert.Equal(t, int64(0), bitpos("k", "1"))
+	assert.Equal(t, int64(12), bitpos("k", "0"))
+	assert.Equal(t, int64(-1), bitpos("k", "1", "2"))
+	assert.Equal(t, int64(-1), bitpos("k", "1", "-1"))
+	assert.Equal(t, int64(8), bitpos("k", "1", "-2"))
+	assert.Equal(t, int64(-1), bitpos("k", "0", "0", "0"))
+	assert.Equal(t, int64(-1), bitpos("k", "1", "2", "1"))
+
+	// 以 bit 为单位的区间
+	assert.Equal(t, int64(7), bitpos("k", "1", "7", "15", "BIT"))
+	assert.Equal(t, int64(-1), bitpos("k", "0", "8", "11", "BIT"))
+	assert.Equal(t, int64(12), bitpos("k", "0", "8", "12", "BIT"))
+	assert.Equal(t, int64(23), bitpos("k", "0", "-1", "-1", "BIT"))
+
+	// 查找 0 且未指定 end 时，字符串右侧视为由 0 填充
+	assert.Equal(t, int64(16), bitpos("ones", "0"))
+	assert.Equal(t, int64(16), bitpos("ones", "0", "1"))
+	assert.Equal(t, int64(-1), bitpos("ones", "0", "0", "-1"))
+	assert.Equal(t, int64(-1), bitpos("ones", "0", "0", "15", "BIT"))
+
+	assert.Equal(t, "-ERR The bit argument must be 1 or 0.\r\n", db.do("bitpos", "k", "2"))
+	assert.Equal(t, "-ERR value is not an integer or out of range\r\n", db.do("bitpos", "k", "1", "x"))
+}
+
+func Test_bitop_replay(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, "+OK\r\n", db.do("set", "b1", "abc"))
+	assert.Equal(t, "+OK\r\n", db.do("set", "b2", "a"))
+	assert.Equal(t, "+OK\r\n", db.do("set", "bd", "x"))
+	assert.Equal(t, ":1\r\n", db.do("expire", "bd", "100"))
+	db.expireSoon(t, "b1", "b2")
+
+	// 以 set 结果的形式持久化，并清除 destkey 原有的过期时间
+	assert.Equal(t, ":3\r\n", db.do("bitop", "or", "bd", "b1", "b2"))
+	assert.Equal(t, [][]byte{[]byte(database.CmdTypeSet), []byte("bd"), []byte("abc")}, db.persister.cmds[len(db.persister.cmds)-1])
+	assert.Equal(t, ":-1\r\n", db.do("ttl", "bd"))
+	waitExpired()
+
+	replayed := db.replay(t)
+	assert.Equal(t, ":0\r\n", replayed.do("exists", "b1", "b2"))
+	assert.Equal(t, ":3\r\n", replayed.do("strlen", "bd"))
+	assert.Equal(t, db.do("get", "bd"), replayed.do("get", "bd"))
+	assert.Equal(t, ":-1\r\n", replayed.do("ttl", "bd"))
+}
@@ -0,0 +1,114 @@
+package datastore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/AlphaMinZ/myredis_go/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+// 异步执行阻塞指令，并等待其被 executor 挂起
+func (d *testDB) doBlocking(ctx context.Context, args ...string) <-chan string {
+	ch := make(chan string, 1)
+	go func() {
+		ch <- d.doCtx(ctx, args...)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	return ch
+}
+
+func receive(t *testing.T, ch <-chan string) string {
+	select {
+	case reply := <-ch:
+		return reply
+	case <-time.After(time.Second):
+		t.Fatal("blocked command is not served")
+		return ""
+	}
+}
+
+func Test_blocking(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fifo", func(t *testing.T) {
+		db := newTestDB(t)
+		var chs []<-chan string
+		for i := 0; i < 3; i++ {
+			chs = append(chs, db.doBlocking(ctx, "blpop", "list", "0"))
+		}
+		assert.Equal(t, ":2\r\n", db.do("rpush", "list", "a", "b"))
+		assert.Equal(t, "*2\r\n$4\r\nlist\r\n$1\r\na\r\n", receive(t, chs[0]))
+		assert.Equal(t, "*2\r\n$4\r\nlist\r\n$1\r\nb\r\n", receive(t, chs[1]))
+
+		assert.Equal(t, ":1\r\n", db.do("rpush", "list", "c"))
+		assert.Equal(t, "*2\r\n$4\r\nlist\r\n$1\r\nc\r\n", receive(t, chs[2]))
+		assert.Equal(t, ":0\r\n", db.do("exists", "list"))
+	})
+
+	t.Run("multiple keys", func(t *testing.T) {
+		db := newTestDB(t)
+		ch := db.doBlocking(ctx, "brpop", "k1", "k2", "0")
+		assert.Equal(t, ":1\r\n", db.do("rpush", "k2", "x"))
+		assert.Equal(t, "*2\r\n$2\r\nk2\r\n$1\r\nx\r\n", receive(t, ch))
+
+		// 解除挂起后，不再占用其他 key 的等待队列
+		assert.Equal(t, ":1\r\n", db.do("rpush", "k1", "y"))
+		assert.Equal(t, ":1\r\n", db.do("llen", "k1"))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		db := newTestDB(t)
+		start := time.Now()
+		assert.Equal(t, "*-1\r\n", db.do("blpop", "list", "0.05"))
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+		assert.Equal(t, ":1\r\n", db.do("rpush", "list", "a"))
+		assert.Equal(t, ":1\r\n", db.do("llen", "list"))
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		db := newTestDB(t)
+		for i := 0; i < 20; i++ {
+			cctx, cancel := context.WithCancel(ctx)
+			ch := db.doBlocking(cctx, "blpop", "list", "0")
+
+			// 连接断开后立即写入数据，数据不能被已经断开的连接取走
+			cancel()
+			assert.Equal(t, ":1\r\n", db.do("rpush", "list", "a"))
+			assert.Equal(t, "*-1\r\n", receive(t, ch))
+			assert.Equal(t, ":1\r\n", db.do("llen", "list"))
+			assert.Equal(t, ":1\r\n", db.do("del", "list"))
+		}
+	})
+
+	t.Run("blmove persistence", func(t *testing.T) {
+		db := newTestDB(t)
+		ch := db.doBlocking(ctx, "blmove", "src", "dst", "LEFT", "RIGHT", "0")
+		assert.Equal(t, ":3\r\n", db.do("rpush", "src", "a", "b", "c"))
+		assert.Equal(t, "$1\r\na\r\n", receive(t, ch))
+
+		// 以非阻塞的 lpop + rpush 进行持久化，避免重放时阻塞
+		cmds := db.persister.cmds[len(db.persister.cmds)-2:]
+		assert.Equal(t, [][]byte{[]byte(database.CmdTypeLPop), []byte("src")}, cmds[0])
+		assert.Equal(t, [][]byte{[]byte(database.CmdTypeRPush), []byte("dst"), []byte("a")}, cmds[1])
+
+		// 重放时 src 已经过期，dst 不受影响
+		db.expireSoon(t, "src")
+		assert.Equal(t, "$1\r\nb\r\n", db.do("blmove", "src", "dst", "LEFT", "RIGHT", "0"))
+		waitExpired()
+
+		replayed := db.replay(t)
+		assert.Equal(t, ":0\r\n", replayed.do("exists", "src"))
+		assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", replayed.do("lrange", "dst", "0", "-1"))
+	})
+
+	t.Run("type changed", func(t *testing.T) {
+		db := newTestDB(t)
+		ch := db.doBlocking(ctx, "blpop", "list", "0")
+		assert.Equal(t, "+OK\r\n", db.do("set", "list", "x"))
+		assert.Equal(t, string(handler.NewWrongTypeErrReply().ToBytes()), receive(t, ch))
+	})
+}
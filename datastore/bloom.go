@@ -0,0 +1,343 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/AlphaMinZ/myredis_go/handler"
+)
+
+// 与 redisbloom 保持一致的默认参数. 每扩容一层，容量乘以 expansion，误判率减半
+const (
+	bloomDefaultErrorRate = 0.01
+	bloomDefaultCapacity  = 100
+	bloomDefaultExpansion = 2
+	bloomTighteningRatio  = 0.5
+	bloomHashSeed         = 0xc6a4a7935bd1e995
+	bloomMaxExpansion     = 32768
+	bloomMaxLayers        = 1024
+	bloomMaxHashes        = 1 << 11           // 误判率不低于最小的正浮点数 2^-1074
+	bloomMaxBits          = maxStringLen << 3 // 所有层的位数组总大小上限
+)
+
+var (
+	errFilterNotFound = errors.New("ERR not found")
+	errFilterExists   = errors.New("ERR item exists")
+	errBadChunk       = errors.New("ERR received bad data")
+	errBloomFull      = errors.New("ERR non scaling filter is full")
+	errBloomTooLarge  = errors.New("ERR filter exceeds the maximum size")
+)
+
+func (k *KVStore) getAsBloomFilter(key string) (BloomFilter, error) {
+	v, ok := k.data[key]
+	if !ok {
+		return nil, nil
+	}
+
+	bf, ok := v.(BloomFilter)
+	if !ok {
+		return nil, handler.NewWrongTypeErrReply()
+	}
+
+	return bf, nil
+}
+
+func (k *KVStore) putAsBloomFilter(key string, bf BloomFilter) {
+	k.putData(key, bf)
+}
+
+type BloomFilter interface {
+	Add(item []byte) (bool, error)
+	Exists(item []byte) bool
+	Capacity() int64
+	Size() int64
+	Filters() int64
+	Items() int64
+	Expansion() int64
+	ScanDump(iter int64) (int64, []byte)
+	LoadChunk(iter int64, chunk []byte) error
+	database.MultiCmdAdapter
+}
+
+// 单层布隆过滤器
+type bloomLayer struct {
+	capacity  int64
+	errorRate float64
+	hashes    uint64
+	bits      uint64
+	items     int64
+	data      []byte
+}
+
+// 调用方需要先通过 bloomLayerSize 校验参数
+func newBloomLayer(capacity int64, errorRate float64) *bloomLayer {
+	bits, hashes, _ := bloomLayerSize(capacity, errorRate)
+	return &bloomLayer{
+		capacity:  capacity,
+		errorRate: errorRate,
+		hashes:    hashes,
+		bits:      bits,
+		data:      make([]byte, (bits+7)/8),
+	}
+}
+
+// 单层过滤器的 bit 数以及哈希函数个数，超出上限时 ok 为 false
+func bloomLayerSize(capacity int64, errorRate float64) (bits, hashes uint64, ok bool) {
+	if capacity <= 0 || !(errorRate > 0 && errorRate < 1) {
+		return 0, 0, false
+	}
+	fbits := math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2))
+	fhashes := math.Ceil(-math.Log2(errorRate))
+	if !(fbits <= bloomMaxBits) || !(fhashes <= bloomMaxHashes) {
+		return 0, 0, false
+	}
+	return max(uint64(fbits), 1), max(uint64(fhashes), 1), true
+}
+
+// 双重哈希，第 i 个哈希函数的取值为 h1 + i*h2
+func bloomHash(item []byte) (uint64, uint64) {
+	h1 := murmurHash64A(item, bloomHashSeed)
+	return h1, murmurHash64A(item, h1)
+}
+
+func (l *bloomLayer) contains(h1, h2 uint64) bool {
+	for i := uint64(0); i < l.hashes; i++ {
+		pos := (h1 + i*h2) % l.bits
+		if l.data[pos>>3]&(1<<(pos&7)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *bloomLayer) add(h1, h2 uint64) {
+	for i := uint64(0); i < l.hashes; i++ {
+		pos := (h1 + i*h2) % l.bits
+		l.data[pos>>3] |= 1 << (pos & 7)
+	}
+	l.items++
+}
+
+// 可扩容的布隆过滤器，由容量逐层递增的过滤器构成，新元素总是写入最后一层
+type bloomChain struct {
+	key       string
+	expansion int64 // 为 0 时代表不可扩容
+	layers    []*bloomLayer
+}
+
+func newBloomFilter(key string, errorRate float64, capacity, expansion int64) BloomFilter {
+	return &bloomChain{
+		key:       key,
+		expansion: expansion,
+		layers:    []*bloomLayer{newBloomLayer(capacity, errorRate)},
+	}
+}
+
+// 返回元素是否为新增
+func (b *bloomChain) Add(item []byte) (bool, error) {
+	h1, h2 := bloomHash(item)
+	for _, layer := range b.layers {
+		if layer.contains(h1, h2) {
+			return false, nil
+		}
+	}
+
+	last := b.layers[len(b.layers)-1]
+	if last.items >= last.capacity {
+		if b.expansion == 0 {
+			return false, errBloomFull
+		}
+		// 扩容后需要能够被 loadBloomFilter 重新导入
+		if len(b.layers) >= bloomMaxLayers || last.capacity > math.MaxInt64/b.expansion {
+			return false, errBloomTooLarge
+		}
+		capacity, errorRate := last.capacity*b.expansion, last.errorRate*bloomTighteningRatio
+		bits, _, ok := bloomLayerSize(capacity, errorRate)
+		if !ok || bits > bloomMaxBits-b.bits() {
+			return false, errBloomTooLarge
+		}
+		last = newBloomLayer(capacity, errorRate)
+		b.layers = append(b.layers, last)
+	}
+	last.add(h1, h2)
+	return true, nil
+}
+
+// 所有层的 bit 数之和
+func (b *bloomChain) bits() uint64 {
+	var bits uint64
+	for _, layer := range b.layers {
+		bits += layer.bits
+	}
+	return bits
+}
+
+func (b *bloomChain) Exists(item []byte) bool {
+	h1, h2 := bloomHash(item)
+	for _, layer := range b.layers {
+		if layer.contains(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *bloomChain) Capacity() int64 {
+	var capacity int64
+	for _, layer := range b.layers {
+		capacity += layer.capacity
+	}
+	return capacity
+}
+
+// 位数组占用的字节数
+func (b *bloomChain) Size() int64 {
+	var size int64
+	for _, layer := range b.layers {
+		size += int64(len(layer.data))
+	}
+	return size
+}
+
+func (b *bloomChain) Filters() int64 {
+	return int64(len(b.layers))
+}
+
+func (b *bloomChain) Items() int64 {
+	var items int64
+	for _, layer := range b.layers {
+		items += layer.items
+	}
+	return items
+}
+
+func (b *bloomChain) Expansion() int64 {
+	return b.expansion
+}
+
+// iter 为 0 时返回头部，之后依次返回每一层的位数组. 返回的 iter 为 0 时代表结束
+func (b *bloomChain) ScanDump(iter int64) (int64, []byte) {
+	if iter == 0 {
+		return 1, b.header()
+	}
+	if iter > int64(len(b.layers)) {
+		return 0, nil
+	}
+	// reply 的序列化与 executor 不在同一个 goroutine 中，需要返回副本
+	return iter + 1, append([]byte(nil), b.layers[iter-1].data...)
+}
+
+// iter 与 ScanDump 返回的 iter 对应. 头部对应的 iter 为 1，由调用方负责创建
+func (b *bloomChain) LoadChunk(iter int64, chunk []byte) error {
+	if iter < 2 || iter-2 >= int64(len(b.layers)) {
+		return errBadChunk
+	}
+	layer := b.layers[iter-2]
+	if len(chunk) != len(layer.data) {
+		return errBadChunk
+	}
+	copy(layer.data, chunk)
+	return nil
+}
+
+// 【expansion】+【层数】+ 每一层的【capacity、errorRate、hashes、bits、items】，均为小端序
+func (b *bloomChain) header() []byte {
+	header := make([]byte, 0, 12+40*len(b.layers))
+	header = binary.LittleEndian.AppendUint64(header, uint64(b.expansion))
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(b.layers)))
+	for _, layer := range b.layers {
+		header = binary.LittleEndian.AppendUint64(header, uint64(layer.capacity))
+		header = binary.LittleEndian.AppendUint64(header, math.Float64bits(layer.errorRate))
+		header = binary.LittleEndian.AppendUint64(header, layer.hashes)
+		header = binary.LittleEndian.AppendUint64(header, layer.bits)
+		header = binary.LittleEndian.AppendUint64(header, uint64(layer.items))
+	}
+	return header
+}
+
+// 根据头部创建位数组为空的布隆过滤器. 完整校验头部后才分配位数组
+func loadBloomFilter(key string, header []byte) (BloomFilter, error) {
+	r := chunkReader(header)
+	b := bloomChain{key: key, expansion: int64(r.uint64())}
+	n := r.uint32()
+	if b.expansion < 0 || b.expansion > bloomMaxExpansion || n == 0 || n > bloomMaxLayers {
+		return nil, errBadChunk
+	}
+
+	var total uint64
+	for i := uint32(0); i < n && !r.broken(); i++ {
+		layer := bloomLayer{
+			capacity:  int64(r.uint64()),
+			errorRate: math.Float64frombits(r.uint64()),
+			hashes:    r.uint64(),
+			bits:      r.uint64(),
+			items:     int64(r.uint64()),
+		}
+		if layer.capacity <= 0 || !(layer.errorRate > 0 && layer.errorRate < 1) || layer.items < 0 || layer.items > layer.capacity ||
+			layer.hashes == 0 || layer.hashes > bloomMaxHashes || layer.bits == 0 || layer.bits > bloomMaxBits-total {
+			return nil, errBadChunk
+		}
+		total += layer.bits
+		b.layers = append(b.layers, &layer)
+	}
+	if r.broken() || len(r) != 0 {
+		return nil, errBadChunk
+	}
+
+	for _, layer := range b.layers {
+		layer.data = make([]byte, (layer.bits+7)/8)
+	}
+	return &b, nil
+}
+
+func (b *bloomChain) Encoding() string {
+	return "raw"
+}
+
+func (b *bloomChain) setKey(key string) {
+	b.key = key
+}
+
+// 以 bf.loadchunk 的形式导出头部以及每一层的位数组，而非重放写入的元素
+func (b *bloomChain) ToCmd() [][]byte {
+	return [][]byte{[]byte(database.CmdTypeBFLoadChunk), []byte(b.key), []byte("1"), b.header()}
+}
+
+func (b *bloomChain) ExtraCmds() [][][]byte {
+	cmds := make([][][]byte, 0, len(b.layers))
+	for i, layer := range b.layers {
+		cmds = append(cmds, [][]byte{[]byte(database.CmdTypeBFLoadChunk), []byte(b.key),
+			[]byte(strconv.Itoa(i + 2)), layer.data})
+	}
+	return cmds
+}
+
+// 顺序读取小端序整数，数据不足时读取结果为 0 且 broken 返回 true
+type chunkReader []byte
+
+func (r *chunkReader) uint64() uint64 {
+	if len(*r) < 8 {
+		*r = nil
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(*r)
+	*r = (*r)[8:]
+	return v
+}
+
+func (r *chunkReader) uint32() uint32 {
+	if len(*r) < 4 {
+		*r = nil
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(*r)
+	*r = (*r)[4:]
+	return v
+}
+
+func (r chunkReader) broken() bool {
+	return r == nil
+}
@@ -0,0 +1,263 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/AlphaMinZ/myredis_go/lib"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bloom_filter(t *testing.T) {
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	prefix := cast.ToString(rander.Int63())
+	bf := newBloomFilter("bf", 0.01, 100, 2)
+
+	t.Run("scaling", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			_, err := bf.Add([]byte(prefix + cast.ToString(i)))
+			assert.Nil(t, err)
+		}
+		// 100 + 200 + 400 + 800
+		assert.Equal(t, int64(4), bf.Filters())
+		assert.Equal(t, int64(1500), bf.Capacity())
+
+		// 不存在假阴性
+		for i := 0; i < 1000; i++ {
+			assert.True(t, bf.Exists([]byte(prefix+cast.ToString(i))))
+		}
+	})
+
+	t.Run("false positive", func(t *testing.T) {
+		var fp int
+		for i := 1000; i < 11000; i++ {
+			if bf.Exists([]byte(prefix + cast.ToString(i))) {
+				fp++
+			}
+		}
+		// 各层误判率之和不超过 0.02，此处放宽到 1.5 倍
+		assert.Less(t, fp, 300)
+	})
+
+	t.Run("nonscaling", func(t *testing.T) {
+		bf := newBloomFilter("bf", 0.01, 10, 0)
+		var err error
+		for i := 0; err == nil; i++ {
+			_, err = bf.Add([]byte(prefix + cast.ToString(i)))
+		}
+		assert.Equal(t, errBloomFull, err)
+		assert.Equal(t, int64(10), bf.Items())
+	})
+
+	t.Run("dump and load", func(t *testing.T) {
+		iter, header := bf.ScanDump(0)
+		loaded, err := loadBloomFilter("bf", header)
+		assert.Nil(t, err)
+		for {
+			var chunk []byte
+			if iter, chunk = bf.ScanDump(iter); iter == 0 {
+				break
+			}
+			assert.Nil(t, loaded.LoadChunk(iter, chunk))
+		}
+		assert.Equal(t, bf.ToCmd(), loaded.ToCmd())
+		assert.Equal(t, bf.ExtraCmds(), loaded.ExtraCmds())
+
+		_, err = loadBloomFilter("bf", header[:len(header)-1])
+		assert.Equal(t, errBadChunk, err)
+		assert.Equal(t, errBadChunk, loaded.LoadChunk(2, []byte("x")))
+	})
+
+	t.Run("load bad header", func(t *testing.T) {
+		type layer struct {
+			capacity  int64
+			errorRate float64
+			hashes    uint64
+			bits      uint64
+			items     int64
+		}
+		header := func(expansion uint64, n uint32, layers ...layer) []byte {
+			var b []byte
+			b = binary.LittleEndian.AppendUint64(b, expansion)
+			b = binary.LittleEndian.AppendUint32(b, n)
+			for _, l := range layers {
+				b = binary.LittleEndian.AppendUint64(b, uint64(l.capacity))
+				b = binary.LittleEndian.AppendUint64(b, math.Float64bits(l.errorRate))
+				b = binary.LittleEndian.AppendUint64(b, l.hashes)
+				b = binary.LittleEndian.AppendUint64(b, l.bits)
+				b = binary.LittleEndian.AppendUint64(b, uint64(l.items))
+			}
+			return b
+		}
+		good := layer{capacity: 100, errorRate: 0.01, hashes: 7, bits: 959}
+		_, err := loadBloomFilter("bf", header(2, 1, good))
+		assert.Nil(t, err)
+
+		with := func(f func(l *layer)) layer {
+			l := good
+			f(&l)
+			return l
+		}
+		for _, h := range [][]byte{
+			header(1<<63, 1, good),
+			header(bloomMaxExpansion+1, 1, good),
+			header(2, 0),
+			header(2, bloomMaxLayers+1, good),
+			header(2, math.MaxUint32, good),
+			header(2, 1, with(func(l *layer) { l.capacity = 0 })),
+			header(2, 1, with(func(l *layer) { l.capacity = -1 })),
+			header(2, 1, with(func(l *layer) { l.errorRate = 0 })),
+			header(2, 1, with(func(l *layer) { l.errorRate = 1 })),
+			header(2, 1, with(func(l *layer) { l.errorRate = math.NaN() })),
+			header(2, 1, with(func(l *layer) { l.items = -1 })),
+			header(2, 1, with(func(l *layer) { l.items = 101 })),
+			header(2, 1, with(func(l *layer) { l.hashes = 0 })),
+			header(2, 1, with(func(l *layer) { l.hashes = bloomMaxHashes + 1 })),
+			header(2, 1, with(func(l *layer) { l.bits = 0 })),
+			header(2, 1, with(func(l *layer) { l.bits = bloomMaxBits + 1 })),
+			// 各层位数组之和超出上限
+			header(2, 2, with(func(l *layer) { l.bits = bloomMaxBits }), good),
+			// 截断的头部
+			header(2, 2, good),
+			header(2, 1, good)[:30],
+			header(2, 1, good)[:8],
+			nil,
+			append(header(2, 1, good), 0),
+		} {
+			_, err := loadBloomFilter("bf", h)
+			assert.Equal(t, errBadChunk, err)
+		}
+	})
+
+	t.Run("expansion limit", func(t *testing.T) {
+		_, _, ok := bloomLayerSize(maxStringLen, 1e-300)
+		assert.False(t, ok)
+
+		// 每一层只能容纳一个元素
+		bf := newBloomFilter("bf", 0.001, 1, 1)
+		var err error
+		for i := 0; err == nil && i < 16*bloomMaxLayers; i++ {
+			_, err = bf.Add([]byte(prefix + cast.ToString(i)))
+		}
+		assert.Equal(t, errBloomTooLarge, err)
+		assert.Equal(t, int64(bloomMaxLayers), bf.Filters())
+		_, header := bf.ScanDump(0)
+		_, err = loadBloomFilter("bf", header)
+		assert.Nil(t, err)
+	})
+}
+
+func Test_cuckoo_filter(t *testing.T) {
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	prefix := cast.ToString(rander.Int63())
+	cf := newCuckooFilter("cf", 1000, 2, 20, 1)
+
+	t.Run("add and count", func(t *testing.T) {
+		for i := 0; i < 2000; i++ {
+			assert.Nil(t, cf.Add([]byte(prefix+cast.ToString(i))))
+		}
+		for i := 0; i < 2000; i++ {
+			assert.GreaterOrEqual(t, cf.Count([]byte(prefix+cast.ToString(i))), int64(1))
+		}
+
+		item := []byte(prefix + "dup")
+		before := cf.Count(item)
+		assert.Nil(t, cf.Add(item))
+		assert.Nil(t, cf.Add(item))
+		assert.Equal(t, before+2, cf.Count(item))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		item := []byte(prefix + "dup")
+		before := cf.Count(item)
+		assert.True(t, cf.Del(item))
+		assert.Equal(t, before-1, cf.Count(item))
+
+		for i := 0; i < 2000; i++ {
+			assert.True(t, cf.Del([]byte(prefix+cast.ToString(i))))
+		}
+	})
+
+	t.Run("full", func(t *testing.T) {
+		cf := newCuckooFilter("cf", 4, 2, 5, 0)
+		var err error
+		for i := 0; err == nil && i < 100; i++ {
+			err = cf.Add([]byte(prefix + cast.ToString(i)))
+		}
+		assert.Equal(t, errCuckooFull, err)
+	})
+
+	t.Run("dump and load", func(t *testing.T) {
+		iter, header := cf.ScanDump(0)
+		loaded, err := loadCuckooFilter("cf", header)
+		assert.Nil(t, err)
+		for {
+			var chunk []byte
+			if iter, chunk = cf.ScanDump(iter); iter == 0 {
+				break
+			}
+			assert.Nil(t, loaded.LoadChunk(iter, chunk))
+		}
+		assert.Equal(t, cf.ToCmd(), loaded.ToCmd())
+		assert.Equal(t, cf.ExtraCmds(), loaded.ExtraCmds())
+
+		assert.Equal(t, errBadChunk, loaded.LoadChunk(1, header))
+		assert.Equal(t, errBadChunk, loaded.LoadChunk(2, []byte("x")))
+		assert.Equal(t, errBadChunk, loaded.LoadChunk(int64(len(cf.ExtraCmds())+2), nil))
+	})
+
+	t.Run("load bad header", func(t *testing.T) {
+		header := func(bucketSize, maxIterations, expansion uint64, layers uint32, buckets ...uint64) []byte {
+			var b []byte
+			for _, v := range []uint64{bucketSize, maxIterations, expansion, 0, 0} {
+				b = binary.LittleEndian.AppendUint64(b, v)
+			}
+			b = binary.LittleEndian.AppendUint32(b, layers)
+			for _, v := range buckets {
+				b = binary.LittleEndian.AppendUint64(b, v)
+			}
+			return b
+		}
+		_, err := loadCuckooFilter("cf", header(2, 20, 1, 1, 1024))
+		assert.Nil(t, err)
+
+		for _, h := range [][]byte{
+			// 桶个数与桶大小的乘积溢出
+			header(255, 20, 1, 1, 1<<63),
+			header(2, 20, 1, 1, maxStringLen),
+			header(2, 20, 1, 1, 1000),
+			header(0, 20, 1, 1, 1024),
+			header(2, 0, 1, 1, 1024),
+			header(2, math.MaxUint16+1, 1, 1, 1024),
+			header(2, 1<<63, 1, 1, 1024),
+			header(2, 20, cuckooMaxExpansion+1, 1, 1024),
+			header(2, 20, 1, 0),
+			header(2, 20, 1, cuckooMaxLayers+1, 1024),
+			header(2, 20, 1, math.MaxUint32, 1024),
+			// 截断的头部
+			header(2, 20, 1, 2, 1024),
+			header(2, 20, 1, 1, 1024)[:44],
+			header(2, 20, 1, 1, 1024)[:20],
+			nil,
+			append(header(2, 20, 1, 1, 1024), 0),
+		} {
+			_, err := loadCuckooFilter("cf", h)
+			assert.Equal(t, errBadChunk, err)
+		}
+	})
+
+	t.Run("expansion limit", func(t *testing.T) {
+		cf := newCuckooFilter("cf", 2, 1, 1, 1)
+		var err error
+		for i := 0; err == nil && i < 4*cuckooMaxLayers; i++ {
+			err = cf.Add([]byte(prefix + cast.ToString(i)))
+		}
+		assert.Equal(t, errCuckooFull, err)
+		_, header := cf.ScanDump(0)
+		_, err = loadCuckooFilter("cf", header)
+		assert.Nil(t, err)
+	})
+}
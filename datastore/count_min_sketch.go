@@ -0,0 +1,188 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/AlphaMinZ/myredis_go/handler"
+)
+
+var (
+	errCMSNotFound = errors.New("CMS: key does not exist")
+	errCMSExists   = errors.New("CMS: key already exists")
+	errCMSOverflow = errors.New("CMS: INCRBY overflow")
+	errCMSBadData  = errors.New("CMS: received bad data")
+)
+
+func (k *KVStore) getAsCountMinSketch(key string) (CountMinSketch, error) {
+	v, ok := k.data[key]
+	if !ok {
+		return nil, nil
+	}
+
+	cms, ok := v.(CountMinSketch)
+	if !ok {
+		return nil, handler.NewWrongTypeErrReply()
+	}
+
+	return cms, nil
+}
+
+func (k *KVStore) putAsCountMinSketch(key string, cms CountMinSketch) {
+	k.putData(key, cms)
+}
+
+type CountMinSketch interface {
+	IncrBy(items [][]byte, increments []int64) ([]int64, error)
+	Query(item []byte) int64
+	Merge(sources []CountMinSketch, weights []int64) error
+	Width() int64
+	Depth() int64
+	Count() int64
+	Load(data []byte) error
+	Dump() []byte
+	database.MultiCmdAdapter
+}
+
+// depth 行 width 列的计数器矩阵. 每次写入在每一行各累加一个计数器，因此任意一行的和即为写入总数
+type countMinSketch struct {
+	key      string
+	width    int64
+	depth    int64
+	count    int64
+	counters []int64
+}
+
+func newCountMinSketch(key string, width, depth int64) CountMinSketch {
+	return &countMinSketch{
+		key:      key,
+		width:    width,
+		depth:    depth,
+		counters: make([]int64, width*depth),
+	}
+}
+
+func (c *countMinSketch) index(item []byte, row int64) int64 {
+	return row*c.width + int64(murmurHash64A(item, uint64(row))%uint64(c.width))
+}
+
+// 返回各个元素累加后的估计值. 任意计数器溢出时不做任何修改
+func (c *countMinSketch) IncrBy(items [][]byte, increments []int64) ([]int64, error) {
+	total := c.count
+	for _, incr := range increments {
+		if total > math.MaxInt64-incr {
+			return nil, errCMSOverflow
+		}
+		total += incr
+	}
+	// 单个计数器不会超过写入总数，总数不溢出时计数器也不会溢出
+
+	for i, item := range items {
+		for row := int64(0); row < c.depth; row++ {
+			c.counters[c.index(item, row)] += increments[i]
+		}
+	}
+	c.count = total
+
+	res := make([]int64, 0, len(items))
+	for _, item := range items {
+		res = append(res, c.Query(item))
+	}
+	return res, nil
+}
+
+// 各行对应计数器的最小值
+func (c *countMinSketch) Query(item []byte) int64 {
+	res := int64(math.MaxInt64)
+	for row := int64(0); row < c.depth; row++ {
+		res = min(res, c.counters[c.index(item, row)])
+	}
+	return res
+}
+
+// 以各个 sketch 加权求和的结果覆盖自身，sources 中可以包含自身. weights 均为非负数
+func (c *countMinSketch) Merge(sources []CountMinSketch, weights []int64) error {
+	var count int64
+	for i, source := range sources {
+		src, _ := source.(*countMinSketch)
+		if src == nil || src.width != c.width || src.depth != c.depth {
+			return errors.New("CMS: width/depth is not equal")
+		}
+		if weights[i] > 0 && src.count > (math.MaxInt64-count)/weights[i] {
+			return errCMSOverflow
+		}
+		count += src.count * weights[i]
+	}
+
+	counters := make([]int64, len(c.counters))
+	for i, source := range sources {
+		for j, v := range source.(*countMinSketch).counters {
+			counters[j] += v * weights[i]
+		}
+	}
+	c.counters, c.count = counters, count
+	return nil
+}
+
+func (c *countMinSketch) Width() int64 {
+	return c.width
+}
+
+func (c *countMinSketch) Depth() int64 {
+	return c.depth
+}
+
+func (c *countMinSketch) Count() int64 {
+	return c.count
+}
+
+// 以小端序导入全部计数器，写入总数取自第一行的和
+func (c *countMinSketch) Load(data []byte) error {
+	if len(data) != len(c.counters)*8 {
+		return errCMSBadData
+	}
+	counters := make([]int64, len(c.counters))
+	for i := range counters {
+		if counters[i] = int64(binary.LittleEndian.Uint64(data[i*8:])); counters[i] < 0 {
+			return errCMSBadData
+		}
+	}
+	var count int64
+	for _, v := range counters[:c.width] {
+		count += v
+	}
+	c.counters, c.count = counters, count
+	return nil
+}
+
+func (c *countMinSketch) Dump() []byte {
+	data := make([]byte, 0, len(c.counters)*8)
+	for _, v := range c.counters {
+		data = binary.LittleEndian.AppendUint64(data, uint64(v))
+	}
+	return data
+}
+
+func (c *countMinSketch) Encoding() string {
+	return "raw"
+}
+
+func (c *countMinSketch) setKey(key string) {
+	c.key = key
+}
+
+// 以 cms.initbydim 创建，再通过 cms.loadchunk 导入计数器矩阵
+func (c *countMinSketch) ToCmd() [][]byte {
+	return [][]byte{[]byte(database.CmdTypeCMSInitByDim), []byte(c.key),
+		[]byte(strconv.FormatInt(c.width, 10)), []byte(strconv.FormatInt(c.depth, 10))}
+}
+
+func (c *countMinSketch) ExtraCmds() [][][]byte {
+	if c.count == 0 {
+		return nil
+	}
+	return [][][]byte{{[]byte(database.CmdTypeCMSLoadChunk), []byte(c.key), c.Dump()}}
+}
@@ -0,0 +1,85 @@
+package datastore
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/AlphaMinZ/myredis_go/lib"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_count_min_sketch(t *testing.T) {
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	prefix := cast.ToString(rander.Int63())
+	cms := newCountMinSketch("cms", 2000, 5)
+
+	expect := make(map[string]int64)
+	t.Run("incrby", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			item := prefix + cast.ToString(rander.Intn(200))
+			incr := rander.Int63n(10)
+			expect[item] += incr
+			_, err := cms.IncrBy([][]byte{[]byte(item)}, []int64{incr})
+			assert.Nil(t, err)
+		}
+
+		var total int64
+		for item, cnt := range expect {
+			total += cnt
+			// 估计值不会偏小
+			assert.GreaterOrEqual(t, cms.Query([]byte(item)), cnt)
+		}
+		assert.Equal(t, total, cms.Count())
+
+		_, err := cms.IncrBy([][]byte{[]byte(prefix)}, []int64{1 << 62, 1 << 62})
+		assert.Equal(t, errCMSOverflow, err)
+		assert.Equal(t, total, cms.Count())
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		dst := newCountMinSketch("dst", 2000, 5)
+		assert.Nil(t, dst.Merge([]CountMinSketch{cms, cms}, []int64{1, 2}))
+		assert.Equal(t, 3*cms.Count(), dst.Count())
+		for item := range expect {
+			assert.Equal(t, 3*cms.Query([]byte(item)), dst.Query([]byte(item)))
+		}
+
+		assert.NotNil(t, dst.Merge([]CountMinSketch{newCountMinSketch("other", 10, 5)}, []int64{1}))
+	})
+
+	t.Run("load", func(t *testing.T) {
+		loaded := newCountMinSketch("cms", 2000, 5)
+		assert.Nil(t, loaded.Load(cms.ExtraCmds()[0][2]))
+		assert.Equal(t, cms.Count(), loaded.Count())
+		assert.Equal(t, cms.ExtraCmds(), loaded.ExtraCmds())
+
+		assert.Equal(t, errCMSBadData, loaded.Load([]byte("x")))
+	})
+}
+
+func Test_cms_merge_replay(t *testing.T) {
+	db := newTestDB(t)
+	for _, key := range []string{"c1", "c2", "cd"} {
+		assert.Equal(t, "+OK\r\n", db.do("cms.initbydim", key, "100", "4"))
+	}
+	assert.Equal(t, "*1\r\n:5\r\n", db.do("cms.incrby", "c1", "k", "5"))
+	assert.Equal(t, "*1\r\n:1\r\n", db.do("cms.incrby", "c2", "x", "1"))
+	db.expireSoon(t, "c1")
+
+	// 以 cms.loadchunk 的形式持久化 destination 的计数器
+	assert.Equal(t, "+OK\r\n", db.do("cms.merge", "cd", "1", "c1"))
+	assert.Equal(t, []byte(database.CmdTypeCMSLoadChunk), db.persister.cmds[len(db.persister.cmds)-1][0])
+	waitExpired()
+
+	replayed := db.replay(t)
+	assert.Equal(t, ":0\r\n", replayed.do("exists", "c1"))
+	assert.Equal(t, "*1\r\n:5\r\n", replayed.do("cms.query", "cd", "k"))
+
+	// 源 key 均为空时 destination 被清零
+	assert.Equal(t, "+OK\r\n", db.do("cms.initbydim", "empty", "100", "4"))
+	assert.Equal(t, "+OK\r\n", db.do("cms.merge", "c2", "1", "empty"))
+	replayed = db.replay(t)
+	assert.Equal(t, "*1\r\n:0\r\n", replayed.do("cms.query", "c2", "x"))
+}
@@ -0,0 +1,315 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+	"strconv"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/AlphaMinZ/myredis_go/handler"
+)
+
+// 与 redisbloom 保持一致的默认参数. 指纹长度为 8 bit，取值 0 代表空位
+const (
+	cuckooDefaultCapacity      = 1024
+	cuckooDefaultBucketSize    = 2
+	cuckooDefaultMaxIterations = 20
+	cuckooDefaultExpansion     = 1
+	cuckooMaxBucketSize        = 255
+	cuckooMaxExpansion         = 32768
+	cuckooMaxLayers            = 1024
+)
+
+var errCuckooFull = errors.New("ERR Filter is full")
+
+func (k *KVStore) getAsCuckooFilter(key string) (CuckooFilter, error) {
+	v, ok := k.data[key]
+	if !ok {
+		return nil, nil
+	}
+
+	cf, ok := v.(CuckooFilter)
+	if !ok {
+		return nil, handler.NewWrongTypeErrReply()
+	}
+
+	return cf, nil
+}
+
+func (k *KVStore) putAsCuckooFilter(key string, cf CuckooFilter) {
+	k.putData(key, cf)
+}
+
+type CuckooFilter interface {
+	Add(item []byte) error
+	Del(item []byte) bool
+	Count(item []byte) int64
+	ScanDump(iter int64) (int64, []byte)
+	LoadChunk(iter int64, chunk []byte) error
+	database.MultiCmdAdapter
+}
+
+// 单层布谷鸟过滤器，桶的个数为 2 的幂，使得两个候选桶可以通过指纹互相推算
+type cuckooLayer struct {
+	buckets uint64
+	data    []uint8
+}
+
+func cuckooHash(item []byte) (fp uint8, h uint64) {
+	h = murmurHash64A(item, 0)
+	return uint8(h%255 + 1), h
+}
+
+func cuckooAltIndex(fp uint8, index uint64) uint64 {
+	return index ^ uint64(fp)*0x5bd1e995
+}
+
+// 可扩容的布谷鸟过滤器. 插入失败时追加容量为上一层 expansion 倍的新层
+type cuckooFilter struct {
+	key           string
+	bucketSize    uint64
+	maxIterations int64
+	expansion     int64 // 为 0 时代表不可扩容
+	items         int64
+	deletes       int64
+	layers        []*cuckooLayer
+}
+
+func newCuckooFilter(key string, capacity int64, bucketSize uint64, maxIterations, expansion int64) CuckooFilter {
+	buckets := (uint64(capacity) + bucketSize - 1) / bucketSize
+	c := cuckooFilter{
+		key:           key,
+		bucketSize:    bucketSize,
+		maxIterations: maxIterations,
+		expansion:     expansion,
+	}
+	c.layers = []*cuckooLayer{c.newLayer(nextPowerOfTwo(buckets))}
+	return &c
+}
+
+func nextPowerOfTwo(n uint64) uint64 {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << bits.Len64(n-1)
+}
+
+func (c *cuckooFilter) newLayer(buckets uint64) *cuckooLayer {
+	return &cuckooLayer{buckets: buckets, data: make([]uint8, buckets*c.bucketSize)}
+}
+
+// 允许重复写入相同的元素
+func (c *cuckooFilter) Add(item []byte) error {
+	fp, h := cuckooHash(item)
+	for _, layer := range c.layers {
+		if c.insert(layer, layer.bucket(h), fp) || c.insert(layer, layer.bucket(cuckooAltIndex(fp, h)), fp) {
+			c.items++
+			return nil
+		}
+	}
+
+	if c.kickOut(c.layers[len(c.layers)-1], h, fp) {
+		c.items++
+		return nil
+	}
+
+	// 扩容后需要能够被 loadCuckooFilter 重新导入
+	last := c.layers[len(c.layers)-1]
+	buckets := last.buckets * nextPowerOfTwo(uint64(c.expansion))
+	if c.expansion == 0 || len(c.layers) >= cuckooMaxLayers || buckets > maxStringLen/c.bucketSize {
+		return errCuckooFull
+	}
+	layer := c.newLayer(buckets)
+	c.layers = append(c.layers, layer)
+	c.insert(layer, layer.bucket(h), fp)
+	c.items++
+	return nil
+}
+
+func (l *cuckooLayer) bucket(h uint64) uint64 {
+	return h & (l.buckets - 1)
+}
+
+func (c *cuckooFilter) insert(layer *cuckooLayer, bucket uint64, fp uint8) bool {
+	slots := layer.data[bucket*c.bucketSize : (bucket+1)*c.bucketSize]
+	for i, v := range slots {
+		if v == 0 {
+			slots[i] = fp
+			return true
+		}
+	}
+	return false
+}
+
+// 依次踢出候选桶中的指纹并为其寻找新的位置. 为保证重放结果一致，被踢出的槽位按照轮次确定.
+// 超过 maxIterations 次仍未成功时撤销全部交换
+func (c *cuckooFilter) kickOut(layer *cuckooLayer, h uint64, fp uint8) bool {
+	type swap struct {
+		pos uint64
+		old uint8
+	}
+
+	var swaps []swap
+	bucket := layer.bucket(h)
+	for i := int64(0); i < c.maxIterations; i++ {
+		pos := bucket*c.bucketSize + uint64(i)%c.bucketSize
+		swaps = append(swaps, swap{pos: pos, old: layer.data[pos]})
+		fp, layer.data[pos] = layer.data[pos], fp
+
+		bucket = layer.bucket(cuckooAltIndex(fp, bucket))
+		if c.insert(layer, bucket, fp) {
+			return true
+		}
+	}
+
+	for i := len(swaps) - 1; i >= 0; i-- {
+		layer.data[swaps[i].pos] = swaps[i].old
+	}
+	return false
+}
+
+// 从最新的一层开始查找并删除一个指纹
+func (c *cuckooFilter) Del(item []byte) bool {
+	fp, h := cuckooHash(item)
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		layer := c.layers[i]
+		if c.remove(layer, layer.bucket(h), fp) || c.remove(layer, layer.bucket(cuckooAltIndex(fp, h)), fp) {
+			c.items--
+			c.deletes++
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cuckooFilter) remove(layer *cuckooLayer, bucket uint64, fp uint8) bool {
+	slots := layer.data[bucket*c.bucketSize : (bucket+1)*c.bucketSize]
+	for i, v := range slots {
+		if v == fp {
+			slots[i] = 0
+			return true
+		}
+	}
+	return false
+}
+
+// 元素可能出现的次数，存在指纹冲突时会偏大
+func (c *cuckooFilter) Count(item []byte) int64 {
+	fp, h := cuckooHash(item)
+	var cnt int64
+	for _, layer := range c.layers {
+		b1, b2 := layer.bucket(h), layer.bucket(cuckooAltIndex(fp, h))
+		cnt += c.countIn(layer, b1, fp)
+		if b2 != b1 {
+			cnt += c.countIn(layer, b2, fp)
+		}
+	}
+	return cnt
+}
+
+func (c *cuckooFilter) countIn(layer *cuckooLayer, bucket uint64, fp uint8) int64 {
+	var cnt int64
+	for _, v := range layer.data[bucket*c.bucketSize : (bucket+1)*c.bucketSize] {
+		if v == fp {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// iter 为 0 时返回头部，之后依次返回每一层的桶数组. 返回的 iter 为 0 时代表结束
+func (c *cuckooFilter) ScanDump(iter int64) (int64, []byte) {
+	if iter == 0 {
+		return 1, c.header()
+	}
+	if iter > int64(len(c.layers)) {
+		return 0, nil
+	}
+	// reply 的序列化与 executor 不在同一个 goroutine 中，需要返回副本
+	return iter + 1, append([]byte(nil), c.layers[iter-1].data...)
+}
+
+// iter 与 ScanDump 返回的 iter 对应. 头部对应的 iter 为 1，由调用方负责创建
+func (c *cuckooFilter) LoadChunk(iter int64, chunk []byte) error {
+	if iter < 2 || iter-2 >= int64(len(c.layers)) {
+		return errBadChunk
+	}
+	layer := c.layers[iter-2]
+	if len(chunk) != len(layer.data) {
+		return errBadChunk
+	}
+	copy(layer.data, chunk)
+	return nil
+}
+
+// 【bucketSize、maxIterations、expansion、items、deletes】+【层数】+ 每一层的【桶个数】，均为小端序
+func (c *cuckooFilter) header() []byte {
+	header := make([]byte, 0, 44+8*len(c.layers))
+	header = binary.LittleEndian.AppendUint64(header, c.bucketSize)
+	header = binary.LittleEndian.AppendUint64(header, uint64(c.maxIterations))
+	header = binary.LittleEndian.AppendUint64(header, uint64(c.expansion))
+	header = binary.LittleEndian.AppendUint64(header, uint64(c.items))
+	header = binary.LittleEndian.AppendUint64(header, uint64(c.deletes))
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(c.layers)))
+	for _, layer := range c.layers {
+		header = binary.LittleEndian.AppendUint64(header, layer.buckets)
+	}
+	return header
+}
+
+// 根据头部创建桶数组为空的布谷鸟过滤器
+func loadCuckooFilter(key string, header []byte) (CuckooFilter, error) {
+	r := chunkReader(header)
+	c := cuckooFilter{
+		key:           key,
+		bucketSize:    r.uint64(),
+		maxIterations: int64(r.uint64()),
+		expansion:     int64(r.uint64()),
+		items:         int64(r.uint64()),
+		deletes:       int64(r.uint64()),
+	}
+	if c.bucketSize == 0 || c.bucketSize > cuckooMaxBucketSize || c.maxIterations < 1 || c.maxIterations > math.MaxUint16 ||
+		c.expansion < 0 || c.expansion > cuckooMaxExpansion || c.items < 0 || c.deletes < 0 {
+		return nil, errBadChunk
+	}
+	n := r.uint32()
+	if n > cuckooMaxLayers {
+		return nil, errBadChunk
+	}
+	for i := uint32(0); i < n && !r.broken(); i++ {
+		// 先做除法，避免乘法溢出
+		buckets := r.uint64()
+		if buckets == 0 || buckets&(buckets-1) != 0 || buckets > maxStringLen/c.bucketSize {
+			return nil, errBadChunk
+		}
+		c.layers = append(c.layers, c.newLayer(buckets))
+	}
+	if r.broken() || len(r) != 0 || len(c.layers) == 0 {
+		return nil, errBadChunk
+	}
+	return &c, nil
+}
+
+func (c *cuckooFilter) Encoding() string {
+	return "raw"
+}
+
+func (c *cuckooFilter) setKey(key string) {
+	c.key = key
+}
+
+// 以 cf.loadchunk 的形式导出头部以及每一层的桶数组，而非重放写入的元素
+func (c *cuckooFilter) ToCmd() [][]byte {
+	return [][]byte{[]byte(database.CmdTypeCFLoadChunk), []byte(c.key), []byte("1"), c.header()}
+}
+
+func (c *cuckooFilter) ExtraCmds() [][][]byte {
+	cmds := make([][][]byte, 0, len(c.layers))
+	for i, layer := range c.layers {
+		cmds = append(cmds, [][]byte{[]byte(database.CmdTypeCFLoadChunk), []byte(c.key),
+			[]byte(strconv.Itoa(i + 2)), layer.data})
+	}
+	return cmds
+}
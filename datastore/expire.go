@@ -1,42 +1,201 @@
 package datastore
 
 import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/AlphaMinZ/myredis_go/database"
 	"github.com/AlphaMinZ/myredis_go/lib"
 )
 
 func (k *KVStore) GC() {
-	// 找出当前所有已过期的 key，批量回收
-	nowUnix := lib.TimeNow().Unix()
-	for _, expiredKey := range k.expireTimeWheel.Range(0, nowUnix) {
-		k.expireProcess(expiredKey)
+	if k.loading {
+		return
+	}
+
+	// 找出当前所有已过期的 key，批量回收. 时间轮中以毫秒时间戳作为 score
+	nowUnixMilli := lib.TimeNow().UnixMilli()
+	for _, expiredKey := range k.expireTimeWheel.Range(scoreRange{max: float64(nowUnixMilli)}, 0, -1, false) {
+		k.expireKey(expiredKey)
+	}
+
+	// 回收 hash 中已过期的 field
+	now := lib.TimeNow()
+	for key := range k.volatileHashes {
+		k.expireFields(key, now)
 	}
 }
 
 func (k *KVStore) ExpirePreprocess(key string) {
-	expiredAt, ok := k.expiredAt[key]
-	if !ok {
+	if k.loading {
 		return
 	}
 
-	if expiredAt.After(lib.TimeNow()) {
+	if expiredAt, ok := k.expiredAt[key]; ok && !expiredAt.After(lib.TimeNow()) {
+		k.expireKey(key)
 		return
 	}
 
+	// 懒加载回收 hash 中已过期的 field
+	if _, ok := k.volatileHashes[key]; ok {
+		k.expireFields(key, lib.TimeNow())
+	}
+}
+
+// 重放 aof 时，pexpireat 指令执行的时刻晚于其写入 aof 的时刻. 如果在重放期间回收过期的 key，
+// 之后的指令，如 persist，读取到的数据会与其写入 aof 时不一致. 因此重放期间只记录过期时间，
+// 过期回收时以 del 的形式写入 aof，重放时由 del 指令完成删除
+func (k *KVStore) SetLoading(loading bool) {
+	k.loading = loading
+}
+
+// 回收过期的 key，并以 del 的形式持久化
+func (k *KVStore) expireKey(key string) {
 	k.expireProcess(key)
+	k.persister.PersistCmd(context.Background(), [][]byte{[]byte(database.CmdTypeDel), []byte(key)}) // 持久化
 }
 
 func (k *KVStore) expireProcess(key string) {
+	if _, ok := k.data[key]; ok {
+		k.keys.rem(key)
+	}
 	delete(k.expiredAt, key)
 	delete(k.data, key)
+	delete(k.volatileHashes, key)
 	k.expireTimeWheel.Rem(key)
 }
 
+// 回收 hash 中截止到 now 已过期的 field，并以 hdel 的形式持久化. field 全部过期时同时删除 key
+func (k *KVStore) expireFields(key string, now time.Time) {
+	hmap, ok := k.data[key].(HashMap)
+	if !ok {
+		delete(k.volatileHashes, key)
+		return
+	}
+
+	if fields := hmap.ExpireFields(now); len(fields) > 0 {
+		delCmd := [][]byte{[]byte(database.CmdTypeHDel), []byte(key)}
+		for _, field := range fields {
+			delCmd = append(delCmd, []byte(field))
+		}
+		k.persister.PersistCmd(context.Background(), delCmd) // 持久化
+	}
+	k.trackVolatileHash(key, hmap)
+	k.delIfEmptyHashMap(key, hmap)
+}
+
+// 根据 hash 中是否存在设置了过期时间的 field，更新主动回收的范围
+func (k *KVStore) trackVolatileHash(key string, hmap HashMap) {
+	if hmap.Volatile() {
+		k.volatileHashes[key] = struct{}{}
+		return
+	}
+	delete(k.volatileHashes, key)
+}
+
 func (k *KVStore) expire(key string, expiredAt time.Time) {
 	if _, ok := k.data[key]; !ok {
 		return
 	}
 	k.expiredAt[key] = expiredAt
-	k.expireTimeWheel.Add(expiredAt.Unix(), key)
+	k.expireTimeWheel.Add(float64(expiredAt.UnixMilli()), key)
+}
+
+// 移除 key 的过期时间，返回 key 之前是否设置了过期时间
+func (k *KVStore) persist(key string) bool {
+	if _, ok := k.expiredAt[key]; !ok {
+		return false
+	}
+	delete(k.expiredAt, key)
+	k.expireTimeWheel.Rem(key)
+	return true
+}
+
+// 过期时间统一以毫秒时间戳的形式持久化
+func pexpireAtCmd(key string, expiredAt time.Time) [][]byte {
+	return [][]byte{[]byte(database.CmdTypePExpireAt), []byte(key), []byte(strconv.FormatInt(expiredAt.UnixMilli(), 10))}
+}
+
+// 解析 EX | PX | EXAT | PXAT 选项，统一转换为绝对过期时间
+func parseExpireOption(option string, value []byte) (time.Time, error) {
+	n, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return time.Time{}, errNotInteger
+	}
+	if n <= 0 {
+		return time.Time{}, errors.New("ERR invalid expire time")
+	}
+
+	switch option {
+	case "ex":
+		if n > math.MaxInt64/int64(time.Second) {
+			return time.Time{}, errors.New("ERR invalid expire time")
+		}
+		return lib.TimeNow().Add(time.Duration(n) * time.Second), nil
+	case "px":
+		if n > math.MaxInt64/int64(time.Millisecond) {
+			return time.Time{}, errors.New("ERR invalid expire time")
+		}
+		return lib.TimeNow().Add(time.Duration(n) * time.Millisecond), nil
+	case "exat":
+		if n > math.MaxInt64/1000 {
+			return time.Time{}, errors.New("ERR invalid expire time")
+		}
+		return time.UnixMilli(n * 1000), nil
+	case "pxat":
+		return time.UnixMilli(n), nil
+	default:
+		return time.Time{}, errors.New("ERR syntax error")
+	}
+}
+
+// expire 系列指令的 NX | XX | GT | LT 选项
+type expireStrategy struct {
+	nx, xx, gt, lt bool
+}
+
+func parseExpireStrategy(flags [][]byte) (*expireStrategy, error) {
+	var strategy expireStrategy
+	for _, flag := range flags {
+		switch strings.ToLower(string(flag)) {
+		case "nx":
+			strategy.nx = true
+		case "xx":
+			strategy.xx = true
+		case "gt":
+			strategy.gt = true
+		case "lt":
+			strategy.lt = true
+		default:
+			return nil, errors.New("ERR Unsupported option " + string(flag))
+		}
+	}
+
+	if strategy.nx && (strategy.xx || strategy.gt || strategy.lt) {
+		return nil, errors.New("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if strategy.gt && strategy.lt {
+		return nil, errors.New("ERR GT and LT options at the same time are not compatible")
+	}
+	return &strategy, nil
+}
+
+// 判断能否将过期时间由 current 更新为 next. 未设置过期时间的 key 视为永不过期
+func (e *expireStrategy) allow(current time.Time, volatile bool, next time.Time) bool {
+	switch {
+	case e.nx:
+		return !volatile
+	case e.xx && !volatile:
+		return false
+	case e.gt:
+		return volatile && next.After(current)
+	case e.lt:
+		return !volatile || next.Before(current)
+	default:
+		return true
+	}
 }
@@ -0,0 +1,118 @@
+package datastore
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/AlphaMinZ/myredis_go/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_expire_persist_format(t *testing.T) {
+	db := newTestDB(t)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		assert.Equal(t, "+OK\r\n", db.do("set", key, "v"))
+	}
+
+	// 各类设置过期时间的指令统一以毫秒时间戳的 pexpireat 持久化
+	unixMilli := lib.TimeNow().Add(time.Hour).UnixMilli()
+	assert.Equal(t, ":1\r\n", db.do("expire", "a", "3600"))
+	assert.Equal(t, ":1\r\n", db.do("pexpire", "b", "3600000"))
+	assert.Equal(t, ":1\r\n", db.do("expireat", "c", strconv.FormatInt(unixMilli/1000, 10)))
+	assert.Equal(t, ":1\r\n", db.do("pexpireat", "d", strconv.FormatInt(unixMilli, 10)))
+	for _, cmd := range db.persister.cmds[4:] {
+		assert.Equal(t, 3, len(cmd))
+		assert.Equal(t, database.CmdTypePExpireAt, database.CmdType(cmd[0]))
+		assert.Equal(t, db.do("pexpiretime", string(cmd[1])), ":"+string(cmd[2])+"\r\n")
+	}
+	assert.Equal(t, ":"+strconv.FormatInt(unixMilli, 10)+"\r\n", db.do("pexpiretime", "d"))
+	assert.Equal(t, ":"+strconv.FormatInt(unixMilli/1000*1000, 10)+"\r\n", db.do("pexpiretime", "c"))
+
+	// 兼容旧版本 aof 文件中的本地时间格式
+	expiredAt := lib.TimeNow().Add(time.Hour).Truncate(time.Second)
+	assert.Equal(t, ":1\r\n", db.do("expireat", "a", lib.TimeSecondFormat(expiredAt)))
+	assert.Equal(t, ":"+strconv.FormatInt(expiredAt.Unix(), 10)+"\r\n", db.do("expiretime", "a"))
+
+	// 过期时间早于当前时间时直接删除 key
+	assert.Equal(t, ":1\r\n", db.do("pexpireat", "b", "1"))
+	assert.Equal(t, ":0\r\n", db.do("exists", "b"))
+	assert.Equal(t, []byte(database.CmdTypeDel), db.persister.cmds[len(db.persister.cmds)-1][0])
+
+	replayed := db.replay(t)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		assert.Equal(t, db.do("pexpiretime", key), replayed.do("pexpiretime", key))
+	}
+}
+
+func Test_expire_strategy(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, "+OK\r\n", db.do("set", "k", "v"))
+
+	// 未设置过期时间的 key 视为永不过期
+	assert.Equal(t, ":0\r\n", db.do("expire", "k", "100", "XX"))
+	assert.Equal(t, ":0\r\n", db.do("expire", "k", "100", "GT"))
+	assert.Equal(t, ":1\r\n", db.do("expire", "k", "100", "NX"))
+	assert.Equal(t, ":0\r\n", db.do("expire", "k", "200", "NX"))
+	assert.Equal(t, ":100\r\n", db.do("ttl", "k"))
+
+	assert.Equal(t, ":0\r\n", db.do("expire", "k", "50", "GT"))
+	assert.Equal(t, ":1\r\n", db.do("expire", "k", "200", "GT"))
+	assert.Equal(t, ":0\r\n", db.do("expire", "k", "300", "LT"))
+	assert.Equal(t, ":1\r\n", db.do("expire", "k", "150", "XX", "LT"))
+	assert.Equal(t, ":150\r\n", db.do("ttl", "k"))
+
+	assert.Equal(t, ":1\r\n", db.do("persist", "k"))
+	assert.Equal(t, ":0\r\n", db.do("persist", "k"))
+	assert.Equal(t, ":1\r\n", db.do("pexpire", "k", "100000", "LT"))
+	assert.Equal(t, ":100\r\n", db.do("ttl", "k"))
+
+	assert.Equal(t, ":0\r\n", db.do("expire", "none", "100"))
+	assert.Equal(t, ":-2\r\n", db.do("ttl", "none"))
+	assert.Equal(t, "-ERR NX and XX, GT or LT options at the same time are not compatible\r\n", db.do("expire", "k", "100", "NX", "GT"))
+	assert.Equal(t, "-ERR GT and LT options at the same time are not compatible\r\n", db.do("expire", "k", "100", "GT", "LT"))
+	assert.Equal(t, "-ERR Unsupported option FOO\r\n", db.do("expire", "k", "100", "FOO"))
+}
+
+func Test_expire_replay(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, ":1\r\n", db.do("sadd", "persisted", "a"))
+	assert.Equal(t, ":1\r\n", db.do("sadd", "expired", "a"))
+	assert.Equal(t, ":2\r\n", db.do("hset", "h", "f1", "v1", "f2", "v2"))
+	db.expireSoon(t, "persisted", "expired")
+	assert.Equal(t, "*1\r\n:1\r\n", db.do("hpexpire", "h", "20", "FIELDS", "1", "f1"))
+
+	// 重放时过期时间已经过去，之后的指令仍然需要读取到 key 和 field
+	assert.Equal(t, ":1\r\n", db.do("persist", "persisted"))
+	assert.Equal(t, ":1\r\n", db.do("sadd", "persisted", "b"))
+	assert.Equal(t, ":1\r\n", db.do("sadd", "expired", "b"))
+	assert.Equal(t, "*1\r\n:1\r\n", db.do("hpersist", "h", "FIELDS", "1", "f1"))
+	waitExpired()
+
+	// 过期回收以 del 的形式持久化
+	assert.Equal(t, ":0\r\n", db.do("exists", "expired"))
+	assert.Equal(t, [][]byte{[]byte(database.CmdTypeDel), []byte("expired")}, db.persister.cmds[len(db.persister.cmds)-1])
+
+	replayed := db.replay(t)
+	assert.Equal(t, ":2\r\n", replayed.do("scard", "persisted"))
+	assert.Equal(t, ":-1\r\n", replayed.do("ttl", "persisted"))
+	assert.Equal(t, ":0\r\n", replayed.do("exists", "expired"))
+	assert.Equal(t, "*2\r\n$2\r\nv1\r\n$2\r\nv2\r\n", replayed.do("hmget", "h", "f1", "f2"))
+	assert.Equal(t, ":2\r\n", replayed.do("hlen", "h"))
+	assert.Equal(t, "*1\r\n:-1\r\n", replayed.do("httl", "h", "FIELDS", "1", "f1"))
+}
+
+func Test_expire_fields_persist_hdel(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, ":2\r\n", db.do("hset", "h", "f1", "v1", "f2", "v2"))
+	assert.Equal(t, "*1\r\n:1\r\n", db.do("hpexpire", "h", "20", "FIELDS", "1", "f1"))
+	waitExpired()
+
+	assert.Equal(t, ":1\r\n", db.do("hlen", "h"))
+	assert.Equal(t, [][]byte{[]byte(database.CmdTypeHDel), []byte("h"), []byte("f1")}, db.persister.cmds[len(db.persister.cmds)-1])
+
+	replayed := db.replay(t)
+	assert.Equal(t, ":1\r\n", replayed.do("hlen", "h"))
+	assert.Equal(t, "$-1\r\n", replayed.do("hget", "h", "f1"))
+}
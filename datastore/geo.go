@@ -0,0 +1,481 @@
+package datastore
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AlphaMinZ/myredis_go/handler"
+)
+
+// 经纬度以 52 位的 geohash 整数作为分值存储在有序集合中，与 redis 保持一致.
+// 纬度位于偶数位，经度位于奇数位. 纬度的取值范围受限于 web 墨卡托投影
+const (
+	geoStep      = 26
+	geoLonMin    = -180.0
+	geoLonMax    = 180.0
+	geoLatMin    = -85.05112878
+	geoLatMax    = 85.05112878
+	earthRadius  = 6372797.560856
+	mercatorMax  = 20037726.37
+	geoAlphabet  = "0123456789bcdefghjkmnpqrstuvwxyz"
+	geoHashChars = 11
+)
+
+var errGeoUnit = errors.New("ERR unsupported unit provided. please use M, KM, FT, MI")
+
+type geoPoint struct {
+	lon, lat float64
+}
+
+func parseGeoPoint(lonArg, latArg []byte) (geoPoint, error) {
+	lon, err := strconv.ParseFloat(string(lonArg), 64)
+	if err != nil {
+		return geoPoint{}, errNotFloat
+	}
+	lat, err := strconv.ParseFloat(string(latArg), 64)
+	if err != nil {
+		return geoPoint{}, errNotFloat
+	}
+	if lon < geoLonMin || lon > geoLonMax || lat < geoLatMin || lat > geoLatMax {
+		return geoPoint{}, errors.New("ERR invalid longitude,latitude pair " +
+			strconv.FormatFloat(lon, 'f', 6, 64) + "," + strconv.FormatFloat(lat, 'f', 6, 64))
+	}
+	return geoPoint{lon: lon, lat: lat}, nil
+}
+
+// 距离单位换算为米的系数
+func parseGeoUnit(b []byte) (float64, error) {
+	switch strings.ToLower(string(b)) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, errGeoUnit
+}
+
+func formatGeoDist(meters, unit float64) []byte {
+	return []byte(strconv.FormatFloat(meters/unit, 'f', 4, 64))
+}
+
+// 将经纬度编码为 2*step 位的 geohash
+func geoEncode(p geoPoint, step uint) uint64 {
+	return geoEncodeRange(p, step, geoLatMin, geoLatMax)
+}
+
+func geoEncodeRange(p geoPoint, step uint, latMin, latMax float64) uint64 {
+	latOffset := (p.lat - latMin) / (latMax - latMin)
+	lonOffset := (p.lon - geoLonMin) / (geoLonMax - geoLonMin)
+	cells := float64(uint64(1) << step)
+	lat, lon := uint64(latOffset*cells), uint64(lonOffset*cells)
+	// 取值恰好位于上界时归入最后一个格子
+	if lat >= 1<<step {
+		lat = 1<<step - 1
+	}
+	if lon >= 1<<step {
+		lon = 1<<step - 1
+	}
+	return interleave(lat, lon)
+}
+
+// geohash 对应的经纬度区域
+type geoArea struct {
+	lonMin, lonMax, latMin, latMax float64
+}
+
+func geoDecode(hash uint64, step uint) geoArea {
+	lat, lon := deinterleave(hash)
+	latScale, lonScale := geoLatMax-geoLatMin, geoLonMax-geoLonMin
+	cells := float64(uint64(1) << step)
+	return geoArea{
+		latMin: geoLatMin + float64(lat)/cells*latScale,
+		latMax: geoLatMin + float64(lat+1)/cells*latScale,
+		lonMin: geoLonMin + float64(lon)/cells*lonScale,
+		lonMax: geoLonMin + float64(lon+1)/cells*lonScale,
+	}
+}
+
+// 取区域的中心点作为解码结果
+func geoDecodePoint(hash uint64) geoPoint {
+	area := geoDecode(hash, geoStep)
+	return geoPoint{
+		lon: math.Max(geoLonMin, math.Min(geoLonMax, (area.lonMin+area.lonMax)/2)),
+		lat: math.Max(geoLatMin, math.Min(geoLatMax, (area.latMin+area.latMax)/2)),
+	}
+}
+
+// 标准的 11 位 base32 geohash 字符串，纬度范围为 [-90,90]
+func geoHashString(score float64) []byte {
+	p := geoDecodePoint(uint64(score))
+	hash := geoEncodeRange(p, geoStep, -90, 90)
+	res := make([]byte, geoHashChars)
+	for i := 0; i < geoHashChars; i++ {
+		var idx uint64
+		// 52 位不足以填满 11 个字符，最后一位补 0
+		if i < geoHashChars-1 {
+			idx = hash >> (52 - (i+1)*5) & 0x1f
+		}
+		res[i] = geoAlphabet[idx]
+	}
+	return res
+}
+
+// x 占据偶数位，y 占据奇数位
+func interleave(x, y uint64) uint64 {
+	return spread(x) | spread(y)<<1
+}
+
+func deinterleave(hash uint64) (x, y uint64) {
+	return squash(hash), squash(hash >> 1)
+}
+
+func spread(v uint64) uint64 {
+	v &= 0xffffffff
+	v = (v | v<<16) & 0x0000ffff0000ffff
+	v = (v | v<<8) & 0x00ff00ff00ff00ff
+	v = (v | v<<4) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v<<2) & 0x3333333333333333
+	v = (v | v<<1) & 0x5555555555555555
+	return v
+}
+
+func squash(v uint64) uint64 {
+	v &= 0x5555555555555555
+	v = (v | v>>1) & 0x3333333333333333
+	v = (v | v>>2) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v>>4) & 0x00ff00ff00ff00ff
+	v = (v | v>>8) & 0x0000ffff0000ffff
+	v = (v | v>>16) & 0x00000000ffffffff
+	return v
+}
+
+func degRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// haversine 公式计算球面距离，单位为米
+func geoDistance(a, b geoPoint) float64 {
+	lat1, lat2 := degRad(a.lat), degRad(b.lat)
+	u := math.Sin((lat2 - lat1) / 2)
+	v := math.Sin(degRad(b.lon-a.lon) / 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1)*math.Cos(lat2)*v*v))
+}
+
+// 搜索范围，距离均以米为单位. unit 为返回距离时采用的单位
+type geoShape struct {
+	center        geoPoint
+	box           bool
+	radius        float64
+	width, height float64
+	unit          float64
+}
+
+// 返回 p 到中心点的距离，p 不在范围内时 ok 为 false
+func (s *geoShape) contains(p geoPoint) (dist float64, ok bool) {
+	if !s.box {
+		dist = geoDistance(s.center, p)
+		return dist, dist <= s.radius
+	}
+
+	// 先沿经线比较纬度方向的距离，再沿 p 所在的纬线比较经度方向的距离
+	if earthRadius*math.Abs(degRad(p.lat)-degRad(s.center.lat)) > s.height/2 {
+		return 0, false
+	}
+	if geoDistance(geoPoint{lon: s.center.lon, lat: p.lat}, p) > s.width/2 {
+		return 0, false
+	}
+	return geoDistance(s.center, p), true
+}
+
+// 范围的外接经纬度矩形
+func (s *geoShape) bounds() geoArea {
+	halfWidth, halfHeight := s.radius, s.radius
+	if s.box {
+		halfWidth, halfHeight = s.width/2, s.height/2
+	}
+
+	latDelta := radDeg(halfHeight / earthRadius)
+	lonDelta := 360.0 // 覆盖极点时包含全部经度
+	if !s.box {
+		// 球冠的最大经度差为 asin(sin(r)/cos(lat))
+		if x := math.Sin(s.radius/earthRadius) / math.Cos(degRad(s.center.lat)); s.radius/earthRadius < math.Pi/2 && x < 1 {
+			lonDelta = radDeg(math.Asin(x))
+		}
+	} else {
+		// contains 以同一纬线上两点的球面距离 2R*asin(cos(lat)*sin(dLon/2)) 比较宽度，纬度绝对值越大，经度差越大
+		lat := math.Max(math.Abs(s.center.lat+latDelta), math.Abs(s.center.lat-latDelta))
+		if x := math.Sin(halfWidth/earthRadius/2) / math.Cos(degRad(lat)); halfWidth/earthRadius < math.Pi && lat < 90 && x < 1 {
+			lonDelta = radDeg(2 * math.Asin(x))
+		}
+	}
+	return geoArea{
+		lonMin: s.center.lon - lonDelta,
+		lonMax: s.center.lon + lonDelta,
+		latMin: s.center.lat - latDelta,
+		latMax: s.center.lat + latDelta,
+	}
+}
+
+// 根据范围大小估算 geohash 的精度，使得相邻的 9 个格子能够覆盖整个范围
+func (s *geoShape) estimateStep() uint {
+	r := s.radius
+	if s.box {
+		r = math.Sqrt(s.width*s.width+s.height*s.height) / 2
+	}
+	if r == 0 {
+		return geoStep
+	}
+
+	step := 1
+	for ; r < mercatorMax; r *= 2 {
+		step++
+	}
+	step -= 2
+
+	// 高纬度地区的格子在经度方向更窄
+	if s.center.lat > 66 || s.center.lat < -66 {
+		step--
+		if s.center.lat > 80 || s.center.lat < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > geoStep {
+		step = geoStep
+	}
+	return uint(step)
+}
+
+// 返回覆盖搜索范围的分值区间. 无法用相邻格子覆盖时返回 nil，代表需要遍历全部成员
+func (s *geoShape) scoreRanges() []scoreRange {
+	bounds := s.bounds()
+	for step := s.estimateStep(); step >= 1; step-- {
+		lat, lon := deinterleave(geoEncode(s.center, step))
+		cells := uint64(1) << step
+		covered := geoDecode(interleave(lat, lon), step)
+		if lat > 0 {
+			covered.latMin = geoDecode(interleave(lat-1, lon), step).latMin
+		}
+		if lat+1 < cells {
+			covered.latMax = geoDecode(interleave(lat+1, lon), step).latMax
+		}
+		// 跨越经度 ±180 度时直接降低精度
+		if lon == 0 || lon+1 == cells {
+			continue
+		}
+		covered.lonMin = geoDecode(interleave(lat, lon-1), step).lonMin
+		covered.lonMax = geoDecode(interleave(lat, lon+1), step).lonMax
+		if bounds.latMin < covered.latMin || bounds.latMax > covered.latMax ||
+			bounds.lonMin < covered.lonMin || bounds.lonMax > covered.lonMax {
+			continue
+		}
+
+		// 9 个格子对应的分值区间，同一纬度上相邻的格子在分值上并不连续
+		var ranges []scoreRange
+		shift := 2 * (geoStep - step)
+		for dLat := -1; dLat <= 1; dLat++ {
+			if lat == 0 && dLat < 0 || lat+1 == cells && dLat > 0 {
+				continue
+			}
+			for dLon := -1; dLon <= 1; dLon++ {
+				hash := interleave(uint64(int64(lat)+int64(dLat)), uint64(int64(lon)+int64(dLon)))
+				ranges = append(ranges, scoreRange{
+					min:   float64(hash << shift),
+					max:   float64((hash + 1) << shift),
+					maxEx: true,
+				})
+			}
+		}
+		return ranges
+	}
+	return nil
+}
+
+type geoResult struct {
+	member string
+	score  float64
+	dist   float64
+	point  geoPoint
+}
+
+// 在有序集合中搜索范围内的成员. any 为 true 时找到 count 个成员后立即返回
+func geoSearch(zset SortedSet, shape *geoShape, count int64, any bool) []*geoResult {
+	var res []*geoResult
+	check := func(member string, score float64) bool {
+		p := geoDecodePoint(uint64(score))
+		if dist, ok := shape.contains(p); ok {
+			res = append(res, &geoResult{member: member, score: score, dist: dist, point: p})
+		}
+		return any && count > 0 && int64(len(res)) >= count
+	}
+
+	ranges := shape.scoreRanges()
+	if ranges == nil {
+		var done bool
+		zset.ForEach(func(member string, score float64) {
+			if !done {
+				done = check(member, score)
+			}
+		})
+		return res
+	}
+
+	for _, r := range ranges {
+		for _, member := range zset.Range(r, 0, -1, false) {
+			score, _ := zset.Score(member)
+			if check(member, score) {
+				return res
+			}
+		}
+	}
+	return res
+}
+
+// order 为 0 时不排序，1 为升序，-1 为降序
+func sortGeoResults(res []*geoResult, order int) {
+	if order == 0 {
+		return
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if order > 0 {
+			return res[i].dist < res[j].dist
+		}
+		return res[i].dist > res[j].dist
+	})
+}
+
+type geoSearchArgs struct {
+	shape      geoShape
+	fromMember []byte // 非 nil 时以该成员的位置作为中心点
+	order      int
+	count      int64
+	any        bool
+	withCoord  bool
+	withDist   bool
+	withHash   bool
+	storeDist  bool
+}
+
+// FROMMEMBER member | FROMLONLAT longitude latitude
+// BYRADIUS radius M|KM|FT|MI | BYBOX width height M|KM|FT|MI
+// [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+// store 为 true 时对应 geosearchstore，不支持 WITH 系列选项，支持 STOREDIST
+func parseGeoSearchArgs(args [][]byte, store bool) (*geoSearchArgs, error) {
+	cmdName := "GEOSEARCH"
+	if store {
+		cmdName = "GEOSEARCHSTORE"
+	}
+
+	var (
+		res            geoSearchArgs
+		fromLonLat, by bool
+	)
+	for i := 0; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		left := len(args) - 1 - i
+		switch {
+		case option == "frommember" && left >= 1:
+			if res.fromMember != nil || fromLonLat {
+				return nil, errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+			}
+			res.fromMember = args[i+1]
+			i++
+		case option == "fromlonlat" && left >= 2:
+			if res.fromMember != nil || fromLonLat {
+				return nil, errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+			}
+			center, err := parseGeoPoint(args[i+1], args[i+2])
+			if err != nil {
+				return nil, err
+			}
+			res.shape.center, fromLonLat = center, true
+			i += 2
+		case option == "byradius" && left >= 2:
+			if by {
+				return nil, errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+			}
+			radius, err := strconv.ParseFloat(string(args[i+1]), 64)
+			if err != nil {
+				return nil, errors.New("ERR need numeric radius")
+			}
+			if radius < 0 {
+				return nil, errors.New("ERR radius cannot be negative")
+			}
+			if res.shape.unit, err = parseGeoUnit(args[i+2]); err != nil {
+				return nil, err
+			}
+			res.shape.radius, by = radius*res.shape.unit, true
+			i += 2
+		case option == "bybox" && left >= 3:
+			if by {
+				return nil, errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+			}
+			width, err1 := strconv.ParseFloat(string(args[i+1]), 64)
+			height, err2 := strconv.ParseFloat(string(args[i+2]), 64)
+			if err1 != nil || err2 != nil {
+				return nil, errors.New("ERR need numeric width and height")
+			}
+			if width < 0 || height < 0 {
+				return nil, errors.New("ERR height or width cannot be negative")
+			}
+			unit, err := parseGeoUnit(args[i+3])
+			if err != nil {
+				return nil, err
+			}
+			res.shape.width, res.shape.height, res.shape.unit, res.shape.box, by = width*unit, height*unit, unit, true, true
+			i += 3
+		case option == "asc":
+			res.order = 1
+		case option == "desc":
+			res.order = -1
+		case option == "count" && left >= 1:
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || count <= 0 {
+				return nil, errors.New("ERR COUNT must be > 0")
+			}
+			res.count = count
+			i++
+			if i+1 < len(args) && strings.EqualFold(string(args[i+1]), "any") {
+				res.any = true
+				i++
+			}
+		case option == "any":
+			return nil, errors.New("ERR the ANY argument requires COUNT argument")
+		case option == "withcoord" && !store:
+			res.withCoord = true
+		case option == "withdist" && !store:
+			res.withDist = true
+		case option == "withhash" && !store:
+			res.withHash = true
+		case option == "storedist" && store:
+			res.storeDist = true
+		default:
+			return nil, handler.NewSyntaxErrReply()
+		}
+	}
+
+	if res.fromMember == nil && !fromLonLat {
+		return nil, errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+	}
+	if !by {
+		return nil, errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+	}
+	// 限制个数且未指定顺序时，按照距离升序返回最近的成员
+	if res.count > 0 && res.order == 0 && !res.any {
+		res.order = 1
+	}
+	return &res, nil
+}
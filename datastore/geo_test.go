@@ -0,0 +1,145 @@
+package datastore
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/AlphaMinZ/myredis_go/lib"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_geo_hash(t *testing.T) {
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	for i := 0; i < 1000; i++ {
+		p := geoPoint{
+			lon: geoLonMin + rander.Float64()*(geoLonMax-geoLonMin),
+			lat: geoLatMin + rander.Float64()*(geoLatMax-geoLatMin),
+		}
+		hash := geoEncode(p, geoStep)
+		assert.Less(t, hash, uint64(1)<<52)
+
+		// 解码结果为格子的中心点，误差不超过 1 米
+		assert.Less(t, geoDistance(p, geoDecodePoint(hash)), 1.0)
+
+		// 较低精度的 geohash 为高精度 geohash 的前缀
+		step := uint(1 + rander.Intn(geoStep))
+		assert.Equal(t, geoEncode(p, step), hash>>(2*(geoStep-step)))
+	}
+
+	lat, lon := deinterleave(interleave(12345, 67890))
+	assert.Equal(t, uint64(12345), lat)
+	assert.Equal(t, uint64(67890), lon)
+}
+
+func Test_geo_search(t *testing.T) {
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	zset := newSkiplist("")
+	for i := 0; i < 5000; i++ {
+		p := geoPoint{
+			lon: geoLonMin + rander.Float64()*(geoLonMax-geoLonMin),
+			lat: geoLatMin + rander.Float64()*(geoLatMax-geoLatMin),
+		}
+		zset.Add(float64(geoEncode(p, geoStep)), cast.ToString(i))
+	}
+
+	// 与全量遍历的结果进行比较
+	bruteForce := func(shape *geoShape) []string {
+		var res []string
+		zset.ForEach(func(member string, score float64) {
+			if _, ok := shape.contains(geoDecodePoint(uint64(score))); ok {
+				res = append(res, member)
+			}
+		})
+		sort.Strings(res)
+		return res
+	}
+
+	for i := 0; i < 500; i++ {
+		shape := geoShape{
+			center: geoPoint{
+				lon: geoLonMin + rander.Float64()*(geoLonMax-geoLonMin),
+				lat: geoLatMin + rander.Float64()*(geoLatMax-geoLatMin),
+			},
+			unit: 1,
+		}
+		// 半径覆盖 1km ~ 10000km
+		size := 1000 * float64(int64(1)<<rander.Intn(14))
+		if i&1 == 0 {
+			shape.radius = size
+		} else {
+			shape.box, shape.width, shape.height = true, size, size*(0.5+rander.Float64())
+		}
+
+		var got []string
+		for _, r := range geoSearch(zset, &shape, 0, false) {
+			got = append(got, r.member)
+		}
+		sort.Strings(got)
+		assert.Equal(t, bruteForce(&shape), got)
+	}
+
+	// 高纬度地区经线收拢，在随机成员之外补充范围边缘处的成员
+	zset = newSkiplist("")
+	for i := 0; i < 5000; i++ {
+		lat := 75 + rander.Float64()*(geoLatMax-75)
+		if i&1 == 0 {
+			lat = -lat
+		}
+		zset.Add(float64(geoEncode(geoPoint{lon: geoLonMin + rander.Float64()*360, lat: lat}, geoStep)), cast.ToString(i))
+	}
+	add := func(lon, lat float64) string {
+		member := cast.ToString(lon) + "," + cast.ToString(lat)
+		zset.Add(float64(geoEncode(geoPoint{lon: math.Remainder(lon, 360), lat: lat}, geoStep)), member)
+		return member
+	}
+
+	cases := []struct {
+		shape geoShape
+		edge  []string
+	}{
+		// 半径越过外接矩形的角落：球冠经度差最大处位于中心点的极点一侧
+		{shape: geoShape{center: geoPoint{lon: 10, lat: 80}, radius: 300000}},
+		{shape: geoShape{center: geoPoint{lon: -170, lat: -82}, radius: 200000}},
+		// 矩形在纬度绝对值最大的边上经度差最大
+		{shape: geoShape{center: geoPoint{lon: -10, lat: -80}, box: true, width: 1800000, height: 1100000}},
+		{shape: geoShape{center: geoPoint{lon: 40, lat: 82}, box: true, width: 1150000, height: 450000}},
+		// 覆盖极点
+		{shape: geoShape{center: geoPoint{lon: 0, lat: 84}, radius: 1500000}, edge: []string{add(180, 85), add(90, 85)}},
+		{shape: geoShape{center: geoPoint{lon: 45, lat: -85}, box: true, width: 2000000, height: 1500000},
+			edge: []string{add(135, -85), add(-45, -84)}},
+	}
+	for _, c := range cases {
+		shape := c.shape
+		shape.unit = 1
+		if d := shape.radius / earthRadius * 0.999; !shape.box && d < math.Pi/2-degRad(math.Abs(shape.center.lat)) {
+			lat := radDeg(math.Asin(math.Sin(degRad(shape.center.lat)) / math.Cos(d)))
+			lonDelta := radDeg(math.Asin(math.Sin(d) / math.Cos(degRad(shape.center.lat))))
+			c.edge = append(c.edge, add(shape.center.lon-lonDelta, lat), add(shape.center.lon+lonDelta, lat))
+		}
+		if latDelta := radDeg(shape.height / 2 / earthRadius * 0.999); shape.box && math.Abs(shape.center.lat)+latDelta < 90 {
+			lat := shape.center.lat + math.Copysign(latDelta, shape.center.lat)
+			lonDelta := 0.999 * radDeg(2*math.Asin(math.Sin(shape.width/4/earthRadius)/math.Cos(degRad(lat))))
+			c.edge = append(c.edge, add(shape.center.lon-lonDelta, lat), add(shape.center.lon+lonDelta, lat))
+		}
+
+		var got []string
+		for _, r := range geoSearch(zset, &shape, 0, false) {
+			got = append(got, r.member)
+		}
+		sort.Strings(got)
+		want := bruteForce(&shape)
+		assert.Subset(t, want, c.edge)
+		assert.Equal(t, want, got)
+	}
+}
+
+func Test_geo_sort(t *testing.T) {
+	res := []*geoResult{{member: "a", dist: 3}, {member: "b", dist: 1}, {member: "c", dist: 2}}
+	sortGeoResults(res, 1)
+	assert.Equal(t, "b", res[0].member)
+	sortGeoResults(res, -1)
+	assert.Equal(t, "a", res[0].member)
+}
@@ -1,10 +1,23 @@
 package datastore
 
 import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/AlphaMinZ/myredis_go/database"
 	"github.com/AlphaMinZ/myredis_go/handler"
 )
 
+// field 过期时间的上限，单位为毫秒
+const maxHashFieldExpire = 1 << 48
+
+var (
+	errHashNotInteger = errors.New("ERR hash value is not an integer")
+	errHashNotFloat   = errors.New("ERR hash value is not a float")
+)
+
 func (k *KVStore) getAsHashMap(key string) (HashMap, error) {
 	v, ok := k.data[key]
 	if !ok {
@@ -20,30 +33,59 @@ func (k *KVStore) getAsHashMap(key string) (HashMap, error) {
 }
 
 func (k *KVStore) putAsHashMap(key string, hmap HashMap) {
-	k.data[key] = hmap
+	k.putData(key, hmap)
+}
+
+// 与 redis 保持一致，hash 中 field 被移除完毕后，同时删除 key
+func (k *KVStore) delIfEmptyHashMap(key string, hmap HashMap) {
+	if hmap.Len() == 0 {
+		k.del(key)
+	}
 }
 
 type HashMap interface {
-	Put(key string, value []byte)
+	Put(key string, value []byte) int64
 	Get(key string) []byte
 	Del(key string) int64
-	database.CmdAdapter
+	Len() int64
+	ForEach(f func(key string, value []byte))
+	RandomFields(cnt int64) []string
+	Scan(cursor uint64, count int64) (uint64, []string)
+	Expire(key string, expiredAt time.Time)
+	ExpiredAt(key string) (time.Time, bool)
+	Persist(key string) bool
+	ExpireFields(now time.Time) []string
+	Volatile() bool
+	database.MultiCmdAdapter
 }
 
 type hashMapEntity struct {
-	key  string
-	data map[string][]byte
+	key   string
+	data  map[string][]byte
+	index *scanIndex
+
+	// field 的过期时间，未设置过 field 过期时间时为 nil
+	expiredAt       map[string]time.Time
+	expireTimeWheel SortedSet
 }
 
 func newHashMapEntity(key string) HashMap {
 	return &hashMapEntity{
-		key:  key,
-		data: make(map[string][]byte),
+		key:   key,
+		data:  make(map[string][]byte),
+		index: newScanIndex(),
 	}
 }
 
-func (h *hashMapEntity) Put(key string, value []byte) {
+// 返回新增的 field 个数
+func (h *hashMapEntity) Put(key string, value []byte) int64 {
+	var added int64
+	if _, ok := h.data[key]; !ok {
+		h.index.add(key)
+		added = 1
+	}
 	h.data[key] = value
+	return added
 }
 
 func (h *hashMapEntity) Get(key string) []byte {
@@ -55,9 +97,80 @@ func (h *hashMapEntity) Del(key string) int64 {
 		return 0
 	}
 	delete(h.data, key)
+	h.index.rem(key)
+	h.Persist(key)
 	return 1
 }
 
+func (h *hashMapEntity) Len() int64 {
+	return int64(len(h.data))
+}
+
+func (h *hashMapEntity) ForEach(f func(key string, value []byte)) {
+	for k, v := range h.data {
+		f(k, v)
+	}
+}
+
+// cnt > 0 时返回至多 cnt 个不重复的 field，cnt < 0 时返回 |cnt| 个可能重复的 field
+func (h *hashMapEntity) RandomFields(cnt int64) []string {
+	return h.index.randomMembers(cnt)
+}
+
+func (h *hashMapEntity) Scan(cursor uint64, count int64) (uint64, []string) {
+	return h.index.scan(cursor, count)
+}
+
+// 设置 field 的过期时间，调用方需要保证 field 存在
+func (h *hashMapEntity) Expire(key string, expiredAt time.Time) {
+	if h.expiredAt == nil {
+		h.expiredAt = make(map[string]time.Time)
+		h.expireTimeWheel = newSkiplist("")
+	}
+	h.expiredAt[key] = expiredAt
+	h.expireTimeWheel.Add(float64(expiredAt.UnixMilli()), key)
+}
+
+func (h *hashMapEntity) ExpiredAt(key string) (time.Time, bool) {
+	expiredAt, ok := h.expiredAt[key]
+	return expiredAt, ok
+}
+
+// 移除 field 的过期时间，返回 field 之前是否设置了过期时间
+func (h *hashMapEntity) Persist(key string) bool {
+	if _, ok := h.expiredAt[key]; !ok {
+		return false
+	}
+	delete(h.expiredAt, key)
+	h.expireTimeWheel.Rem(key)
+	return true
+}
+
+// 回收截止到 now 已过期的 field，返回回收的 field
+func (h *hashMapEntity) ExpireFields(now time.Time) []string {
+	if len(h.expiredAt) == 0 {
+		return nil
+	}
+
+	expired := h.expireTimeWheel.Range(scoreRange{max: float64(now.UnixMilli())}, 0, -1, false)
+	for _, key := range expired {
+		h.Del(key)
+	}
+	return expired
+}
+
+func (h *hashMapEntity) Volatile() bool {
+	return len(h.expiredAt) > 0
+}
+
+func (h *hashMapEntity) Encoding() string {
+	return "hashtable"
+}
+
+func (h *hashMapEntity) setKey(key string) {
+	h.key = key
+}
+
 func (h *hashMapEntity) ToCmd() [][]byte {
 	args := make([][]byte, 0, 2+2*len(h.data))
 	args = append(args, []byte(database.CmdTypeHSet), []byte(h.key))
@@ -66,3 +179,59 @@ func (h *hashMapEntity) ToCmd() [][]byte {
 	}
 	return args
 }
+
+// field 的过期时间以 hpexpireat 的形式追加，过期时间相同的 field 合并为一条指令
+func (h *hashMapEntity) ExtraCmds() [][][]byte {
+	if len(h.expiredAt) == 0 {
+		return nil
+	}
+
+	fields := make(map[int64][]string)
+	for k, expiredAt := range h.expiredAt {
+		fields[expiredAt.UnixMilli()] = append(fields[expiredAt.UnixMilli()], k)
+	}
+
+	cmds := make([][][]byte, 0, len(fields))
+	for expiredAt, keys := range fields {
+		cmds = append(cmds, hpexpireAtCmd(h.key, time.UnixMilli(expiredAt), keys))
+	}
+	return cmds
+}
+
+// hpexpireat key unix-time-milliseconds FIELDS numfields field [field ...]
+func hpexpireAtCmd(key string, expiredAt time.Time, fields []string) [][]byte {
+	return hashFieldsCmd(database.CmdTypeHPExpireAt, key, [][]byte{[]byte(strconv.FormatInt(expiredAt.UnixMilli(), 10))}, fields)
+}
+
+// 生成 cmd key [args ...] FIELDS numfields field [field ...] 形式的指令
+func hashFieldsCmd(cmdType database.CmdType, key string, args [][]byte, fields []string) [][]byte {
+	cmd := make([][]byte, 0, 4+len(args)+len(fields))
+	cmd = append(cmd, []byte(cmdType), []byte(key))
+	cmd = append(cmd, args...)
+	cmd = append(cmd, []byte("FIELDS"), []byte(strconv.Itoa(len(fields))))
+	for _, field := range fields {
+		cmd = append(cmd, []byte(field))
+	}
+	return cmd
+}
+
+// 解析 FIELDS numfields field [field ...]
+func parseHashFields(args [][]byte) ([]string, error) {
+	if len(args) < 2 || !strings.EqualFold(string(args[0]), "fields") {
+		return nil, errors.New("ERR Mandatory argument FIELDS is missing or not at the right position")
+	}
+
+	numFields, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || numFields <= 0 {
+		return nil, errors.New("ERR Parameter `numFields` should be greater than 0")
+	}
+	if numFields != int64(len(args)-2) {
+		return nil, errors.New("ERR The `numfields` parameter must match the number of arguments")
+	}
+
+	fields := make([]string, 0, numFields)
+	for _, arg := range args[2:] {
+		fields = append(fields, string(arg))
+	}
+	return fields, nil
+}
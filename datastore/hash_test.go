@@ -4,6 +4,7 @@ import (
 	"math/rand"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/AlphaMinZ/myredis_go/database"
 	"github.com/AlphaMinZ/myredis_go/lib"
@@ -105,3 +106,108 @@ func Test_hashmap_to_cmd(t *testing.T) {
 		assert.Equal(t, expect, actual)
 	})
 }
+
+func Test_hashmap_random_fields(t *testing.T) {
+	hashmap := newHashMapEntity("")
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	mp := make(map[string]struct{}, 1000)
+	for i := 0; i < 1000; i++ {
+		k := cast.ToString(rander.Intn(1000))
+		_, ok := mp[k]
+		assert.Equal(t, ok, hashmap.Put(k, []byte(k)) == 0)
+		mp[k] = struct{}{}
+	}
+	assert.Equal(t, int64(len(mp)), hashmap.Len())
+
+	t.Run("distinct", func(t *testing.T) {
+		for _, cnt := range []int64{1, 10, int64(len(mp)) / 2, int64(len(mp)) + 1} {
+			fields := hashmap.RandomFields(cnt)
+			expect := cnt
+			if expect > int64(len(mp)) {
+				expect = int64(len(mp))
+			}
+			assert.Equal(t, expect, int64(len(fields)))
+
+			seen := make(map[string]struct{}, len(fields))
+			for _, field := range fields {
+				_, ok := mp[field]
+				assert.True(t, ok)
+				seen[field] = struct{}{}
+			}
+			assert.Equal(t, len(fields), len(seen))
+		}
+	})
+
+	t.Run("repeated", func(t *testing.T) {
+		fields := hashmap.RandomFields(-3000)
+		assert.Equal(t, 3000, len(fields))
+		for _, field := range fields {
+			_, ok := mp[field]
+			assert.True(t, ok)
+		}
+	})
+}
+
+func Test_hashmap_expire_fields(t *testing.T) {
+	hashmap := newHashMapEntity("")
+	now := lib.TimeNow()
+	for i := 0; i < 100; i++ {
+		hashmap.Put(cast.ToString(i), []byte(cast.ToString(i)))
+		if i%2 == 0 {
+			hashmap.Expire(cast.ToString(i), now.Add(time.Duration(i)*time.Second))
+		}
+	}
+	assert.True(t, hashmap.Volatile())
+
+	t.Run("persist", func(t *testing.T) {
+		assert.True(t, hashmap.Persist("0"))
+		assert.False(t, hashmap.Persist("1"))
+		_, ok := hashmap.ExpiredAt("0")
+		assert.False(t, ok)
+	})
+
+	t.Run("extra_cmds", func(t *testing.T) {
+		var fields int
+		for _, cmd := range hashmap.ExtraCmds() {
+			assert.Equal(t, database.CmdTypeHPExpireAt, database.CmdType(cmd[0]))
+			fields += len(cmd) - 5
+		}
+		assert.Equal(t, 49, fields)
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		// 2、4、...、50 号 field 过期
+		assert.Len(t, hashmap.ExpireFields(now.Add(50*time.Second)), 25)
+		assert.Equal(t, int64(75), hashmap.Len())
+		assert.Nil(t, hashmap.Get("50"))
+		assert.NotNil(t, hashmap.Get("52"))
+		assert.NotNil(t, hashmap.Get("0"))
+
+		assert.Len(t, hashmap.ExpireFields(now.Add(time.Hour)), 24)
+		assert.False(t, hashmap.Volatile())
+	})
+}
+
+func Test_hash_incr_by_float_replay(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, ":2\r\n", db.do("hset", "h", "a", "1", "b", "2"))
+	assert.Equal(t, "*1\r\n:1\r\n", db.do("hexpire", "h", "100", "FIELDS", "1", "a"))
+	assert.Equal(t, "$3\r\n1.5\r\n", db.do("hincrbyfloat", "h", "a", "0.5"))
+	assert.Equal(t, "$3\r\n2.5\r\n", db.do("hincrbyfloat", "h", "b", "0.5"))
+
+	// 重放后 field 的过期时间保持不变
+	replayed := db.replay(t)
+	assert.Equal(t, "$3\r\n1.5\r\n", replayed.do("hget", "h", "a"))
+	assert.Contains(t, []string{"*2\r\n:100\r\n:-1\r\n", "*2\r\n:99\r\n:-1\r\n"}, replayed.do("httl", "h", "FIELDS", "2", "a", "b"))
+}
+
+func Test_hrandfield_huge_count(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, ":2\r\n", db.do("hset", "h", "f1", "v1", "f2", "v2"))
+
+	// 超大 count 不能导致执行协程崩溃
+	assert.Equal(t, "*2\r\n", db.do("hrandfield", "h", "4000000000000000000")[:4])
+	assert.Equal(t, "-ERR value is out of range\r\n", db.do("hrandfield", "h", "-4000000000000000000"))
+	assert.Equal(t, "*3\r\n", db.do("hrandfield", "h", "-3")[:4])
+	assert.Equal(t, ":2\r\n", db.do("hlen", "h"))
+}
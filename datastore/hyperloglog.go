@@ -0,0 +1,344 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// 与 redis 保持一致的 HyperLogLog 编码：16 字节的头部 + 16384 个 6 bit 的寄存器.
+// 头部依次为 "HYLL"、编码方式、3 字节保留位以及 8 字节小端序的基数缓存，缓存最高位为 1 时代表失效.
+// 寄存器较为稀疏时采用游程编码，超过 hllSparseMaxBytes 或者寄存器取值超过 32 时转为稠密编码
+const (
+	hllP           = 14
+	hllQ           = 64 - hllP
+	hllRegisters   = 1 << hllP
+	hllPMask       = hllRegisters - 1
+	hllBits        = 6
+	hllRegisterMax = 1<<hllBits - 1
+	hllHeaderSize  = 16
+	hllDenseSize   = hllHeaderSize + (hllRegisters*hllBits+7)/8
+	hllAlphaInf    = 0.721347520444481703680
+
+	hllDense  = 0
+	hllSparse = 1
+
+	hllSparseMaxBytes    = 3000
+	hllSparseValMax      = 32
+	hllSparseValMaxLen   = 4
+	hllSparseZeroMaxLen  = 64
+	hllSparseXZeroMaxLen = 16384
+)
+
+var (
+	errNotHyperLogLog       = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	errCorruptedHyperLogLog = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+func (k *KVStore) getAsHyperLogLog(key string) (hyperLogLog, error) {
+	str, err := k.getAsString(key)
+	if err != nil || str == nil {
+		return nil, err
+	}
+	return parseHyperLogLog(str.Bytes())
+}
+
+type hyperLogLog []byte
+
+// 空的 HyperLogLog 由单个覆盖全部寄存器的 XZERO 构成，基数缓存为 0
+func newHyperLogLog() hyperLogLog {
+	h := make(hyperLogLog, hllHeaderSize, hllHeaderSize+2)
+	copy(h, "HYLL")
+	h[4] = hllSparse
+	return append(h, 0x40|byte((hllRegisters-1)>>8), byte((hllRegisters-1)&0xff))
+}
+
+func parseHyperLogLog(b []byte) (hyperLogLog, error) {
+	if len(b) < hllHeaderSize || string(b[:4]) != "HYLL" {
+		return nil, errNotHyperLogLog
+	}
+	switch b[4] {
+	case hllDense:
+		if len(b) != hllDenseSize {
+			return nil, errNotHyperLogLog
+		}
+	case hllSparse:
+	default:
+		return nil, errNotHyperLogLog
+	}
+	return b, nil
+}
+
+func (h hyperLogLog) isSparse() bool {
+	return h[4] == hllSparse
+}
+
+// 返回是否有寄存器被更新
+func (h *hyperLogLog) add(elements [][]byte) (bool, error) {
+	var updated bool
+	if !h.isSparse() {
+		for _, element := range elements {
+			index, count := hllPatLen(element)
+			if count > h.denseGet(index) {
+				h.denseSet(index, count)
+				updated = true
+			}
+		}
+		if updated {
+			h.invalidateCache()
+		}
+		return updated, nil
+	}
+
+	// 稀疏编码先还原为寄存器数组，批量更新后重新编码
+	var regs [hllRegisters]uint8
+	if err := h.mergeInto(&regs); err != nil {
+		return false, err
+	}
+	for _, element := range elements {
+		index, count := hllPatLen(element)
+		if count > regs[index] {
+			regs[index] = count
+			updated = true
+		}
+	}
+	if updated {
+		h.store(&regs, true)
+	}
+	return updated, nil
+}
+
+// 返回基数估计值. refreshed 为 true 代表重新计算并写入了基数缓存
+func (h hyperLogLog) count() (card uint64, refreshed bool, err error) {
+	if h[15]&0x80 == 0 {
+		return binary.LittleEndian.Uint64(h[8:]), false, nil
+	}
+
+	var regs [hllRegisters]uint8
+	if err = h.mergeInto(&regs); err != nil {
+		return 0, false, err
+	}
+	card = hllCount(&regs)
+	binary.LittleEndian.PutUint64(h[8:], card)
+	return card, true, nil
+}
+
+// 将寄存器按位取最大值合并到 regs 中
+func (h hyperLogLog) mergeInto(regs *[hllRegisters]uint8) error {
+	if !h.isSparse() {
+		for i := 0; i < hllRegisters; i++ {
+			if v := h.denseGet(i); v > regs[i] {
+				regs[i] = v
+			}
+		}
+		return nil
+	}
+
+	var index int
+	for p := hllHeaderSize; p < len(h); {
+		var (
+			value uint8
+			runs  int
+		)
+		switch op := h[p]; {
+		case op&0xc0 == 0x00: // ZERO: 00xxxxxx
+			runs = int(op&0x3f) + 1
+			p++
+		case op&0xc0 == 0x40: // XZERO: 01xxxxxx yyyyyyyy
+			if p+1 >= len(h) {
+				return errCorruptedHyperLogLog
+			}
+			runs = (int(op&0x3f)<<8 | int(h[p+1])) + 1
+			p += 2
+		default: // VAL: 1vvvvvxx
+			value, runs = (op>>2)&0x1f+1, int(op&0x03)+1
+			p++
+		}
+		if index+runs > hllRegisters {
+			return errCorruptedHyperLogLog
+		}
+		for end := index + runs; index < end; index++ {
+			if value > regs[index] {
+				regs[index] = value
+			}
+		}
+	}
+	if index != hllRegisters {
+		return errCorruptedHyperLogLog
+	}
+	return nil
+}
+
+// 以 regs 覆盖全部寄存器. sparse 为 true 时优先尝试稀疏编码，稠密编码不会再转回稀疏编码
+func (h *hyperLogLog) store(regs *[hllRegisters]uint8, sparse bool) {
+	var header [hllHeaderSize]byte
+	copy(header[:], (*h)[:hllHeaderSize])
+
+	if sparse {
+		if b, ok := hllEncodeSparse(regs); ok {
+			*h = append(append((*h)[:0], header[:]...), b...)
+			h.invalidateCache()
+			return
+		}
+	}
+
+	dense := make(hyperLogLog, hllDenseSize)
+	copy(dense, header[:])
+	dense[4] = hllDense
+	for i, v := range regs {
+		dense.denseSet(i, v)
+	}
+	*h = dense
+	h.invalidateCache()
+}
+
+func (h hyperLogLog) invalidateCache() {
+	h[15] |= 0x80
+}
+
+// 第 i 个寄存器位于自第 i*6 位起的 6 个 bit，低位在前，可能横跨两个字节
+func (h hyperLogLog) denseGet(i int) uint8 {
+	regs := h[hllHeaderSize:]
+	byteIdx, fb := i*hllBits/8, uint(i*hllBits&7)
+	b0 := regs[byteIdx]
+	var b1 byte
+	if byteIdx+1 < len(regs) {
+		b1 = regs[byteIdx+1]
+	}
+	return (b0>>fb | b1<<(8-fb)) & hllRegisterMax
+}
+
+func (h hyperLogLog) denseSet(i int, v uint8) {
+	regs := h[hllHeaderSize:]
+	byteIdx, fb := i*hllBits/8, uint(i*hllBits&7)
+	regs[byteIdx] &^= hllRegisterMax << fb
+	regs[byteIdx] |= v << fb
+	if byteIdx+1 < len(regs) {
+		regs[byteIdx+1] &^= hllRegisterMax >> (8 - fb)
+		regs[byteIdx+1] |= v >> (8 - fb)
+	}
+}
+
+// 寄存器取值超过 32 或者编码长度超过 hllSparseMaxBytes 时无法采用稀疏编码
+func hllEncodeSparse(regs *[hllRegisters]uint8) ([]byte, bool) {
+	var b []byte
+	for i := 0; i < hllRegisters; {
+		v := regs[i]
+		if v > hllSparseValMax {
+			return nil, false
+		}
+		runs := 1
+		for i+runs < hllRegisters && regs[i+runs] == v {
+			runs++
+		}
+		i += runs
+
+		for runs > 0 {
+			switch {
+			case v != 0:
+				n := min(runs, hllSparseValMaxLen)
+				b = append(b, 0x80|(v-1)<<2|byte(n-1))
+				runs -= n
+			case runs > hllSparseZeroMaxLen:
+				n := min(runs, hllSparseXZeroMaxLen)
+				b = append(b, 0x40|byte((n-1)>>8), byte((n-1)&0xff))
+				runs -= n
+			default:
+				b = append(b, byte(runs-1))
+				runs = 0
+			}
+		}
+		if len(b) > hllSparseMaxBytes {
+			return nil, false
+		}
+	}
+	return b, true
+}
+
+// 哈希值的低 14 位作为寄存器下标，其余位中首个 1 出现的位置作为寄存器的取值
+func hllPatLen(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, 0xadc83b19)
+	index := int(hash & hllPMask)
+	hash >>= hllP
+	hash |= 1 << hllQ
+	return index, uint8(bits.TrailingZeros64(hash) + 1)
+}
+
+// 采用 Otmar Ertl 提出的改进估计算法，与 redis 一致
+func hllCount(regs *[hllRegisters]uint8) uint64 {
+	var histogram [64]int
+	for _, v := range regs {
+		histogram[v]++
+	}
+
+	m := float64(hllRegisters)
+	z := m * hllTau((m-float64(histogram[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histogram[0])/m)
+	return uint64(math.Round(hllAlphaInf * m * m / z))
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
+
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	const (
+		m = 0xc6a4a7935bd1e995
+		r = 47
+	)
+
+	h := seed ^ uint64(len(data))*m
+	for ; len(data) >= 8; data = data[8:] {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * i)
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
@@ -0,0 +1,113 @@
+package datastore
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/AlphaMinZ/myredis_go/lib"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_hyperloglog(t *testing.T) {
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	prefix := cast.ToString(rander.Int63())
+	hll := newHyperLogLog()
+
+	t.Run("empty", func(t *testing.T) {
+		card, refreshed, err := hll.count()
+		assert.Nil(t, err)
+		assert.False(t, refreshed)
+		assert.Equal(t, uint64(0), card)
+	})
+
+	t.Run("sparse to dense", func(t *testing.T) {
+		var added int
+		for hll.isSparse() {
+			elements := make([][]byte, 0, 10)
+			for i := 0; i < 10; i++ {
+				elements = append(elements, []byte(prefix+cast.ToString(added)))
+				added++
+			}
+			updated, err := hll.add(elements)
+			assert.Nil(t, err)
+			assert.True(t, updated)
+		}
+		assert.Equal(t, hllDenseSize, len(hll))
+
+		// 重复写入不会更新寄存器
+		updated, _ := hll.add([][]byte{[]byte(prefix + "0")})
+		assert.False(t, updated)
+	})
+
+	t.Run("accuracy", func(t *testing.T) {
+		hll = newHyperLogLog()
+		for i := 0; i < 100000; i++ {
+			_, _ = hll.add([][]byte{[]byte(prefix + cast.ToString(i))})
+			if i == 99 || i == 9999 || i == 99999 {
+				card, refreshed, err := hll.count()
+				assert.Nil(t, err)
+				assert.True(t, refreshed)
+				// 标准误差为 0.81%，此处放宽到 5 倍
+				assert.Less(t, math.Abs(float64(card)-float64(i+1))/float64(i+1), 0.0405)
+
+				cached, refreshed, _ := hll.count()
+				assert.False(t, refreshed)
+				assert.Equal(t, card, cached)
+			}
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		other := newHyperLogLog()
+		for i := 50000; i < 150000; i++ {
+			_, _ = other.add([][]byte{[]byte(prefix + cast.ToString(i))})
+		}
+
+		var regs [hllRegisters]uint8
+		assert.Nil(t, hll.mergeInto(&regs))
+		assert.Nil(t, other.mergeInto(&regs))
+		card := hllCount(&regs)
+		assert.Less(t, math.Abs(float64(card)-150000)/150000, 0.0405)
+
+		// 稠密编码与稀疏编码之间的转换不影响寄存器
+		merged := newHyperLogLog()
+		merged.store(&regs, true)
+		assert.False(t, merged.isSparse())
+		var restored [hllRegisters]uint8
+		assert.Nil(t, merged.mergeInto(&restored))
+		assert.Equal(t, regs, restored)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseHyperLogLog([]byte("HYLLx"))
+		assert.Equal(t, errNotHyperLogLog, err)
+		corrupted := append(newHyperLogLog(), 0x00)
+		var regs [hllRegisters]uint8
+		assert.Equal(t, errCorruptedHyperLogLog, corrupted.mergeInto(&regs))
+	})
+}
+
+func Test_pfmerge_replay(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, ":1\r\n", db.do("pfadd", "h1", "a", "b"))
+	assert.Equal(t, ":1\r\n", db.do("pfadd", "hd"))
+	assert.Equal(t, ":1\r\n", db.do("expire", "hd", "100"))
+	db.expireSoon(t, "h1")
+
+	// 以 set 合并结果的形式持久化，并保留 destkey 的过期时间
+	assert.Equal(t, "+OK\r\n", db.do("pfmerge", "hd", "h1"))
+	last := db.persister.cmds[len(db.persister.cmds)-1]
+	assert.Equal(t, []byte(database.CmdTypeSet), last[0])
+	assert.Equal(t, []byte("keepttl"), last[3])
+	assert.Equal(t, ":100\r\n", db.do("ttl", "hd"))
+	waitExpired()
+
+	replayed := db.replay(t)
+	assert.Equal(t, ":0\r\n", replayed.do("exists", "h1"))
+	assert.Equal(t, db.do("get", "hd"), replayed.do("get", "hd"))
+	assert.Equal(t, ":2\r\n", replayed.do("pfcount", "hd"))
+	assert.Equal(t, ":100\r\n", replayed.do("ttl", "hd"))
+}
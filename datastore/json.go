@@ -0,0 +1,677 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/AlphaMinZ/myredis_go/handler"
+)
+
+var (
+	errJSONNotNumber = errors.New("ERR expected value to be a number")
+	errJSONNotExist  = errors.New("ERR could not perform this operation on a key that doesn't exist")
+)
+
+func errJSONPathNotExist(path string) error {
+	return errors.New("ERR Path '" + path + "' does not exist")
+}
+
+func (k *KVStore) getAsJSON(key string) (JSON, error) {
+	v, ok := k.data[key]
+	if !ok {
+		return nil, nil
+	}
+
+	doc, ok := v.(JSON)
+	if !ok {
+		return nil, handler.NewWrongTypeErrReply()
+	}
+
+	return doc, nil
+}
+
+func (k *KVStore) putAsJSON(key string, doc JSON) {
+	k.putData(key, doc)
+}
+
+// 文档中的值为 *jsonObject、*jsonArray、string、int64、float64、bool 或 nil
+type JSON interface {
+	Get(path *jsonPath) []interface{}
+	Set(path *jsonPath, value interface{}, nx, xx bool) bool
+	Del(path *jsonPath) int64
+	Types(path *jsonPath) []string
+	ArrAppend(path *jsonPath, values []interface{}) []int64
+	NumIncrBy(path *jsonPath, delta interface{}) ([]interface{}, error)
+	ObjKeys(path *jsonPath) [][]string
+	database.CmdAdapter
+}
+
+// 保持成员的写入顺序
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newJSONObject() *jsonObject {
+	return &jsonObject{values: make(map[string]interface{})}
+}
+
+func (o *jsonObject) set(key string, v interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func (o *jsonObject) del(key string) {
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+type jsonArray struct {
+	elems []interface{}
+}
+
+type jsonEntity struct {
+	key  string
+	root interface{}
+}
+
+func newJSON(key string, root interface{}) JSON {
+	return &jsonEntity{key: key, root: root}
+}
+
+func (j *jsonEntity) Get(path *jsonPath) []interface{} {
+	nodes := path.eval(j.root)
+	values := make([]interface{}, 0, len(nodes))
+	for _, n := range nodes {
+		values = append(values, n.value)
+	}
+	return values
+}
+
+// 路径不存在时，若最后一级为成员名称且上一级为对象，则新增该成员. 返回是否写入
+func (j *jsonEntity) Set(path *jsonPath, value interface{}, nx, xx bool) bool {
+	if nodes := path.eval(j.root); len(nodes) > 0 {
+		if nx {
+			return false
+		}
+		// 多处写入时各自持有一份副本，避免后续修改相互影响
+		for i, n := range nodes {
+			if i > 0 {
+				value = copyJSON(value)
+			}
+			j.replace(n, value)
+		}
+		return true
+	}
+
+	last := path.segs[len(path.segs)-1]
+	if xx || last.kind != jsonSegName || last.recursive {
+		return false
+	}
+
+	var set bool
+	for _, n := range (&jsonPath{segs: path.segs[:len(path.segs)-1]}).eval(j.root) {
+		if obj, ok := n.value.(*jsonObject); ok {
+			if set {
+				value = copyJSON(value)
+			}
+			obj.set(last.name, value)
+			set = true
+		}
+	}
+	return set
+}
+
+func (j *jsonEntity) replace(n jsonNode, v interface{}) {
+	switch parent := n.parent.(type) {
+	case *jsonObject:
+		parent.values[n.key] = v
+	case *jsonArray:
+		parent.elems[n.index] = v
+	default:
+		j.root = v
+	}
+}
+
+// 删除根节点以外的匹配项，根节点由调用方删除整个 key
+func (j *jsonEntity) Del(path *jsonPath) int64 {
+	var cnt int64
+	indexes := make(map[*jsonArray][]int)
+	for _, n := range path.eval(j.root) {
+		switch parent := n.parent.(type) {
+		case *jsonObject:
+			parent.del(n.key)
+			cnt++
+		case *jsonArray:
+			indexes[parent] = append(indexes[parent], n.index)
+			cnt++
+		}
+	}
+
+	// 数组元素从后往前删除，避免下标偏移
+	for arr, idx := range indexes {
+		sort.Sort(sort.Reverse(sort.IntSlice(idx)))
+		for _, i := range idx {
+			arr.elems = append(arr.elems[:i], arr.elems[i+1:]...)
+		}
+	}
+	return cnt
+}
+
+func (j *jsonEntity) Types(path *jsonPath) []string {
+	nodes := path.eval(j.root)
+	types := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		types = append(types, jsonTypeOf(n.value))
+	}
+	return types
+}
+
+// 返回追加后的数组长度，非数组返回 -1
+func (j *jsonEntity) ArrAppend(path *jsonPath, values []interface{}) []int64 {
+	nodes := path.eval(j.root)
+	lens := make([]int64, 0, len(nodes))
+	var appended bool
+	for _, n := range nodes {
+		arr, ok := n.value.(*jsonArray)
+		if !ok {
+			lens = append(lens, -1)
+			continue
+		}
+		for _, v := range values {
+			if appended {
+				v = copyJSON(v)
+			}
+			arr.elems = append(arr.elems, v)
+		}
+		appended = true
+		lens = append(lens, int64(len(arr.elems)))
+	}
+	return lens
+}
+
+// 返回累加后的取值，非数字返回 nil. 任意结果溢出时不做任何修改
+func (j *jsonEntity) NumIncrBy(path *jsonPath, delta interface{}) ([]interface{}, error) {
+	nodes := path.eval(j.root)
+	res := make([]interface{}, 0, len(nodes))
+	for _, n := range nodes {
+		switch n.value.(type) {
+		case int64, float64:
+			v, err := jsonAdd(n.value, delta)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		default:
+			res = append(res, nil)
+		}
+	}
+
+	for i, n := range nodes {
+		if res[i] != nil {
+			j.replace(n, res[i])
+		}
+	}
+	return res, nil
+}
+
+// 两个整数相加且不溢出时结果为整数，否则为浮点数
+func jsonAdd(a, b interface{}) (interface{}, error) {
+	ai, aInt := a.(int64)
+	bi, bInt := b.(int64)
+	if aInt && bInt {
+		if sum := ai + bi; (sum > ai) == (bi > 0) {
+			return sum, nil
+		}
+	}
+
+	sum := jsonFloat(a) + jsonFloat(b)
+	if math.IsInf(sum, 0) || math.IsNaN(sum) {
+		return nil, errors.New("ERR result is not a number or an infinity")
+	}
+	return sum, nil
+}
+
+func jsonFloat(v interface{}) float64 {
+	if i, ok := v.(int64); ok {
+		return float64(i)
+	}
+	return v.(float64)
+}
+
+// 非对象返回 nil
+func (j *jsonEntity) ObjKeys(path *jsonPath) [][]string {
+	nodes := path.eval(j.root)
+	keys := make([][]string, 0, len(nodes))
+	for _, n := range nodes {
+		obj, ok := n.value.(*jsonObject)
+		if !ok {
+			keys = append(keys, nil)
+			continue
+		}
+		keys = append(keys, append(make([]string, 0, len(obj.keys)), obj.keys...))
+	}
+	return keys
+}
+
+func (j *jsonEntity) Encoding() string {
+	return "raw"
+}
+
+func (j *jsonEntity) setKey(key string) {
+	j.key = key
+}
+
+// 以整个文档的 json.set 重写
+func (j *jsonEntity) ToCmd() [][]byte {
+	return [][]byte{[]byte(database.CmdTypeJSONSet), []byte(j.key), []byte("$"), marshalJSON(j.root, nil)}
+}
+
+func jsonTypeOf(v interface{}) string {
+	switch v.(type) {
+	case *jsonObject:
+		return "object"
+	case *jsonArray:
+		return "array"
+	case string:
+		return "string"
+	case int64:
+		return "integer"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+func copyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *jsonObject:
+		obj := newJSONObject()
+		for _, key := range v.keys {
+			obj.set(key, copyJSON(v.values[key]))
+		}
+		return obj
+	case *jsonArray:
+		arr := jsonArray{elems: make([]interface{}, 0, len(v.elems))}
+		for _, e := range v.elems {
+			arr.elems = append(arr.elems, copyJSON(e))
+		}
+		return &arr
+	default:
+		return v
+	}
+}
+
+// 借助 json.Decoder 逐个读取 token，从而保持对象成员的顺序
+func parseJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeJSON(dec)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			return v, nil
+		}
+		if err == nil {
+			err = errors.New("trailing characters")
+		}
+	}
+	return nil, errors.New("ERR invalid JSON: " + err.Error())
+}
+
+func decodeJSON(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			obj := newJSONObject()
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj.set(key.(string), v)
+			}
+			_, err = dec.Token()
+			return obj, err
+		}
+
+		var arr jsonArray
+		for dec.More() {
+			v, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr.elems = append(arr.elems, v)
+		}
+		_, err = dec.Token()
+		return &arr, err
+	case json.Number:
+		return parseJSONNumber(t.String())
+	default:
+		return t, nil
+	}
+}
+
+// 不含小数点以及指数的数字解析为整数，超出 int64 范围时解析为浮点数
+func parseJSONNumber(s string) (interface{}, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return nil, errors.New("number out of range")
+	}
+	return f, nil
+}
+
+// json.get 的格式选项，为 nil 时输出紧凑格式
+type jsonFormat struct {
+	indent  string
+	newline string
+	space   string
+}
+
+func marshalJSON(v interface{}, f *jsonFormat) []byte {
+	if f == nil {
+		f = &jsonFormat{}
+	}
+	var buf bytes.Buffer
+	writeJSON(&buf, v, f, 0)
+	return buf.Bytes()
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}, f *jsonFormat, depth int) {
+	switch v := v.(type) {
+	case *jsonObject:
+		if len(v.keys) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteByte('{')
+		for i, key := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(f.newline)
+			buf.WriteString(strings.Repeat(f.indent, depth+1))
+			writeJSONString(buf, key)
+			buf.WriteByte(':')
+			buf.WriteString(f.space)
+			writeJSON(buf, v.values[key], f, depth+1)
+		}
+		buf.WriteString(f.newline)
+		buf.WriteString(strings.Repeat(f.indent, depth))
+		buf.WriteByte('}')
+	case *jsonArray:
+		if len(v.elems) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		buf.WriteByte('[')
+		for i, e := range v.elems {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(f.newline)
+			buf.WriteString(strings.Repeat(f.indent, depth+1))
+			writeJSON(buf, e, f, depth+1)
+		}
+		buf.WriteString(f.newline)
+		buf.WriteString(strings.Repeat(f.indent, depth))
+		buf.WriteByte(']')
+	case string:
+		writeJSONString(buf, v)
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(formatJSONFloat(v))
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	default:
+		buf.WriteString("null")
+	}
+}
+
+// 浮点数总是带有小数点或指数，保证重新解析后仍为浮点数
+func formatJSONFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			buf.WriteString(`\"`)
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20:
+			buf.WriteString(`\u00`)
+			buf.WriteByte("0123456789abcdef"[r>>4])
+			buf.WriteByte("0123456789abcdef"[r&0xf])
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+const (
+	jsonSegName = iota
+	jsonSegIndex
+	jsonSegWildcard
+)
+
+type jsonPathSeg struct {
+	kind      int
+	name      string
+	index     int
+	recursive bool // 匹配自身以及全部后代节点的子节点
+}
+
+// 支持 JSONPath 的子集：$、.name、['name']、[index]、[*]、.* 以及 ..name 形式的递归查找.
+// 不以 $ 开头的为 legacy 路径，如 . 或 a.b，只返回首个匹配项
+type jsonPath struct {
+	raw    string
+	legacy bool
+	segs   []jsonPathSeg
+}
+
+func parseJSONPath(raw string) (*jsonPath, error) {
+	p := jsonPath{raw: raw}
+	rest := raw
+	switch {
+	case strings.HasPrefix(raw, "$"):
+		rest = raw[1:]
+	case raw == ".":
+		p.legacy, rest = true, ""
+	case strings.HasPrefix(raw, ".") || strings.HasPrefix(raw, "["):
+		p.legacy = true
+	default:
+		p.legacy, rest = true, "."+raw
+	}
+
+	errInvalid := errors.New("ERR invalid JSON path '" + raw + "'")
+	for len(rest) > 0 {
+		var seg jsonPathSeg
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			seg.recursive, rest = true, rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case rest[0] == '.':
+			if !seg.recursive {
+				rest = rest[1:]
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, errInvalid
+			}
+			if seg.name, rest = rest[:end], rest[end:]; seg.name == "*" {
+				seg.kind = jsonSegWildcard
+			}
+			p.segs = append(p.segs, seg)
+			continue
+		case rest[0] != '[':
+			return nil, errInvalid
+		}
+
+		// [*]、['name'] 或者 [index]
+		end := strings.IndexByte(rest, ']')
+		switch {
+		case strings.HasPrefix(rest, "[*]"):
+			seg.kind, rest = jsonSegWildcard, rest[3:]
+		case strings.HasPrefix(rest, "['") || strings.HasPrefix(rest, `["`):
+			name, n, ok := parseJSONPathQuoted(rest[1:])
+			if !ok || !strings.HasPrefix(rest[1+n:], "]") {
+				return nil, errInvalid
+			}
+			seg.name, rest = name, rest[2+n:]
+		case end > 0:
+			index, err := strconv.Atoi(strings.TrimSpace(rest[1:end]))
+			if err != nil {
+				return nil, errInvalid
+			}
+			seg.kind, seg.index, rest = jsonSegIndex, index, rest[end+1:]
+		default:
+			return nil, errInvalid
+		}
+		p.segs = append(p.segs, seg)
+	}
+	return &p, nil
+}
+
+// 解析以单引号或双引号包裹的成员名称，返回名称以及消耗的字节数
+func parseJSONPathQuoted(s string) (string, int, bool) {
+	quote := s[0]
+	var name strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case quote:
+			return name.String(), i + 1, true
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+		}
+		name.WriteByte(s[i])
+	}
+	return "", 0, false
+}
+
+// 匹配到的节点以及其在父节点中的位置，根节点的 parent 为 nil
+type jsonNode struct {
+	value  interface{}
+	parent interface{}
+	key    string
+	index  int
+}
+
+func (p *jsonPath) eval(root interface{}) []jsonNode {
+	nodes := []jsonNode{{value: root}}
+	for _, seg := range p.segs {
+		var next []jsonNode
+		for _, n := range nodes {
+			if !seg.recursive {
+				next = seg.match(n, next)
+				continue
+			}
+			for _, d := range jsonDescendants(n, nil) {
+				next = seg.match(d, next)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// 先序遍历返回自身以及全部后代节点
+func jsonDescendants(n jsonNode, res []jsonNode) []jsonNode {
+	res = append(res, n)
+	switch v := n.value.(type) {
+	case *jsonObject:
+		for _, key := range v.keys {
+			res = jsonDescendants(jsonNode{value: v.values[key], parent: v, key: key}, res)
+		}
+	case *jsonArray:
+		for i, e := range v.elems {
+			res = jsonDescendants(jsonNode{value: e, parent: v, index: i}, res)
+		}
+	}
+	return res
+}
+
+func (s *jsonPathSeg) match(n jsonNode, res []jsonNode) []jsonNode {
+	switch v := n.value.(type) {
+	case *jsonObject:
+		switch s.kind {
+		case jsonSegWildcard:
+			for _, key := range v.keys {
+				res = append(res, jsonNode{value: v.values[key], parent: v, key: key})
+			}
+		case jsonSegName:
+			if child, ok := v.values[s.name]; ok {
+				res = append(res, jsonNode{value: child, parent: v, key: s.name})
+			}
+		}
+	case *jsonArray:
+		switch s.kind {
+		case jsonSegWildcard:
+			for i, e := range v.elems {
+				res = append(res, jsonNode{value: e, parent: v, index: i})
+			}
+		case jsonSegIndex:
+			// 负数下标从末尾开始计数
+			i := s.index
+			if i < 0 {
+				i += len(v.elems)
+			}
+			if i >= 0 && i < len(v.elems) {
+				res = append(res, jsonNode{value: v.elems[i], parent: v, index: i})
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,130 @@
+package datastore
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/AlphaMinZ/myredis_go/lib"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_json_marshal(t *testing.T) {
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+
+	// 随机生成嵌套的文档，序列化后重新解析的结果保持一致
+	var gen func(depth int) interface{}
+	gen = func(depth int) interface{} {
+		switch n := rander.Intn(8); {
+		case n == 0 && depth < 4:
+			obj := newJSONObject()
+			for i := rander.Intn(5); i > 0; i-- {
+				obj.set("k"+cast.ToString(rander.Intn(10)), gen(depth+1))
+			}
+			return obj
+		case n == 1 && depth < 4:
+			var arr jsonArray
+			for i := rander.Intn(5); i > 0; i-- {
+				arr.elems = append(arr.elems, gen(depth+1))
+			}
+			return &arr
+		case n == 2:
+			return string(rune(rander.Intn(0x80))) + "\"\\\n" + cast.ToString(rander.Int63())
+		case n == 3:
+			return rander.Int63() - rander.Int63()
+		case n == 4:
+			return rander.NormFloat64() * math.Pow10(rander.Intn(40)-20)
+		case n == 5:
+			return rander.Intn(2) == 0
+		default:
+			return nil
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		doc := gen(0)
+		b := marshalJSON(doc, nil)
+		parsed, err := parseJSON(b)
+		assert.Nil(t, err)
+		assert.Equal(t, string(b), string(marshalJSON(parsed, nil)))
+		assert.Equal(t, string(b), string(marshalJSON(copyJSON(doc), nil)))
+	}
+
+	_, err := parseJSON([]byte(`{"a":1} 2`))
+	assert.NotNil(t, err)
+	_, err = parseJSON([]byte(`[1,`))
+	assert.NotNil(t, err)
+}
+
+func Test_json_path(t *testing.T) {
+	root, _ := parseJSON([]byte(`{"a":{"b":[1,{"b":2}],"c":"x"},"b":true,"d e":null}`))
+	doc := newJSON("doc", root)
+
+	get := func(raw string) string {
+		path, err := parseJSONPath(raw)
+		assert.Nil(t, err)
+		return string(marshalJSON(&jsonArray{elems: doc.Get(path)}, nil))
+	}
+	assert.Equal(t, `[{"a":{"b":[1,{"b":2}],"c":"x"},"b":true,"d e":null}]`, get("$"))
+	assert.Equal(t, get("$"), get("."))
+	assert.Equal(t, `["x"]`, get("a.c"))
+	assert.Equal(t, `[1]`, get("$.a.b[0]"))
+	assert.Equal(t, `[{"b":2}]`, get("$.a.b[-1]"))
+	assert.Equal(t, `[]`, get("$.a.b[2]"))
+	assert.Equal(t, `[null]`, get("$['d e']"))
+	assert.Equal(t, `[[1,{"b":2}],"x"]`, get("$.a.*"))
+	assert.Equal(t, `[true,[1,{"b":2}],2]`, get("$..b"))
+	assert.Equal(t, `[1,{"b":2}]`, get("$..b[*]"))
+
+	for _, raw := range []string{"$.", "$[", "$['a'", "$[x]", "$a", "$.a..", "$.."} {
+		_, err := parseJSONPath(raw)
+		assert.NotNil(t, err, raw)
+	}
+}
+
+func Test_json_update(t *testing.T) {
+	root, _ := parseJSON([]byte(`{"a":[1,2,3,4],"b":{"n":1},"c":{"n":1.5}}`))
+	doc := newJSON("doc", root)
+	path := func(raw string) *jsonPath {
+		p, err := parseJSONPath(raw)
+		assert.Nil(t, err)
+		return p
+	}
+
+	t.Run("set", func(t *testing.T) {
+		assert.False(t, doc.Set(path("$.b.n"), int64(2), true, false))
+		assert.False(t, doc.Set(path("$.b.m"), int64(2), false, true))
+		assert.False(t, doc.Set(path("$.x.m"), int64(2), false, false))
+		assert.True(t, doc.Set(path("$.*.m"), newJSONObject(), false, false))
+
+		// 多处写入的值互不影响
+		assert.True(t, doc.Set(path("$.b.m.k"), "v", false, false))
+		assert.Equal(t, []interface{}{"v"}, doc.Get(path("$..k")))
+	})
+
+	t.Run("numincrby", func(t *testing.T) {
+		res, err := doc.NumIncrBy(path("$..n"), int64(1))
+		assert.Nil(t, err)
+		assert.Equal(t, []interface{}{int64(2), 2.5}, res)
+
+		_, err = doc.NumIncrBy(path("$.b.n"), int64(math.MaxInt64))
+		assert.Nil(t, err)
+		assert.Equal(t, []interface{}{float64(math.MaxInt64) + 2}, doc.Get(path("$.b.n")))
+
+		// 任意结果溢出时不做任何修改
+		assert.True(t, doc.Set(path("$.c.n"), math.MaxFloat64, false, false))
+		_, err = doc.NumIncrBy(path("$..n"), math.MaxFloat64)
+		assert.NotNil(t, err)
+		assert.Equal(t, []interface{}{float64(math.MaxInt64) + 2, math.MaxFloat64}, doc.Get(path("$..n")))
+	})
+
+	t.Run("arrappend and del", func(t *testing.T) {
+		assert.Equal(t, []int64{6, -1, -1}, doc.ArrAppend(path("$.*"), []interface{}{int64(5), int64(6)}))
+		assert.Equal(t, int64(2), doc.Del(path("$..m")))
+		assert.Equal(t, int64(1), doc.Del(path("$.a[-1]")))
+		assert.Equal(t, int64(5), doc.Del(path("$.a[*]")))
+		assert.Equal(t, `{"a":[],"b":{"n":9.223372036854776e+18},"c":{"n":1.7976931348623157e+308}}`,
+			string(marshalJSON(doc.Get(path("$"))[0], nil)))
+	})
+}
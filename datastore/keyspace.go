@@ -0,0 +1,103 @@
+package datastore
+
+// 数据实体内部会记录 key，用于 ToCmd 生成持久化指令. rename 时需要同步更新
+type keyHolder interface {
+	setKey(key string)
+}
+
+// 数据实体的内部编码，用于 object encoding 指令
+type encoder interface {
+	Encoding() string
+}
+
+// 写入数据，新增的 key 需要同步到 scan 索引中
+func (k *KVStore) putData(key string, v interface{}) {
+	if _, ok := k.data[key]; !ok {
+		k.keys.add(key)
+		k.readyKeys = append(k.readyKeys, key)
+	}
+	k.data[key] = v
+}
+
+// 阻塞的 pop 类指令只会在 key 不存在时挂起，因此新增的 key 即为可能唤醒阻塞指令的 key.
+// xread 等指令会在 key 存在时挂起，需要通过 signalReady 显式通知
+func (k *KVStore) ReadyKeys() []string {
+	keys := k.readyKeys
+	k.readyKeys = nil
+	return keys
+}
+
+func (k *KVStore) signalReady(key string) {
+	k.readyKeys = append(k.readyKeys, key)
+}
+
+func (k *KVStore) exist(key string) bool {
+	k.ExpirePreprocess(key)
+	_, ok := k.data[key]
+	return ok
+}
+
+// 移除 key 及其过期信息
+func (k *KVStore) del(key string) int64 {
+	if _, ok := k.data[key]; !ok {
+		return 0
+	}
+	k.expireProcess(key)
+	return 1
+}
+
+// 将 src 的数据连同过期时间一并迁移到 dst，dst 原有数据会被覆盖
+func (k *KVStore) rename(src, dst string) {
+	v := k.data[src]
+	expiredAt, ok := k.expiredAt[src]
+
+	k.del(src)
+	k.del(dst)
+
+	if holder, _ := v.(keyHolder); holder != nil {
+		holder.setKey(dst)
+	}
+	k.putData(dst, v)
+	if ok {
+		k.expire(dst, expiredAt)
+	}
+	if hmap, _ := v.(HashMap); hmap != nil {
+		k.trackVolatileHash(dst, hmap)
+	}
+}
+
+func (k *KVStore) typeOf(key string) string {
+	switch k.data[key].(type) {
+	case String:
+		return "string"
+	case List:
+		return "list"
+	case Set:
+		return "set"
+	case HashMap:
+		return "hash"
+	case SortedSet:
+		return "zset"
+	case Stream:
+		return "stream"
+	case BloomFilter:
+		return "MBbloom--"
+	case CuckooFilter:
+		return "MBbloomCF"
+	case CountMinSketch:
+		return "CMSk-TYPE"
+	case TopK:
+		return "TopK-TYPE"
+	case JSON:
+		return "ReJSON-RL"
+	default:
+		return "none"
+	}
+}
+
+func (k *KVStore) encodingOf(key string) string {
+	if enc, _ := k.data[key].(encoder); enc != nil {
+		return enc.Encoding()
+	}
+	return "unknown"
+}
@@ -0,0 +1,71 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_keyspace_del_rename_replay(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, "+OK\r\n", db.do("set", "a", "1"))
+	assert.Equal(t, "+OK\r\n", db.do("set", "b", "2"))
+	assert.Equal(t, ":1\r\n", db.do("rpush", "c", "x"))
+	assert.Equal(t, ":1\r\n", db.do("expire", "a", "100"))
+	assert.Equal(t, ":1\r\n", db.do("expire", "b", "100"))
+
+	t.Run("del", func(t *testing.T) {
+		assert.Equal(t, ":1\r\n", db.do("del", "b", "none"))
+		assert.Equal(t, ":0\r\n", db.do("del", "none"))
+
+		// 重新写入的 key 不保留删除前的过期时间
+		assert.Equal(t, "+OK\r\n", db.do("set", "b", "3"))
+		assert.Equal(t, ":-1\r\n", db.do("ttl", "b"))
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		// 过期时间随 key 一同迁移，dst 原有的数据被覆盖
+		assert.Equal(t, "+OK\r\n", db.do("rename", "a", "c"))
+		assert.Equal(t, ":0\r\n", db.do("exists", "a"))
+		assert.Equal(t, "+string\r\n", db.do("type", "c"))
+		assert.Equal(t, ":100\r\n", db.do("ttl", "c"))
+		assert.Equal(t, "-ERR no such key\r\n", db.do("rename", "a", "c"))
+
+		assert.Equal(t, ":0\r\n", db.do("renamenx", "b", "c"))
+		assert.Equal(t, ":1\r\n", db.do("renamenx", "b", "d"))
+		assert.Equal(t, ":2\r\n", db.do("dbsize"))
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		replayed := db.replay(t)
+		assert.Equal(t, ":2\r\n", replayed.do("dbsize"))
+		assert.Equal(t, ":0\r\n", replayed.do("exists", "a", "b"))
+		assert.Equal(t, "$1\r\n1\r\n", replayed.do("get", "c"))
+		assert.Equal(t, ":100\r\n", replayed.do("ttl", "c"))
+		assert.Equal(t, "$1\r\n3\r\n", replayed.do("get", "d"))
+		assert.Equal(t, ":-1\r\n", replayed.do("ttl", "d"))
+	})
+}
+
+func Test_rename_replay_after_src_expired(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, "+OK\r\n", db.do("set", "a", "1"))
+	assert.Equal(t, ":2\r\n", db.do("hset", "h", "f1", "v1", "f2", "v2"))
+	assert.Equal(t, "*1\r\n:1\r\n", db.do("hexpire", "h", "100", "FIELDS", "1", "f1"))
+	db.expireSoon(t, "a", "h")
+
+	// 重命名后移除过期时间，重放时 src 已经过期
+	assert.Equal(t, "+OK\r\n", db.do("rename", "a", "b"))
+	assert.Equal(t, ":1\r\n", db.do("renamenx", "h", "h2"))
+	assert.Equal(t, ":1\r\n", db.do("persist", "b"))
+	assert.Equal(t, ":1\r\n", db.do("persist", "h2"))
+	waitExpired()
+
+	replayed := db.replay(t)
+	assert.Equal(t, ":0\r\n", replayed.do("exists", "a", "h"))
+	assert.Equal(t, "$1\r\n1\r\n", replayed.do("get", "b"))
+	assert.Equal(t, ":-1\r\n", replayed.do("ttl", "b"))
+	assert.Equal(t, "*2\r\n$2\r\nv1\r\n$2\r\nv2\r\n", replayed.do("hmget", "h2", "f1", "f2"))
+	assert.Equal(t, ":2\r\n", replayed.do("hlen", "h2"))
+	assert.Equal(t, "*2\r\n:100\r\n:-1\r\n", replayed.do("httl", "h2", "FIELDS", "2", "f1", "f2"))
+}
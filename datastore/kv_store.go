@@ -2,6 +2,8 @@ package datastore
 
 import (
 	"context"
+	"errors"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -14,56 +16,352 @@ import (
 type KVStore struct {
 	data      map[string]interface{}
 	expiredAt map[string]time.Time
+	keys      *scanIndex
+	// 新写入数据的 key，用于唤醒阻塞指令
+	readyKeys []string
 
 	expireTimeWheel SortedSet
+	// 存在 field 设置了过期时间的 hash，用于主动回收过期的 field
+	volatileHashes map[string]struct{}
+
+	// set 采用 intset 编码的元素个数上限
+	maxIntsetEntries int
+
+	// 正在重放 aof，此期间不回收过期数据
+	loading bool
 
 	persister handler.Persister
 }
 
-func NewKVStore(persister handler.Persister) database.DataStore {
-	return &KVStore{
-		data:            make(map[string]interface{}),
-		expiredAt:       make(map[string]time.Time),
-		expireTimeWheel: newSkiplist("expireTimeWheel"),
-		persister:       persister,
+// 存储相关的配置项
+type Thinker interface {
+	SetMaxIntsetEntries() int
+}
+
+func NewKVStore(persister handler.Persister, thinker Thinker) database.DataStore {
+	k := KVStore{
+		data:             make(map[string]interface{}),
+		expiredAt:        make(map[string]time.Time),
+		keys:             newScanIndex(),
+		expireTimeWheel:  newSkiplist("expireTimeWheel"),
+		volatileHashes:   make(map[string]struct{}),
+		maxIntsetEntries: defaultMaxIntsetEntries,
+		persister:        persister,
+	}
+	if thinker != nil && thinker.SetMaxIntsetEntries() > 0 {
+		k.maxIntsetEntries = thinker.SetMaxIntsetEntries()
+	}
+	return &k
+}
+
+// keyspace
+func (k *KVStore) Del(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	var deleted int64
+	for _, arg := range args {
+		key := string(arg)
+		k.ExpirePreprocess(key)
+		deleted += k.del(key)
+	}
+
+	if deleted > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewIntReply(deleted)
+}
+
+func (k *KVStore) Exists(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	var existed int64
+	for _, arg := range args {
+		if k.exist(string(arg)) {
+			existed++
+		}
+	}
+	return handler.NewIntReply(existed)
+}
+
+func (k *KVStore) Type(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+	return handler.NewSimpleStringReply(k.typeOf(string(args[0])))
+}
+
+func (k *KVStore) Rename(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	src, dst := string(args[0]), string(args[1])
+	if !k.exist(src) {
+		return handler.NewErrReply("ERR no such key")
+	}
+	k.ExpirePreprocess(dst)
+
+	k.rename(src, dst)
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewOKReply()
+}
+
+func (k *KVStore) RenameNx(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	src, dst := string(args[0]), string(args[1])
+	if !k.exist(src) {
+		return handler.NewErrReply("ERR no such key")
+	}
+	if k.exist(dst) {
+		return handler.NewIntReply(0)
+	}
+
+	k.rename(src, dst)
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(1)
+}
+
+func (k *KVStore) RandomKey(cmd *database.Command) handler.Reply {
+	// map 遍历顺序本身是随机的，遇到已过期的 key 顺带回收
+	for key := range k.data {
+		if !k.exist(key) {
+			continue
+		}
+		return handler.NewBulkReply([]byte(key))
+	}
+	return handler.NewNillReply()
+}
+
+func (k *KVStore) DBSize(cmd *database.Command) handler.Reply {
+	return handler.NewIntReply(int64(len(k.data)))
+}
+
+func (k *KVStore) Keys(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	pattern := string(args[0])
+	keys := make([][]byte, 0)
+	for key := range k.data {
+		if !lib.GlobMatch(pattern, key) || !k.exist(key) {
+			continue
+		}
+		keys = append(keys, []byte(key))
+	}
+	return handler.NewMultiBulkReply(keys)
+}
+
+func (k *KVStore) Scan(cmd *database.Command) handler.Reply {
+	scan, err := parseScanArgs(cmd.Args(), true)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	cursor, keys := k.keys.scan(scan.cursor, scan.count)
+	res := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if !lib.GlobMatch(scan.pattern, key) || !k.exist(key) {
+			continue
+		}
+		if scan.typ != "" && k.typeOf(key) != scan.typ {
+			continue
+		}
+		res = append(res, []byte(key))
+	}
+	return scanReply(cursor, res)
+}
+
+// object encoding key
+func (k *KVStore) Object(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 || !strings.EqualFold(string(args[0]), "encoding") {
+		return handler.NewErrReply("ERR unknown subcommand or wrong number of arguments for 'object' command")
+	}
+
+	// executor 只会对首个参数做过期预处理
+	key := string(args[1])
+	k.ExpirePreprocess(key)
+	if !k.exist(key) {
+		return handler.NewNillReply()
 	}
+	return handler.NewBulkReply([]byte(k.encodingOf(key)))
 }
 
 // expire
 func (k *KVStore) Expire(cmd *database.Command) handler.Reply {
+	return k.expireAfter(cmd, time.Second)
+}
+
+func (k *KVStore) PExpire(cmd *database.Command) handler.Reply {
+	return k.expireAfter(cmd, time.Millisecond)
+}
+
+func (k *KVStore) ExpireAt(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
-	key := string(args[0])
-	ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
-	if err != nil {
+	if len(args) < 2 {
 		return handler.NewSyntaxErrReply()
 	}
-	if ttl <= 0 {
+
+	unix, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		// 兼容旧版本 aof 文件中 YYYY-MM-DD HH:MM:SS 格式的过期时间
+		expiredAt, err := lib.ParseTimeSecondFormat(string(args[1]))
+		if err != nil {
+			return handler.NewSyntaxErrReply()
+		}
+		return k.expireAt(cmd.Ctx(), string(args[0]), expiredAt, args[2:])
+	}
+
+	if unix > math.MaxInt64/1000 || unix < math.MinInt64/1000 {
 		return handler.NewErrReply("ERR invalid expire time")
 	}
+	return k.expireAt(cmd.Ctx(), string(args[0]), time.UnixMilli(unix*1000), args[2:])
+}
+
+func (k *KVStore) PExpireAt(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
 
-	expireAt := lib.TimeNow().Add(time.Duration(ttl) * time.Second)
-	_cmd := [][]byte{[]byte(database.CmdTypeExpireAt), []byte(key), []byte(lib.TimeSecondFormat(expireAt))}
-	return k.expireAt(cmd.Ctx(), _cmd, key, expireAt)
+	unixMilli, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return handler.NewSyntaxErrReply()
+	}
+	return k.expireAt(cmd.Ctx(), string(args[0]), time.UnixMilli(unixMilli), args[2:])
 }
 
-func (k *KVStore) ExpireAt(cmd *database.Command) handler.Reply {
+func (k *KVStore) Persist(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
 	key := string(args[0])
-	expiredAt, err := lib.ParseTimeSecondFormat(string((args[1])))
+	if !k.exist(key) || !k.persist(key) {
+		return handler.NewIntReply(0)
+	}
+
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(1)
+}
+
+func (k *KVStore) TTL(cmd *database.Command) handler.Reply {
+	return k.ttl(cmd, func(ttl time.Duration) int64 {
+		// 与 redis 保持一致，秒级别四舍五入
+		return int64((ttl + 500*time.Millisecond) / time.Second)
+	})
+}
+
+func (k *KVStore) PTTL(cmd *database.Command) handler.Reply {
+	return k.ttl(cmd, func(ttl time.Duration) int64 {
+		return ttl.Milliseconds()
+	})
+}
+
+func (k *KVStore) ExpireTime(cmd *database.Command) handler.Reply {
+	return k.expireTime(cmd, func(expiredAt time.Time) int64 {
+		return expiredAt.Unix()
+	})
+}
+
+func (k *KVStore) PExpireTime(cmd *database.Command) handler.Reply {
+	return k.expireTime(cmd, func(expiredAt time.Time) int64 {
+		return expiredAt.UnixMilli()
+	})
+}
+
+// 以相对时间设置过期，unit 为 ttl 的时间单位
+func (k *KVStore) expireAfter(cmd *database.Command, unit time.Duration) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
 	if err != nil {
 		return handler.NewSyntaxErrReply()
 	}
-	if expiredAt.Before(lib.TimeNow()) {
+
+	// 避免 duration 溢出
+	if ttl > math.MaxInt64/int64(unit) || ttl < math.MinInt64/int64(unit) {
 		return handler.NewErrReply("ERR invalid expire time")
 	}
 
-	return k.expireAt(cmd.Ctx(), cmd.Cmd(), key, expiredAt)
+	expireAt := lib.TimeNow().Add(time.Duration(ttl) * unit)
+	return k.expireAt(cmd.Ctx(), string(args[0]), expireAt, args[2:])
 }
 
-func (k *KVStore) expireAt(ctx context.Context, cmd [][]byte, key string, expireAt time.Time) handler.Reply {
+// 过期时间统一以 pexpireat 的形式持久化，与时区无关. 过期时间早于当前时间时，直接删除 key.
+// 重放 aof 时只记录过期时间，见 SetLoading
+func (k *KVStore) expireAt(ctx context.Context, key string, expireAt time.Time, flags [][]byte) handler.Reply {
+	strategy, err := parseExpireStrategy(flags)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if !k.exist(key) {
+		return handler.NewIntReply(0)
+	}
+
+	current, volatile := k.expiredAt[key]
+	if !strategy.allow(current, volatile, expireAt) {
+		return handler.NewIntReply(0)
+	}
+
+	if !k.loading && !expireAt.After(lib.TimeNow()) {
+		k.del(key)
+		k.persister.PersistCmd(ctx, [][]byte{[]byte(database.CmdTypeDel), []byte(key)}) // 持久化
+		return handler.NewIntReply(1)
+	}
+
 	k.expire(key, expireAt)
-	k.persister.PersistCmd(ctx, cmd) // 持久化
-	return handler.NewOKReply()
+	k.persister.PersistCmd(ctx, pexpireAtCmd(key, expireAt)) // 持久化
+	return handler.NewIntReply(1)
+}
+
+func (k *KVStore) ttl(cmd *database.Command, format func(ttl time.Duration) int64) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	if !k.exist(key) {
+		return handler.NewIntReply(-2)
+	}
+
+	expiredAt, ok := k.expiredAt[key]
+	if !ok {
+		return handler.NewIntReply(-1)
+	}
+
+	return handler.NewIntReply(format(expiredAt.Sub(lib.TimeNow())))
+}
+
+func (k *KVStore) expireTime(cmd *database.Command, format func(expiredAt time.Time) int64) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	if !k.exist(key) {
+		return handler.NewIntReply(-2)
+	}
+
+	expiredAt, ok := k.expiredAt[key]
+	if !ok {
+		return handler.NewIntReply(-1)
+	}
+
+	return handler.NewIntReply(format(expiredAt))
 }
 
 // string
@@ -98,69 +396,102 @@ func (k *KVStore) MGet(cmd *database.Command) handler.Reply {
 	return handler.NewMultiBulkReply(res)
 }
 
+// set key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
 func (k *KVStore) Set(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
 	key := string(args[0])
 	value := string(args[1])
 
-	// 支持 NX EX
 	var (
-		insertStrategy bool
-		ttlStrategy    bool
-		ttlSeconds     int64
-		ttlIndex       = -1
+		nx, xx, get, keepTTL bool
+		ttlStrategy          bool
+		expireAt             time.Time
 	)
 
 	for i := 2; i < len(args); i++ {
 		flag := strings.ToLower(string(args[i]))
 		switch flag {
 		case "nx":
-			insertStrategy = true
-		case "ex":
-			// 重复的 ex 指令
-			if ttlStrategy {
+			if xx {
 				return handler.NewSyntaxErrReply()
 			}
-			if i == len(args)-1 {
+			nx = true
+		case "xx":
+			if nx {
 				return handler.NewSyntaxErrReply()
 			}
-			ttl, err := strconv.ParseInt(string(args[i+1]), 10, 64)
-			if err != nil {
+			xx = true
+		case "get":
+			get = true
+		case "keepttl":
+			if ttlStrategy {
+				return handler.NewSyntaxErrReply()
+			}
+			keepTTL = true
+		case "ex", "px", "exat", "pxat":
+			// 过期选项之间、以及与 keepttl 互斥
+			if ttlStrategy || keepTTL || i == len(args)-1 {
 				return handler.NewSyntaxErrReply()
 			}
-			if ttl <= 0 {
-				return handler.NewErrReply("ERR invalid expire time")
+			var err error
+			if expireAt, err = parseExpireOption(flag, args[i+1]); err != nil {
+				return handler.NewErrReply(err.Error())
 			}
-
 			ttlStrategy = true
-			ttlSeconds = ttl
-			ttlIndex = i
 			i++
 		default:
 			return handler.NewSyntaxErrReply()
 		}
 	}
 
-	// 将 args 剔除 ex 部分，进行持久化
-	if ttlIndex != -1 {
-		args = append(args[:ttlIndex], args[ttlIndex+2:]...)
+	// get 模式下需要返回旧值，旧值必须为 string 类型
+	var reply handler.Reply = handler.NewOKReply()
+	if get {
+		old, err := k.getAsString(key)
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		if reply = handler.NewNillReply(); old != nil {
+			reply = handler.NewBulkReply(old.Bytes())
+		}
+	}
+
+	_, exist := k.data[key]
+	if (nx && exist) || (xx && !exist) {
+		if get {
+			return reply
+		}
+		return handler.NewNillReply()
 	}
 
-	// 设置
-	affected := k.put(key, value, insertStrategy)
-	if affected > 0 && ttlStrategy {
-		expireAt := lib.TimeNow().Add(time.Duration(ttlSeconds) * time.Second)
-		_cmd := [][]byte{[]byte(database.CmdTypeExpireAt), []byte(key), []byte(lib.TimeSecondFormat(expireAt))}
-		_ = k.expireAt(cmd.Ctx(), _cmd, key, expireAt) // 其中会完成 ex 信息的持久化
+	// 过期时间已经过去，等价于写入后立即过期
+	if ttlStrategy && !expireAt.After(lib.TimeNow()) {
+		if k.del(key) > 0 {
+			k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeDel), []byte(key)}) // 持久化
+		}
+		return reply
 	}
 
-	// 过期时间处理
-	if affected > 0 {
-		k.persister.PersistCmd(cmd.Ctx(), append([][]byte{[]byte(database.CmdTypeSet)}, args...))
-		return handler.NewIntReply(affected)
+	k.put(key, value)
+	_cmd := [][]byte{[]byte(database.CmdTypeSet), []byte(key), []byte(value)}
+	if keepTTL {
+		_cmd = append(_cmd, []byte("keepttl"))
+	} else {
+		// 覆盖写入时清除原有的过期时间
+		k.persist(key)
 	}
+	k.persister.PersistCmd(cmd.Ctx(), _cmd) // 持久化
 
-	return handler.NewNillReply()
+	if ttlStrategy {
+		k.expire(key, expireAt)
+		k.persister.PersistCmd(cmd.Ctx(), pexpireAtCmd(key, expireAt)) // 过期信息的持久化
+	}
+
+	return reply
 }
 
 func (k *KVStore) MSet(cmd *database.Command) handler.Reply {
@@ -170,406 +501,5580 @@ func (k *KVStore) MSet(cmd *database.Command) handler.Reply {
 	}
 
 	for i := 0; i < len(args); i += 2 {
-		_ = k.put(string(args[i]), string(args[i+1]), false)
+		key := string(args[i])
+		k.put(key, string(args[i+1]))
+		k.persist(key)
 	}
 
 	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd())
 	return handler.NewIntReply(int64(len(args) >> 1))
 }
 
-// list
-func (k *KVStore) LPush(cmd *database.Command) handler.Reply {
+func (k *KVStore) Incr(cmd *database.Command) handler.Reply {
+	return k.incrBy(cmd, 1)
+}
+
+func (k *KVStore) Decr(cmd *database.Command) handler.Reply {
+	return k.incrBy(cmd, -1)
+}
+
+func (k *KVStore) IncrBy(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
-	key := string(args[0])
-	list, err := k.getAsList(key)
-	if err != nil {
-		return handler.NewErrReply(err.Error())
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
 	}
 
-	if list == nil {
-		list = newListEntity(key)
-		k.putAsList(key, list)
+	delta, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
 	}
+	return k.incrBy(cmd, delta)
+}
 
-	for i := 1; i < len(args); i++ {
-		list.LPush(args[i])
+func (k *KVStore) DecrBy(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
 	}
 
-	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd())
-	return handler.NewIntReply(list.Len())
+	delta, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || delta == math.MinInt64 {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+	return k.incrBy(cmd, -delta)
 }
 
-func (k *KVStore) LPop(cmd *database.Command) handler.Reply {
+func (k *KVStore) IncrByFloat(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
 	key := string(args[0])
-	var cnt int64
-	if len(args) > 1 {
-		rawCnt, err := strconv.ParseInt(string(args[1]), 10, 64)
-		if err != nil {
-			return handler.NewSyntaxErrReply()
-		}
-		if rawCnt < 1 {
-			return handler.NewSyntaxErrReply()
-		}
-		cnt = rawCnt
+	delta, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return handler.NewErrReply(errNotFloat.Error())
 	}
 
-	list, err := k.getAsList(key)
+	str, err := k.getAsString(key)
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
 
-	if list == nil {
-		return handler.NewNillReply()
-	}
-
-	if cnt == 0 {
-		cnt = 1
-	}
-
-	poped := list.LPop(cnt)
-	if poped == nil {
-		return handler.NewNillReply()
+	if str == nil {
+		str = NewString(key, "0")
+		k.putData(key, str)
 	}
 
-	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
-
-	if len(poped) == 1 {
-		return handler.NewBulkReply(poped[0])
+	if _, err = str.IncrFloat(delta); err != nil {
+		return handler.NewErrReply(err.Error())
 	}
 
-	return handler.NewMultiBulkReply(poped)
+	// 浮点运算结果可能受平台影响，以 set 结果的形式进行持久化，并保留过期时间
+	res := str.Bytes()
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeSet), []byte(key), res, []byte("keepttl")})
+	return handler.NewBulkReply(res)
 }
 
-func (k *KVStore) RPush(cmd *database.Command) handler.Reply {
+func (k *KVStore) Append(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
 	key := string(args[0])
-	list, err := k.getAsList(key)
+	str, err := k.getAsString(key)
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
 
-	if list == nil {
-		list = newListEntity(key, args[1:]...)
-		k.putAsList(key, list)
-		return handler.NewIntReply(list.Len())
+	// 先完成长度校验，避免写入失败时残留空的 key
+	var length int64
+	if str != nil {
+		length = str.Len()
+	}
+	if length+int64(len(args[1])) > maxStringLen {
+		return handler.NewErrReply(errStringTooLong.Error())
 	}
 
-	for i := 1; i < len(args); i++ {
-		list.RPush(args[i])
+	if str == nil {
+		str = NewString(key, "")
+		k.putData(key, str)
 	}
 
+	length = str.Append(args[1])
 	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
-	return handler.NewIntReply(list.Len())
+	return handler.NewIntReply(length)
 }
 
-func (k *KVStore) RPop(cmd *database.Command) handler.Reply {
+func (k *KVStore) StrLen(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
-	key := string(args[0])
-	var cnt int64
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	str, err := k.getAsString(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if str == nil {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(str.Len())
+}
+
+func (k *KVStore) GetRange(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+	end, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+
+	str, err := k.getAsString(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if str == nil {
+		return handler.NewBulkReply([]byte{})
+	}
+	return handler.NewBulkReply(str.GetRange(start, end))
+}
+
+func (k *KVStore) SetRange(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+	if offset < 0 {
+		return handler.NewErrReply("ERR offset is out of range")
+	}
+
+	value := args[2]
+	if offset+int64(len(value)) > maxStringLen {
+		return handler.NewErrReply(errStringTooLong.Error())
+	}
+
+	str, err := k.getAsString(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if str == nil {
+		// 空值不会创建 key
+		if len(value) == 0 {
+			return handler.NewIntReply(0)
+		}
+		str = NewString(key, "")
+		k.putData(key, str)
+	}
+
+	if len(value) == 0 {
+		return handler.NewIntReply(str.Len())
+	}
+
+	length := str.SetRange(offset, value)
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(length)
+}
+
+func (k *KVStore) GetSet(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	str, err := k.getAsString(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// 与 set 一致，会清除原有的过期时间
+	k.put(key, string(args[1]))
+	k.persist(key)
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+
+	if str == nil {
+		return handler.NewNillReply()
+	}
+	return handler.NewBulkReply(str.Bytes())
+}
+
+func (k *KVStore) GetDel(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	str, err := k.getAsString(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if str == nil {
+		return handler.NewNillReply()
+	}
+
+	k.del(key)
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeDel), []byte(key)}) // 持久化
+	return handler.NewBulkReply(str.Bytes())
+}
+
+// getex key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+func (k *KVStore) GetEx(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	key := string(args[0])
+
+	var (
+		expireAt   time.Time
+		ttlChanged bool
+		persist    bool
+	)
+	for i := 1; i < len(args); i++ {
+		if ttlChanged || persist {
+			return handler.NewSyntaxErrReply()
+		}
+
+		option := strings.ToLower(string(args[i]))
+		switch option {
+		case "persist":
+			persist = true
+		case "ex", "px", "exat", "pxat":
+			if i == len(args)-1 {
+				return handler.NewSyntaxErrReply()
+			}
+			var err error
+			if expireAt, err = parseExpireOption(option, args[i+1]); err != nil {
+				return handler.NewErrReply(err.Error())
+			}
+			ttlChanged = true
+			i++
+		default:
+			return handler.NewSyntaxErrReply()
+		}
+	}
+
+	str, err := k.getAsString(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if str == nil {
+		return handler.NewNillReply()
+	}
+
+	reply := handler.NewBulkReply(str.Bytes())
+	switch {
+	case persist:
+		if k.persist(key) {
+			k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypePersist), []byte(key)}) // 持久化
+		}
+	case ttlChanged && !expireAt.After(lib.TimeNow()):
+		k.del(key)
+		k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeDel), []byte(key)}) // 持久化
+	case ttlChanged:
+		k.expire(key, expireAt)
+		k.persister.PersistCmd(cmd.Ctx(), pexpireAtCmd(key, expireAt)) // 持久化
+	}
+	return reply
+}
+
+func (k *KVStore) incrBy(cmd *database.Command, delta int64) handler.Reply {
+	key := string(cmd.Args()[0])
+	str, err := k.getAsString(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	created := str == nil
+	if created {
+		str = NewString(key, "0")
+	}
+
+	num, err := str.Incr(delta)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if created {
+		k.putData(key, str)
+	}
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(num)
+}
+
+// bitmap
+func (k *KVStore) SetBit(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	offset, err := parseBitOffset(args[1])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	bit, err := parseBit(args[2])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	str, err := k.getAsString(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if str == nil {
+		str = NewString(key, "")
+		k.putData(key, str)
+	}
+
+	old := str.GetBits(offset, 1)
+	str.SetBits(offset, 1, bit)
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(int64(old))
+}
+
+func (k *KVStore) GetBit(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	offset, err := parseBitOffset(args[1])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	str, err := k.getAsString(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if str == nil {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(int64(str.GetBits(offset, 1)))
+}
+
+// bitcount key [start end [BYTE | BIT]]
+func (k *KVStore) BitCount(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) == 2 || len(args) > 4 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	str, err := k.getAsString(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if str == nil {
+		return handler.NewIntReply(0)
+	}
+
+	b := str.Bytes()
+	startBit, endBit, _, ok, err := parseBitRange(args[1:], int64(len(b)))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if !ok {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(bitCount(b, startBit, endBit))
+}
+
+// bitpos key bit [start [end [BYTE | BIT]]]
+func (k *KVStore) BitPos(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 || len(args) > 5 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	bit, err := parseBit(args[1])
+	if err != nil {
+		return handler.NewErrReply("ERR The bit argument must be 1 or 0.")
+	}
+
+	str, err := k.getAsString(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// 不存在的 key 视为全 0 的字符串
+	if str == nil {
+		if bit == 1 {
+			return handler.NewIntReply(-1)
+		}
+		return handler.NewIntReply(0)
+	}
+
+	b := str.Bytes()
+	startBit, endBit, endGiven, ok, err := parseBitRange(args[2:], int64(len(b)))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if !ok {
+		return handler.NewIntReply(-1)
+	}
+
+	pos := bitPos(b, bit, startBit, endBit)
+	// 查找 0 且未指定 end 时，字符串右侧视为由 0 填充
+	if pos == -1 && bit == 0 && !endGiven {
+		pos = endBit + 1
+	}
+	return handler.NewIntReply(pos)
+}
+
+// bitop AND | OR | XOR | NOT destkey key [key ...]
+func (k *KVStore) BitOp(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	op := strings.ToLower(string(args[0]))
+	switch op {
+	case "and", "or", "xor":
+	case "not":
+		if len(args) != 3 {
+			return handler.NewErrReply("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return handler.NewSyntaxErrReply()
+	}
+
+	dest := string(args[1])
+	srcs := make([][]byte, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		key := string(arg)
+		k.ExpirePreprocess(key)
+		str, err := k.getAsString(key)
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		if str == nil {
+			srcs = append(srcs, nil)
+			continue
+		}
+		srcs = append(srcs, str.Bytes())
+	}
+
+	res := bitOp(op, srcs)
+	k.ExpirePreprocess(dest)
+	if len(res) == 0 {
+		if k.del(dest) > 0 {
+			k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeDel), []byte(dest)}) // 持久化
+		}
+		return handler.NewIntReply(0)
+	}
+
+	k.put(dest, string(res))
+	k.persist(dest)
+	// 以 set 结果的形式持久化，重放时不依赖源 key
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeSet), args[1], res}) // 持久化
+	return handler.NewIntReply(int64(len(res)))
+}
+
+// bitfield key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP | SAT | FAIL]
+func (k *KVStore) BitField(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	key := string(args[0])
+	ops, write, err := parseBitfieldOps(args[1:])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	str, err := k.getAsString(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if str == nil && write {
+		str = NewString(key, "")
+	}
+
+	var changed bool
+	res := make([]handler.Reply, 0, len(ops))
+	for _, op := range ops {
+		var raw uint64
+		if str != nil {
+			raw = str.GetBits(op.offset, op.bits)
+		}
+		old := bitfieldValue(raw, op.signed, op.bits)
+		if op.kind == bitfieldOpGet {
+			res = append(res, handler.NewIntReply(old))
+			continue
+		}
+
+		// set 视为在 0 的基础上写入 value，与 incrby 共用溢出检查
+		base, incr := old, op.value
+		if op.kind == bitfieldOpSet {
+			base, incr = op.value, 0
+		}
+
+		var (
+			next     int64
+			overflow bool
+		)
+		if op.signed {
+			next, overflow = checkSignedBitfieldOverflow(base, incr, op.bits, op.overflow)
+		} else {
+			var unext uint64
+			unext, overflow = checkUnsignedBitfieldOverflow(uint64(base), incr, op.bits, op.overflow)
+			next = int64(unext)
+		}
+
+		if overflow && op.overflow == bitfieldOverflowFail {
+			res = append(res, handler.NewNillReply())
+			continue
+		}
+
+		str.SetBits(op.offset, op.bits, uint64(next))
+		changed = true
+		if op.kind == bitfieldOpSet {
+			res = append(res, handler.NewIntReply(old))
+		} else {
+			res = append(res, handler.NewIntReply(next))
+		}
+	}
+
+	if changed {
+		if _, ok := k.data[key]; !ok {
+			k.putData(key, str)
+		}
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewMultiRawReply(res)
+}
+
+// list
+func (k *KVStore) LPush(cmd *database.Command) handler.Reply {
+	return k.push(cmd, true, false)
+}
+
+func (k *KVStore) LPushX(cmd *database.Command) handler.Reply {
+	return k.push(cmd, true, true)
+}
+
+func (k *KVStore) LPop(cmd *database.Command) handler.Reply {
+	return k.pop(cmd, true)
+}
+
+func (k *KVStore) RPush(cmd *database.Command) handler.Reply {
+	return k.push(cmd, false, false)
+}
+
+func (k *KVStore) RPushX(cmd *database.Command) handler.Reply {
+	return k.push(cmd, false, true)
+}
+
+func (k *KVStore) RPop(cmd *database.Command) handler.Reply {
+	return k.pop(cmd, false)
+}
+
+func (k *KVStore) LRange(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return handler.NewSyntaxErrReply()
+	}
+
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return handler.NewSyntaxErrReply()
+	}
+
+	list, err := k.getAsList(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if list == nil {
+		return handler.NewEmptyMultiBulkReply()
+	}
+
+	return handler.NewMultiBulkReply(list.Range(start, stop))
+}
+
+func (k *KVStore) LLen(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	list, err := k.getAsList(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if list == nil {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(list.Len())
+}
+
+func (k *KVStore) LIndex(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+
+	list, err := k.getAsList(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if list == nil {
+		return handler.NewNillReply()
+	}
+
+	if v, ok := list.Index(index); ok {
+		return handler.NewBulkReply(v)
+	}
+	return handler.NewNillReply()
+}
+
+func (k *KVStore) LSet(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+
+	list, err := k.getAsList(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if list == nil {
+		return handler.NewErrReply("ERR no such key")
+	}
+
+	if !list.Set(index, args[2]) {
+		return handler.NewErrReply("ERR index out of range")
+	}
+
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewOKReply()
+}
+
+// linsert key BEFORE | AFTER pivot element
+func (k *KVStore) LInsert(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 4 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	var before bool
+	switch strings.ToLower(string(args[1])) {
+	case "before":
+		before = true
+	case "after":
+	default:
+		return handler.NewSyntaxErrReply()
+	}
+
+	list, err := k.getAsList(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if list == nil {
+		return handler.NewIntReply(0)
+	}
+
+	length := list.Insert(args[2], args[3], before)
+	if length > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewIntReply(length)
+}
+
+func (k *KVStore) LRem(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	cnt, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+
+	list, err := k.getAsList(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if list == nil {
+		return handler.NewIntReply(0)
+	}
+
+	remed := list.Rem(cnt, args[2])
+	if remed > 0 {
+		k.delIfEmptyList(key, list)
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewIntReply(remed)
+}
+
+func (k *KVStore) LTrim(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+
+	list, err := k.getAsList(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if list == nil {
+		return handler.NewOKReply()
+	}
+
+	list.Trim(start, stop)
+	k.delIfEmptyList(key, list)
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewOKReply()
+}
+
+// lpos key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func (k *KVStore) LPos(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 || len(args)&1 == 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	var (
+		rank     int64 = 1
+		cnt      int64
+		maxLen   int64
+		multiple bool
+	)
+	for i := 2; i < len(args); i += 2 {
+		v, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return handler.NewErrReply(errNotInteger.Error())
+		}
+
+		switch strings.ToLower(string(args[i])) {
+		case "rank":
+			if v == 0 || v == math.MinInt64 {
+				return handler.NewErrReply("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the last match")
+			}
+			rank = v
+		case "count":
+			if v < 0 {
+				return handler.NewErrReply("ERR COUNT can't be negative")
+			}
+			cnt, multiple = v, true
+		case "maxlen":
+			if v < 0 {
+				return handler.NewErrReply("ERR MAXLEN can't be negative")
+			}
+			maxLen = v
+		default:
+			return handler.NewSyntaxErrReply()
+		}
+	}
+
+	list, err := k.getAsList(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	var positions []int64
+	if list != nil {
+		if !multiple {
+			cnt = 1
+		}
+		positions = list.Pos(args[1], rank, cnt, maxLen)
+	}
+
+	if !multiple {
+		if len(positions) == 0 {
+			return handler.NewNillReply()
+		}
+		return handler.NewIntReply(positions[0])
+	}
+
+	res := make([]handler.Reply, 0, len(positions))
+	for _, pos := range positions {
+		res = append(res, handler.NewIntReply(pos))
+	}
+	return handler.NewMultiRawReply(res)
+}
+
+// lmove source destination LEFT | RIGHT LEFT | RIGHT
+func (k *KVStore) LMove(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 4 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	src, dst := string(args[0]), string(args[1])
+	srcLeft, err := parseListDirection(args[2])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	dstLeft, err := parseListDirection(args[3])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	moved, err := k.move(src, dst, srcLeft, dstLeft)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if moved == nil {
+		return handler.NewNillReply()
+	}
+
+	k.persistMove(cmd.Ctx(), args[0], args[1], srcLeft, dstLeft, moved)
+	return handler.NewBulkReply(moved)
+}
+
+// blpop key [key ...] timeout
+func (k *KVStore) BLPop(cmd *database.Command) handler.Reply {
+	return k.blockingPop(cmd, true)
+}
+
+// brpop key [key ...] timeout
+func (k *KVStore) BRPop(cmd *database.Command) handler.Reply {
+	return k.blockingPop(cmd, false)
+}
+
+// blmove source destination LEFT | RIGHT LEFT | RIGHT timeout
+func (k *KVStore) BLMove(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 5 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	src, dst := string(args[0]), string(args[1])
+	srcLeft, err := parseListDirection(args[2])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	dstLeft, err := parseListDirection(args[3])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	timeout, err := parseBlockTimeout(args[4])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// 被唤醒重试时不经过 executor 的前置处理，需要自行检查过期
+	k.ExpirePreprocess(src)
+	moved, err := k.move(src, dst, srcLeft, dstLeft)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if moved == nil {
+		return database.NewBlockReply([]string{src}, timeout, handler.NewNillReply())
+	}
+
+	// 与 lmove 一致，以非阻塞的 pop + push 进行持久化，避免重放时阻塞
+	k.persistMove(cmd.Ctx(), args[0], args[1], srcLeft, dstLeft, moved)
+	return handler.NewBulkReply(moved)
+}
+
+func (k *KVStore) blockingPop(cmd *database.Command, left bool) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	timeout, err := parseBlockTimeout(args[len(args)-1])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	keys := make([]string, 0, len(args)-1)
+	for _, arg := range args[:len(args)-1] {
+		key := string(arg)
+		keys = append(keys, key)
+
+		k.ExpirePreprocess(key)
+		list, err := k.getAsList(key)
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		if list == nil {
+			continue
+		}
+
+		// 按照 key 的先后顺序，从第一个非空的 list 中弹出元素
+		var poped [][]byte
+		popCmd := database.CmdTypeRPop
+		if left {
+			poped = list.LPop(1)
+			popCmd = database.CmdTypeLPop
+		} else {
+			poped = list.RPop(1)
+		}
+		k.delIfEmptyList(key, list)
+
+		// 以非阻塞的 lpop、rpop 进行持久化，避免重放时阻塞
+		k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(popCmd), arg}) // 持久化
+		return handler.NewMultiBulkReply([][]byte{arg, poped[0]})
+	}
+
+	return database.NewBlockReply(keys, timeout, handler.NewNullMultiBulkReply())
+}
+
+// 将 src 头部或尾部的元素移动到 dst 的头部或尾部. src 不存在时返回 nil
+func (k *KVStore) move(src, dst string, srcLeft, dstLeft bool) ([]byte, error) {
+	k.ExpirePreprocess(dst)
+	srcList, err := k.getAsList(src)
+	if err != nil {
+		return nil, err
+	}
+	// 出队前先完成 dst 的类型校验
+	if _, err = k.getAsList(dst); err != nil {
+		return nil, err
+	}
+
+	if srcList == nil {
+		return nil, nil
+	}
+
+	var moved [][]byte
+	if srcLeft {
+		moved = srcList.LPop(1)
+	} else {
+		moved = srcList.RPop(1)
+	}
+	k.delIfEmptyList(src, srcList)
+
+	// src 与 dst 可能是同一个 list，且已经因为被清空而删除，因此需要重新获取
+	dstList, _ := k.getAsList(dst)
+	if dstList == nil {
+		dstList = newListEntity(dst)
+		k.putAsList(dst, dstList)
+	}
+	if dstLeft {
+		dstList.LPush(moved[0])
+	} else {
+		dstList.RPush(moved[0])
+	}
+	return moved[0], nil
+}
+
+// 以 lpop | rpop + lpush | rpush 的形式持久化 move，重放时 src 可能已经过期
+func (k *KVStore) persistMove(ctx context.Context, src, dst []byte, srcLeft, dstLeft bool, moved []byte) {
+	popCmd, pushCmd := database.CmdTypeRPop, database.CmdTypeRPush
+	if srcLeft {
+		popCmd = database.CmdTypeLPop
+	}
+	if dstLeft {
+		pushCmd = database.CmdTypeLPush
+	}
+	k.persister.PersistCmd(ctx, [][]byte{[]byte(popCmd), src})         // 持久化
+	k.persister.PersistCmd(ctx, [][]byte{[]byte(pushCmd), dst, moved}) // 持久化
+}
+
+func (k *KVStore) push(cmd *database.Command, left, onlyExist bool) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	list, err := k.getAsList(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if list == nil {
+		// lpushx、rpushx 仅在 key 存在时生效
+		if onlyExist {
+			return handler.NewIntReply(0)
+		}
+		list = newListEntity(key)
+		k.putAsList(key, list)
+	}
+
+	for i := 1; i < len(args); i++ {
+		if left {
+			list.LPush(args[i])
+		} else {
+			list.RPush(args[i])
+		}
+	}
+
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(list.Len())
+}
+
+func (k *KVStore) pop(cmd *database.Command, left bool) handler.Reply {
+	args := cmd.Args()
+	key := string(args[0])
+	var cnt int64
 	if len(args) > 1 {
 		rawCnt, err := strconv.ParseInt(string(args[1]), 10, 64)
 		if err != nil {
-			return handler.NewSyntaxErrReply()
+			return handler.NewSyntaxErrReply()
+		}
+		if rawCnt < 1 {
+			return handler.NewSyntaxErrReply()
+		}
+		cnt = rawCnt
+	}
+
+	list, err := k.getAsList(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if list == nil {
+		return handler.NewNillReply()
+	}
+
+	if cnt == 0 {
+		cnt = 1
+	}
+
+	var poped [][]byte
+	if left {
+		poped = list.LPop(cnt)
+	} else {
+		poped = list.RPop(cnt)
+	}
+	if poped == nil {
+		return handler.NewNillReply()
+	}
+
+	k.delIfEmptyList(key, list)
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+
+	if len(poped) == 1 {
+		return handler.NewBulkReply(poped[0])
+	}
+
+	return handler.NewMultiBulkReply(poped)
+}
+
+// set
+func (k *KVStore) SAdd(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	set, err := k.getAsSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if set == nil {
+		set = newSetEntity(key, k.maxIntsetEntries)
+		k.putAsSet(key, set)
+	}
+
+	var added int64
+	for _, arg := range args[1:] {
+		added += set.Add(string(arg))
+	}
+
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(added)
+}
+
+func (k *KVStore) SIsMember(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	set, err := k.getAsSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if set == nil {
+		return handler.NewIntReply(0)
+	}
+
+	return handler.NewIntReply(set.Exist(string(args[1])))
+}
+
+func (k *KVStore) SRem(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	set, err := k.getAsSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if set == nil {
+		return handler.NewIntReply(0)
+	}
+
+	var remed int64
+	for _, arg := range args[1:] {
+		remed += set.Rem(string(arg))
+	}
+	k.delIfEmptySet(key, set)
+
+	if remed > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewIntReply(remed)
+}
+
+func (k *KVStore) SScan(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	scan, err := parseScanArgs(args[1:], false)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	set, err := k.getAsSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if set == nil {
+		return scanReply(0, nil)
+	}
+
+	cursor, members := set.Scan(scan.cursor, scan.count)
+	res := make([][]byte, 0, len(members))
+	for _, member := range members {
+		if lib.GlobMatch(scan.pattern, member) {
+			res = append(res, []byte(member))
+		}
+	}
+	return scanReply(cursor, res)
+}
+
+func (k *KVStore) SMembers(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	set, err := k.getAsSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if set == nil {
+		return handler.NewEmptyMultiBulkReply()
+	}
+
+	res := make([][]byte, 0, set.Len())
+	set.ForEach(func(value string) {
+		res = append(res, []byte(value))
+	})
+	return handler.NewMultiBulkReply(res)
+}
+
+func (k *KVStore) SCard(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	set, err := k.getAsSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if set == nil {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(set.Len())
+}
+
+// smismember key member [member ...]
+func (k *KVStore) SMIsMember(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	set, err := k.getAsSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	res := make([]handler.Reply, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		var exist int64
+		if set != nil {
+			exist = set.Exist(string(arg))
+		}
+		res = append(res, handler.NewIntReply(exist))
+	}
+	return handler.NewMultiRawReply(res)
+}
+
+// spop key [count]
+func (k *KVStore) SPop(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) > 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	cnt := int64(1)
+	if len(args) == 2 {
+		var err error
+		if cnt, err = strconv.ParseInt(string(args[1]), 10, 64); err != nil || cnt < 0 {
+			return handler.NewErrReply("ERR value is out of range, must be positive")
+		}
+	}
+
+	key := string(args[0])
+	set, err := k.getAsSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if set == nil {
+		if len(args) == 1 {
+			return handler.NewNillReply()
+		}
+		return handler.NewEmptyMultiBulkReply()
+	}
+
+	// 弹出数量不超过集合大小
+	if cnt > set.Len() {
+		cnt = set.Len()
+	}
+	members := set.RandomMembers(cnt)
+	poped := make([][]byte, 0, len(members))
+	for _, member := range members {
+		set.Rem(member)
+		poped = append(poped, []byte(member))
+	}
+	k.delIfEmptySet(key, set)
+
+	// 随机选取的结果以 srem 的形式持久化，保证重放结果一致
+	if len(poped) > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), append([][]byte{[]byte(database.CmdTypeSRem), []byte(key)}, poped...)) // 持久化
+	}
+
+	if len(args) == 1 {
+		return handler.NewBulkReply(poped[0])
+	}
+	return handler.NewMultiBulkReply(poped)
+}
+
+// srandmember key [count]
+func (k *KVStore) SRandMember(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) > 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	set, err := k.getAsSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// 未指定 count 时返回单个元素
+	if len(args) == 1 {
+		if set == nil {
+			return handler.NewNillReply()
+		}
+		return handler.NewBulkReply([]byte(set.RandomMembers(1)[0]))
+	}
+
+	cnt, err := parseRandomCount(args[1])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if set == nil {
+		return handler.NewEmptyMultiBulkReply()
+	}
+
+	members := set.RandomMembers(cnt)
+	res := make([][]byte, 0, len(members))
+	for _, member := range members {
+		res = append(res, []byte(member))
+	}
+	return handler.NewMultiBulkReply(res)
+}
+
+// smove source destination member
+func (k *KVStore) SMove(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	src, dst, member := string(args[0]), string(args[1]), string(args[2])
+	k.ExpirePreprocess(dst)
+	srcSet, err := k.getAsSet(src)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	dstSet, err := k.getAsSet(dst)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if srcSet == nil || srcSet.Exist(member) == 0 {
+		return handler.NewIntReply(0)
+	}
+
+	// src 与 dst 相同时无需移动
+	if src == dst {
+		return handler.NewIntReply(1)
+	}
+
+	srcSet.Rem(member)
+	k.delIfEmptySet(src, srcSet)
+	if dstSet == nil {
+		dstSet = newSetEntity(dst, k.maxIntsetEntries)
+		k.putAsSet(dst, dstSet)
+	}
+	dstSet.Add(member)
+
+	// 以 srem + sadd 的形式持久化，重放时 src 可能已经过期
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeSRem), args[0], args[2]}) // 持久化
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeSAdd), args[1], args[2]}) // 持久化
+	return handler.NewIntReply(1)
+}
+
+// sinter key [key ...]
+func (k *KVStore) SInter(cmd *database.Command) handler.Reply {
+	return k.setAlgebra(cmd, func(sets []Set) []string {
+		return setInter(sets, 0)
+	})
+}
+
+// sunion key [key ...]
+func (k *KVStore) SUnion(cmd *database.Command) handler.Reply {
+	return k.setAlgebra(cmd, setUnion)
+}
+
+// sdiff key [key ...]
+func (k *KVStore) SDiff(cmd *database.Command) handler.Reply {
+	return k.setAlgebra(cmd, setDiff)
+}
+
+// sinterstore destination key [key ...]
+func (k *KVStore) SInterStore(cmd *database.Command) handler.Reply {
+	return k.setAlgebraStore(cmd, func(sets []Set) []string {
+		return setInter(sets, 0)
+	})
+}
+
+// sunionstore destination key [key ...]
+func (k *KVStore) SUnionStore(cmd *database.Command) handler.Reply {
+	return k.setAlgebraStore(cmd, setUnion)
+}
+
+// sdiffstore destination key [key ...]
+func (k *KVStore) SDiffStore(cmd *database.Command) handler.Reply {
+	return k.setAlgebraStore(cmd, setDiff)
+}
+
+// sintercard numkeys key [key ...] [LIMIT limit]
+func (k *KVStore) SInterCard(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || numKeys <= 0 {
+		return handler.NewErrReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-1) {
+		return handler.NewErrReply("ERR Number of keys can't be greater than number of args")
+	}
+
+	var limit int64
+	rest := args[1+numKeys:]
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.EqualFold(string(rest[0]), "limit"):
+		if limit, err = strconv.ParseInt(string(rest[1]), 10, 64); err != nil || limit < 0 {
+			return handler.NewErrReply("ERR LIMIT can't be negative")
+		}
+	default:
+		return handler.NewSyntaxErrReply()
+	}
+
+	sets, err := k.getAsSets(args[1 : 1+numKeys])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	return handler.NewIntReply(int64(len(setInter(sets, limit))))
+}
+
+func (k *KVStore) setAlgebra(cmd *database.Command, op func(sets []Set) []string) handler.Reply {
+	sets, err := k.getAsSets(cmd.Args())
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	members := op(sets)
+	res := make([][]byte, 0, len(members))
+	for _, member := range members {
+		res = append(res, []byte(member))
+	}
+	return handler.NewMultiBulkReply(res)
+}
+
+// 运算结果覆盖写入 destination，结果为空时删除 destination.
+// 以 del + sadd 的形式持久化运算结果，重放时源 set 可能已经过期，不能依赖源 set 的状态
+func (k *KVStore) setAlgebraStore(cmd *database.Command, op func(sets []Set) []string) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	sets, err := k.getAsSets(args[1:])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	members := op(sets)
+
+	dst := string(args[0])
+	k.del(dst)
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeDel), args[0]}) // 持久化
+	if len(members) == 0 {
+		return handler.NewIntReply(0)
+	}
+
+	set := newSetEntity(dst, k.maxIntsetEntries)
+	addCmd := make([][]byte, 0, 2+len(members))
+	addCmd = append(addCmd, []byte(database.CmdTypeSAdd), args[0])
+	for _, member := range members {
+		set.Add(member)
+		addCmd = append(addCmd, []byte(member))
+	}
+	k.putAsSet(dst, set)
+	k.persister.PersistCmd(cmd.Ctx(), addCmd) // 持久化
+	return handler.NewIntReply(set.Len())
+}
+
+// hash
+func (k *KVStore) HSet(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 || len(args)&1 != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	hmap, err := k.getAsHashMap(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if hmap == nil {
+		hmap = newHashMapEntity(key)
+		k.putAsHashMap(key, hmap)
+	}
+
+	// 只统计新增的 field，覆盖写不计入
+	var added int64
+	for i := 0; i < len(args)-1; i += 2 {
+		hkey := string(args[i+1])
+		hvalue := args[i+2]
+		added += hmap.Put(hkey, hvalue)
+		// 覆盖写会清除 field 的过期时间
+		hmap.Persist(hkey)
+	}
+	k.trackVolatileHash(key, hmap)
+
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(added)
+}
+
+func (k *KVStore) HGet(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	key := string(args[0])
+	hmap, err := k.getAsHashMap(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if hmap == nil {
+		return handler.NewNillReply()
+	}
+
+	if v := hmap.Get(string(args[1])); v != nil {
+		return handler.NewBulkReply(v)
+	}
+
+	return handler.NewNillReply()
+}
+
+func (k *KVStore) HDel(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	key := string(args[0])
+	hmap, err := k.getAsHashMap(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if hmap == nil {
+		return handler.NewIntReply(0)
+	}
+
+	var remed int64
+	for _, arg := range args[1:] {
+		remed += hmap.Del(string(arg))
+	}
+	k.delIfEmptyHashMap(key, hmap)
+
+	if remed > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewIntReply(remed)
+}
+
+func (k *KVStore) HScan(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	scan, err := parseScanArgs(args[1:], false)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	hmap, err := k.getAsHashMap(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if hmap == nil {
+		return scanReply(0, nil)
+	}
+
+	cursor, fields := hmap.Scan(scan.cursor, scan.count)
+	res := make([][]byte, 0, len(fields)<<1)
+	for _, field := range fields {
+		if lib.GlobMatch(scan.pattern, field) {
+			res = append(res, []byte(field), hmap.Get(field))
+		}
+	}
+	return scanReply(cursor, res)
+}
+
+// hsetnx key field value
+func (k *KVStore) HSetNx(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	hmap, err := k.getAsHashMap(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if hmap == nil {
+		hmap = newHashMapEntity(key)
+		k.putAsHashMap(key, hmap)
+	} else if hmap.Get(string(args[1])) != nil {
+		return handler.NewIntReply(0)
+	}
+
+	hmap.Put(string(args[1]), args[2])
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(1)
+}
+
+// hmget key field [field ...]
+func (k *KVStore) HMGet(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	hmap, err := k.getAsHashMap(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	res := make([]handler.Reply, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		var v []byte
+		if hmap != nil {
+			v = hmap.Get(string(arg))
+		}
+		if v == nil {
+			res = append(res, handler.NewNillReply())
+			continue
+		}
+		res = append(res, handler.NewBulkReply(v))
+	}
+	return handler.NewMultiRawReply(res)
+}
+
+func (k *KVStore) HGetAll(cmd *database.Command) handler.Reply {
+	return k.hgetAll(cmd, true, true)
+}
+
+func (k *KVStore) HKeys(cmd *database.Command) handler.Reply {
+	return k.hgetAll(cmd, true, false)
+}
+
+func (k *KVStore) HVals(cmd *database.Command) handler.Reply {
+	return k.hgetAll(cmd, false, true)
+}
+
+func (k *KVStore) HExists(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	hmap, err := k.getAsHashMap(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if hmap == nil || hmap.Get(string(args[1])) == nil {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(1)
+}
+
+func (k *KVStore) HLen(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	hmap, err := k.getAsHashMap(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if hmap == nil {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(hmap.Len())
+}
+
+func (k *KVStore) HStrLen(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	hmap, err := k.getAsHashMap(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if hmap == nil {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(int64(len(hmap.Get(string(args[1])))))
+}
+
+// hincrby key field increment
+func (k *KVStore) HIncrBy(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+
+	key, field := string(args[0]), string(args[1])
+	hmap, err := k.getAsHashMap(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	var num int64
+	if hmap != nil {
+		if v := hmap.Get(field); v != nil {
+			var ok bool
+			if num, ok = parseStrictInt(v); !ok {
+				return handler.NewErrReply(errHashNotInteger.Error())
+			}
+		}
+	}
+
+	if (delta > 0 && num > math.MaxInt64-delta) || (delta < 0 && num < math.MinInt64-delta) {
+		return handler.NewErrReply(errIncrOverflow.Error())
+	}
+
+	if hmap == nil {
+		hmap = newHashMapEntity(key)
+		k.putAsHashMap(key, hmap)
+	}
+
+	num += delta
+	hmap.Put(field, strconv.AppendInt(nil, num, 10))
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(num)
+}
+
+// hincrbyfloat key field increment
+func (k *KVStore) HIncrByFloat(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	delta, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return handler.NewErrReply(errNotFloat.Error())
+	}
+
+	key, field := string(args[0]), string(args[1])
+	hmap, err := k.getAsHashMap(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	var num float64
+	if hmap != nil {
+		if v := hmap.Get(field); v != nil {
+			if num, err = strconv.ParseFloat(string(v), 64); err != nil || math.IsNaN(num) || math.IsInf(num, 0) {
+				return handler.NewErrReply(errHashNotFloat.Error())
+			}
+		}
+	}
+
+	num += delta
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return handler.NewErrReply(errIncrNaNOrInf.Error())
+	}
+
+	if hmap == nil {
+		hmap = newHashMapEntity(key)
+		k.putAsHashMap(key, hmap)
+	}
+
+	res := []byte(formatFloat(num))
+	hmap.Put(field, res)
+
+	// 浮点运算结果可能受平台影响，以 hset 结果的形式进行持久化. hset 会清除 field 的过期时间，需要补充 hpexpireat
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeHSet), args[0], args[1], res}) // 持久化
+	if expiredAt, ok := hmap.ExpiredAt(field); ok {
+		k.persister.PersistCmd(cmd.Ctx(), hpexpireAtCmd(key, expiredAt, []string{field})) // 持久化
+	}
+	return handler.NewBulkReply(res)
+}
+
+// hrandfield key [count [WITHVALUES]]
+func (k *KVStore) HRandField(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) > 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	hmap, err := k.getAsHashMap(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// 未指定 count 时返回单个 field
+	if len(args) == 1 {
+		if hmap == nil {
+			return handler.NewNillReply()
+		}
+		return handler.NewBulkReply([]byte(hmap.RandomFields(1)[0]))
+	}
+
+	cnt, err := parseRandomCount(args[1])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	var withValues bool
+	if len(args) == 3 {
+		if !strings.EqualFold(string(args[2]), "withvalues") {
+			return handler.NewSyntaxErrReply()
+		}
+		withValues = true
+	}
+
+	if hmap == nil {
+		return handler.NewEmptyMultiBulkReply()
+	}
+
+	fields := hmap.RandomFields(cnt)
+	res := make([][]byte, 0, len(fields)<<1)
+	for _, field := range fields {
+		res = append(res, []byte(field))
+		if withValues {
+			res = append(res, hmap.Get(field))
+		}
+	}
+	return handler.NewMultiBulkReply(res)
+}
+
+// hexpire key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func (k *KVStore) HExpire(cmd *database.Command) handler.Reply {
+	return k.hexpire(cmd, time.Second, false)
+}
+
+// hpexpire key milliseconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func (k *KVStore) HPExpire(cmd *database.Command) handler.Reply {
+	return k.hexpire(cmd, time.Millisecond, false)
+}
+
+// hexpireat key unix-time-seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func (k *KVStore) HExpireAt(cmd *database.Command) handler.Reply {
+	return k.hexpire(cmd, time.Second, true)
+}
+
+// hpexpireat key unix-time-milliseconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+func (k *KVStore) HPExpireAt(cmd *database.Command) handler.Reply {
+	return k.hexpire(cmd, time.Millisecond, true)
+}
+
+// httl key FIELDS numfields field [field ...]
+func (k *KVStore) HTTL(cmd *database.Command) handler.Reply {
+	return k.httl(cmd, func(ttl time.Duration) int64 {
+		// 与 redis 保持一致，秒级别四舍五入
+		return int64((ttl + 500*time.Millisecond) / time.Second)
+	})
+}
+
+// hpttl key FIELDS numfields field [field ...]
+func (k *KVStore) HPTTL(cmd *database.Command) handler.Reply {
+	return k.httl(cmd, func(ttl time.Duration) int64 {
+		return ttl.Milliseconds()
+	})
+}
+
+// hpersist key FIELDS numfields field [field ...]
+func (k *KVStore) HPersist(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	fields, err := parseHashFields(args[1:])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	key := string(args[0])
+	hmap, err := k.getAsHashMap(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// -2：field 不存在；-1：field 未设置过期时间；1：成功移除过期时间
+	res := make([]handler.Reply, 0, len(fields))
+	var persisted []string
+	for _, field := range fields {
+		switch {
+		case hmap == nil || hmap.Get(field) == nil:
+			res = append(res, handler.NewIntReply(-2))
+		case !hmap.Persist(field):
+			res = append(res, handler.NewIntReply(-1))
+		default:
+			persisted = append(persisted, field)
+			res = append(res, handler.NewIntReply(1))
+		}
+	}
+
+	if len(persisted) > 0 {
+		k.trackVolatileHash(key, hmap)
+		k.persister.PersistCmd(cmd.Ctx(), hashFieldsCmd(database.CmdTypeHPersist, key, nil, persisted)) // 持久化
+	}
+	return handler.NewMultiRawReply(res)
+}
+
+// field 的过期时间统一以 hpexpireat 的形式持久化. 过期时间早于当前时间时，直接删除 field
+func (k *KVStore) hexpire(cmd *database.Command, unit time.Duration, absolute bool) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 5 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	n, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+	// 与 redis 保持一致，过期时间上限为 2^48 毫秒
+	if n < 0 || n > maxHashFieldExpire/int64(unit/time.Millisecond) {
+		return handler.NewErrReply("ERR invalid expire time, must be >= 0 and <= 2^48")
+	}
+
+	expiredAt := lib.TimeNow().Add(time.Duration(n) * unit)
+	if absolute {
+		expiredAt = time.UnixMilli(n * int64(unit/time.Millisecond))
+	}
+
+	// FIELDS 之前至多携带一个 NX | XX | GT | LT 选项
+	rest, flags := args[2:], [][]byte(nil)
+	if !strings.EqualFold(string(rest[0]), "fields") {
+		rest, flags = rest[1:], rest[:1]
+	}
+	strategy, err := parseExpireStrategy(flags)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	fields, err := parseHashFields(rest)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	key := string(args[0])
+	hmap, err := k.getAsHashMap(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// -2：field 不存在；0：不满足 NX | XX | GT | LT 条件；1：设置成功；2：过期时间已过，field 被删除
+	res := make([]handler.Reply, 0, len(fields))
+	var updated, deleted []string
+	now := lib.TimeNow()
+	for _, field := range fields {
+		if hmap == nil || hmap.Get(field) == nil {
+			res = append(res, handler.NewIntReply(-2))
+			continue
+		}
+
+		current, volatile := hmap.ExpiredAt(field)
+		if !strategy.allow(current, volatile, expiredAt) {
+			res = append(res, handler.NewIntReply(0))
+			continue
+		}
+
+		// 重放 aof 时只记录过期时间，见 SetLoading
+		if !k.loading && !expiredAt.After(now) {
+			hmap.Del(field)
+			deleted = append(deleted, field)
+			res = append(res, handler.NewIntReply(2))
+			continue
+		}
+
+		hmap.Expire(field, expiredAt)
+		updated = append(updated, field)
+		res = append(res, handler.NewIntReply(1))
+	}
+
+	if hmap == nil {
+		return handler.NewMultiRawReply(res)
+	}
+
+	k.trackVolatileHash(key, hmap)
+	k.delIfEmptyHashMap(key, hmap)
+	if len(updated) > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), hpexpireAtCmd(key, expiredAt, updated)) // 持久化
+	}
+	if len(deleted) > 0 {
+		delCmd := [][]byte{[]byte(database.CmdTypeHDel), []byte(key)}
+		for _, field := range deleted {
+			delCmd = append(delCmd, []byte(field))
+		}
+		k.persister.PersistCmd(cmd.Ctx(), delCmd) // 持久化
+	}
+	return handler.NewMultiRawReply(res)
+}
+
+func (k *KVStore) httl(cmd *database.Command, format func(ttl time.Duration) int64) handler.Reply {
+	args := cmd.Args()
+	fields, err := parseHashFields(args[1:])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	hmap, err := k.getAsHashMap(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// -2：field 不存在；-1：field 未设置过期时间
+	res := make([]handler.Reply, 0, len(fields))
+	now := lib.TimeNow()
+	for _, field := range fields {
+		if hmap == nil || hmap.Get(field) == nil {
+			res = append(res, handler.NewIntReply(-2))
+			continue
+		}
+		expiredAt, ok := hmap.ExpiredAt(field)
+		if !ok {
+			res = append(res, handler.NewIntReply(-1))
+			continue
+		}
+		res = append(res, handler.NewIntReply(format(expiredAt.Sub(now))))
+	}
+	return handler.NewMultiRawReply(res)
+}
+
+func (k *KVStore) hgetAll(cmd *database.Command, withKeys, withValues bool) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	hmap, err := k.getAsHashMap(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if hmap == nil {
+		return handler.NewEmptyMultiBulkReply()
+	}
+
+	res := make([][]byte, 0, 2*hmap.Len())
+	hmap.ForEach(func(key string, value []byte) {
+		if withKeys {
+			res = append(res, []byte(key))
+		}
+		if withValues {
+			res = append(res, value)
+		}
+	})
+	return handler.NewMultiBulkReply(res)
+}
+
+// sorted set
+func (k *KVStore) ZAdd(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 || len(args)&1 != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	var (
+		scores  = make([]float64, 0, (len(args)-1)>>1)
+		members = make([]string, 0, (len(args)-1)>>1)
+	)
+
+	for i := 0; i < len(args)-1; i += 2 {
+		score, err := parseScore(args[i+1])
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+
+		scores = append(scores, score)
+		members = append(members, string(args[i+2]))
+	}
+
+	zset, err := k.getAsSortedSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		zset = newSkiplist(key)
+		k.putAsSortedSet(key, zset)
+	}
+
+	var added int64
+	for i := 0; i < len(scores); i++ {
+		added += zset.Add(scores[i], members[i])
+	}
+
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(added)
+}
+
+// zrangebyscore key min max [WITHSCORES] [LIMIT offset count]
+func (k *KVStore) ZRangeByScore(cmd *database.Command) handler.Reply {
+	return k.zrangeByScore(cmd, false)
+}
+
+// zrevrangebyscore key max min [WITHSCORES] [LIMIT offset count]
+func (k *KVStore) ZRevRangeByScore(cmd *database.Command) handler.Reply {
+	return k.zrangeByScore(cmd, true)
+}
+
+func (k *KVStore) zrangeByScore(cmd *database.Command, rev bool) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	min, max := args[1], args[2]
+	if rev {
+		min, max = max, min
+	}
+	r, err := parseScoreRange(min, max)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	withScores, offset, count, err := parseZRangeOptions(args[3:], true)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	zset, err := k.getAsSortedSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return handler.NewEmptyMultiBulkReply()
+	}
+
+	return zrangeReply(zset, zset.Range(r, offset, count, rev), withScores)
+}
+
+// zrangebylex key min max [LIMIT offset count]
+func (k *KVStore) ZRangeByLex(cmd *database.Command) handler.Reply {
+	return k.zrangeByLex(cmd, false)
+}
+
+// zrevrangebylex key max min [LIMIT offset count]
+func (k *KVStore) ZRevRangeByLex(cmd *database.Command) handler.Reply {
+	return k.zrangeByLex(cmd, true)
+}
+
+func (k *KVStore) zrangeByLex(cmd *database.Command, rev bool) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	min, max := args[1], args[2]
+	if rev {
+		min, max = max, min
+	}
+	r, err := parseLexRange(min, max)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	_, offset, count, err := parseZRangeOptions(args[3:], false)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	zset, err := k.getAsSortedSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return handler.NewEmptyMultiBulkReply()
+	}
+
+	return zrangeReply(zset, zset.RangeByLex(r, offset, count, rev), false)
+}
+
+// 解析 [WITHSCORES] [LIMIT offset count] 选项，count 默认为 -1 代表不限制个数
+func parseZRangeOptions(args [][]byte, allowScores bool) (withScores bool, offset, count int64, err error) {
+	count = -1
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "withscores":
+			if !allowScores {
+				return false, 0, 0, handler.NewSyntaxErrReply()
+			}
+			withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return false, 0, 0, handler.NewSyntaxErrReply()
+			}
+			if offset, err = strconv.ParseInt(string(args[i+1]), 10, 64); err != nil {
+				return false, 0, 0, errNotInteger
+			}
+			if count, err = strconv.ParseInt(string(args[i+2]), 10, 64); err != nil {
+				return false, 0, 0, errNotInteger
+			}
+			i += 2
+		default:
+			return false, 0, 0, handler.NewSyntaxErrReply()
+		}
+	}
+	return withScores, offset, count, nil
+}
+
+// withScores 为 true 时，按照【member】【score】交替的形式返回
+func zrangeReply(zset SortedSet, members []string, withScores bool) handler.Reply {
+	res := make([][]byte, 0, len(members))
+	for _, member := range members {
+		res = append(res, []byte(member))
+		if withScores {
+			score, _ := zset.Score(member)
+			res = append(res, []byte(formatScore(score)))
+		}
+	}
+	return handler.NewMultiBulkReply(res)
+}
+
+func (k *KVStore) ZRem(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	key := string(args[0])
+	zset, err := k.getAsSortedSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return handler.NewIntReply(0)
+	}
+
+	var remed int64
+	for _, arg := range args[1:] {
+		remed += zset.Rem(string(arg))
+	}
+	k.delIfEmptySortedSet(key, zset)
+
+	if remed > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewIntReply(remed)
+}
+
+func (k *KVStore) ZScan(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	scan, err := parseScanArgs(args[1:], false)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	zset, err := k.getAsSortedSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return scanReply(0, nil)
+	}
+
+	cursor, members := zset.Scan(scan.cursor, scan.count)
+	res := make([][]byte, 0, len(members)<<1)
+	for _, member := range members {
+		if !lib.GlobMatch(scan.pattern, member) {
+			continue
+		}
+		score, _ := zset.Score(member)
+		res = append(res, []byte(member), []byte(formatScore(score)))
+	}
+	return scanReply(cursor, res)
+}
+
+// zrange key start stop [REV] [WITHSCORES]
+func (k *KVStore) ZRange(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+
+	var rev, withScores bool
+	for _, arg := range args[3:] {
+		switch strings.ToLower(string(arg)) {
+		case "rev":
+			rev = true
+		case "withscores":
+			withScores = true
+		default:
+			return handler.NewSyntaxErrReply()
+		}
+	}
+
+	zset, err := k.getAsSortedSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return handler.NewEmptyMultiBulkReply()
+	}
+
+	return zrangeReply(zset, zset.RangeByRank(start, stop, rev), withScores)
+}
+
+// zrank key member [WITHSCORE]
+func (k *KVStore) ZRank(cmd *database.Command) handler.Reply {
+	return k.zrank(cmd, false)
+}
+
+// zrevrank key member [WITHSCORE]
+func (k *KVStore) ZRevRank(cmd *database.Command) handler.Reply {
+	return k.zrank(cmd, true)
+}
+
+func (k *KVStore) zrank(cmd *database.Command, rev bool) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 && (len(args) != 3 || !strings.EqualFold(string(args[2]), "withscore")) {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key, member := string(args[0]), string(args[1])
+	zset, err := k.getAsSortedSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return handler.NewNillReply()
+	}
+
+	rank, ok := zset.Rank(member)
+	if !ok {
+		return handler.NewNillReply()
+	}
+	if rev {
+		rank = zset.Len() - 1 - rank
+	}
+
+	if len(args) == 2 {
+		return handler.NewIntReply(rank)
+	}
+	score, _ := zset.Score(member)
+	return handler.NewMultiRawReply([]handler.Reply{
+		handler.NewIntReply(rank),
+		handler.NewBulkReply([]byte(formatScore(score))),
+	})
+}
+
+func (k *KVStore) ZCard(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	zset, err := k.getAsSortedSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(zset.Len())
+}
+
+// zcount key min max
+func (k *KVStore) ZCount(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	r, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	zset, err := k.getAsSortedSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(zset.Count(r))
+}
+
+func (k *KVStore) ZScore(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	zset, err := k.getAsSortedSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return handler.NewNillReply()
+	}
+
+	score, ok := zset.Score(string(args[1]))
+	if !ok {
+		return handler.NewNillReply()
+	}
+	return handler.NewBulkReply([]byte(formatScore(score)))
+}
+
+// zincrby key increment member
+func (k *KVStore) ZIncrBy(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key, member := string(args[0]), string(args[2])
+	delta, err := parseScore(args[1])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	zset, err := k.getAsSortedSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		zset = newSkiplist(key)
+		k.putAsSortedSet(key, zset)
+	}
+
+	score, _ := zset.Score(member)
+	score += delta
+	if math.IsNaN(score) {
+		k.delIfEmptySortedSet(key, zset)
+		return handler.NewErrReply("ERR resulting score is not a number (NaN)")
+	}
+	zset.Add(score, member)
+
+	// 以 zadd 结果的形式进行持久化
+	res := []byte(formatScore(score))
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeZAdd), []byte(key), res, []byte(member)})
+	return handler.NewBulkReply(res)
+}
+
+// zlexcount key min max
+func (k *KVStore) ZLexCount(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	r, err := parseLexRange(args[1], args[2])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	zset, err := k.getAsSortedSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(zset.LexCount(r))
+}
+
+// zremrangebyscore key min max
+func (k *KVStore) ZRemRangeByScore(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	r, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	return k.zremRange(cmd, func(zset SortedSet) int64 {
+		return zset.RemRangeByScore(r)
+	})
+}
+
+// zremrangebylex key min max
+func (k *KVStore) ZRemRangeByLex(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	r, err := parseLexRange(args[1], args[2])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	return k.zremRange(cmd, func(zset SortedSet) int64 {
+		return zset.RemRangeByLex(r)
+	})
+}
+
+// zremrangebyrank key start stop
+func (k *KVStore) ZRemRangeByRank(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+
+	return k.zremRange(cmd, func(zset SortedSet) int64 {
+		return zset.RemRangeByRank(start, stop)
+	})
+}
+
+// 批量移除 zset 中的 member. 重放时数据状态一致，直接以原指令的形式进行持久化
+func (k *KVStore) zremRange(cmd *database.Command, rem func(zset SortedSet) int64) handler.Reply {
+	key := string(cmd.Args()[0])
+	zset, err := k.getAsSortedSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return handler.NewIntReply(0)
+	}
+
+	remed := rem(zset)
+	k.delIfEmptySortedSet(key, zset)
+	if remed > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewIntReply(remed)
+}
+
+// zunion numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func (k *KVStore) ZUnion(cmd *database.Command) handler.Reply {
+	return k.zalgebra(cmd, true, func(srcs []zsource, zargs *zalgebraArgs) map[string]float64 {
+		return zunion(srcs, zargs.weights, zargs.aggregate)
+	})
+}
+
+// zinter numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func (k *KVStore) ZInter(cmd *database.Command) handler.Reply {
+	return k.zalgebra(cmd, true, func(srcs []zsource, zargs *zalgebraArgs) map[string]float64 {
+		return zinter(srcs, zargs.weights, zargs.aggregate)
+	})
+}
+
+// zdiff numkeys key [key ...] [WITHSCORES]
+func (k *KVStore) ZDiff(cmd *database.Command) handler.Reply {
+	return k.zalgebra(cmd, false, func(srcs []zsource, _ *zalgebraArgs) map[string]float64 {
+		return zdiff(srcs)
+	})
+}
+
+// zunionstore destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+func (k *KVStore) ZUnionStore(cmd *database.Command) handler.Reply {
+	return k.zalgebraStore(cmd, true, func(srcs []zsource, zargs *zalgebraArgs) map[string]float64 {
+		return zunion(srcs, zargs.weights, zargs.aggregate)
+	})
+}
+
+// zinterstore destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+func (k *KVStore) ZInterStore(cmd *database.Command) handler.Reply {
+	return k.zalgebraStore(cmd, true, func(srcs []zsource, zargs *zalgebraArgs) map[string]float64 {
+		return zinter(srcs, zargs.weights, zargs.aggregate)
+	})
+}
+
+// zdiffstore destination numkeys key [key ...]
+func (k *KVStore) ZDiffStore(cmd *database.Command) handler.Reply {
+	return k.zalgebraStore(cmd, false, func(srcs []zsource, _ *zalgebraArgs) map[string]float64 {
+		return zdiff(srcs)
+	})
+}
+
+func (k *KVStore) zalgebra(cmd *database.Command, allowWeights bool, op zalgebraOp) handler.Reply {
+	zargs, err := parseZAlgebraArgs(cmd.Args(), allowWeights, true)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	srcs, err := k.getAsZSources(zargs.keys)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// 借助跳表对结果进行排序
+	zset := newSkiplist("")
+	for member, score := range op(srcs, zargs) {
+		zset.Add(score, member)
+	}
+	return zrangeReply(zset, zset.RangeByRank(0, -1, false), zargs.withScores)
+}
+
+// 运算结果覆盖写入 destination，结果为空时删除 destination.
+// 以 del + zadd 的形式持久化运算结果，重放时源 zset 可能已经过期，不能依赖源 zset 的状态
+func (k *KVStore) zalgebraStore(cmd *database.Command, allowWeights bool, op zalgebraOp) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	zargs, err := parseZAlgebraArgs(args[1:], allowWeights, false)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	srcs, err := k.getAsZSources(zargs.keys)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	res := op(srcs, zargs)
+
+	dst := string(args[0])
+	k.del(dst)
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeDel), args[0]}) // 持久化
+	if len(res) == 0 {
+		return handler.NewIntReply(0)
+	}
+
+	zset := newSkiplist(dst)
+	for member, score := range res {
+		zset.Add(score, member)
+	}
+	k.putAsSortedSet(dst, zset)
+	k.persister.PersistCmd(cmd.Ctx(), zset.ToCmd()) // 持久化
+	return handler.NewIntReply(zset.Len())
+}
+
+// zpopmin key [count]
+func (k *KVStore) ZPopMin(cmd *database.Command) handler.Reply {
+	return k.zpop(cmd, false)
+}
+
+// zpopmax key [count]
+func (k *KVStore) ZPopMax(cmd *database.Command) handler.Reply {
+	return k.zpop(cmd, true)
+}
+
+func (k *KVStore) zpop(cmd *database.Command, max bool) handler.Reply {
+	args := cmd.Args()
+	if len(args) > 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	cnt := int64(1)
+	if len(args) == 2 {
+		var err error
+		if cnt, err = strconv.ParseInt(string(args[1]), 10, 64); err != nil {
+			return handler.NewErrReply(errNotInteger.Error())
+		}
+		if cnt < 0 {
+			return handler.NewErrReply("ERR value is out of range, must be positive")
+		}
+	}
+
+	key := string(args[0])
+	zset, err := k.getAsSortedSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil || cnt == 0 {
+		return handler.NewEmptyMultiBulkReply()
+	}
+
+	res := k.popFromSortedSet(key, zset, cnt, max)
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewMultiBulkReply(res)
+}
+
+// 弹出 member，按照【member】【score】交替的形式返回. zset 为空时同时删除 key
+func (k *KVStore) popFromSortedSet(key string, zset SortedSet, cnt int64, max bool) [][]byte {
+	poped := zset.Pop(cnt, max)
+	k.delIfEmptySortedSet(key, zset)
+
+	res := make([][]byte, 0, len(poped)<<1)
+	for _, zm := range poped {
+		res = append(res, []byte(zm.member), []byte(formatScore(zm.score)))
+	}
+	return res
+}
+
+// zrandmember key [count [WITHSCORES]]
+func (k *KVStore) ZRandMember(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) > 3 || (len(args) == 3 && !strings.EqualFold(string(args[2]), "withscores")) {
+		return handler.NewSyntaxErrReply()
+	}
+
+	zset, err := k.getAsSortedSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// 未指定 count 时返回单个 member
+	if len(args) == 1 {
+		if zset == nil {
+			return handler.NewNillReply()
+		}
+		return handler.NewBulkReply([]byte(zset.RandomMembers(1)[0]))
+	}
+
+	cnt, err := parseRandomCount(args[1])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return handler.NewEmptyMultiBulkReply()
+	}
+	return zrangeReply(zset, zset.RandomMembers(cnt), len(args) == 3)
+}
+
+// bzpopmin key [key ...] timeout
+func (k *KVStore) BZPopMin(cmd *database.Command) handler.Reply {
+	return k.blockingZPop(cmd, false)
+}
+
+// bzpopmax key [key ...] timeout
+func (k *KVStore) BZPopMax(cmd *database.Command) handler.Reply {
+	return k.blockingZPop(cmd, true)
+}
+
+func (k *KVStore) blockingZPop(cmd *database.Command, max bool) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	timeout, err := parseBlockTimeout(args[len(args)-1])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	keys := make([]string, 0, len(args)-1)
+	for _, arg := range args[:len(args)-1] {
+		keys = append(keys, string(arg))
+	}
+	key, zset, err := k.firstNonEmptySortedSet(keys)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if zset == nil {
+		return database.NewBlockReply(keys, timeout, handler.NewNullMultiBulkReply())
+	}
+
+	// 以非阻塞的 zpopmin、zpopmax 进行持久化，避免重放时阻塞
+	popCmd := database.CmdTypeZPopMin
+	if max {
+		popCmd = database.CmdTypeZPopMax
+	}
+	res := k.popFromSortedSet(key, zset, 1, max)
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(popCmd), []byte(key)}) // 持久化
+	return handler.NewMultiBulkReply(append([][]byte{[]byte(key)}, res...))
+}
+
+// bzmpop timeout numkeys key [key ...] MIN | MAX [COUNT count]
+func (k *KVStore) BZMPop(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 4 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	timeout, err := parseBlockTimeout(args[0])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	numKeys, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || numKeys <= 0 {
+		return handler.NewErrReply("ERR numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-3) {
+		return handler.NewSyntaxErrReply()
+	}
+
+	keys := make([]string, 0, numKeys)
+	for _, arg := range args[2 : 2+numKeys] {
+		keys = append(keys, string(arg))
+	}
+
+	rest := args[2+numKeys:]
+	var max bool
+	switch strings.ToLower(string(rest[0])) {
+	case "min":
+	case "max":
+		max = true
+	default:
+		return handler.NewSyntaxErrReply()
+	}
+
+	cnt := int64(1)
+	switch {
+	case len(rest) == 1:
+	case len(rest) == 3 && strings.EqualFold(string(rest[1]), "count"):
+		if cnt, err = strconv.ParseInt(string(rest[2]), 10, 64); err != nil || cnt <= 0 {
+			return handler.NewErrReply("ERR count should be greater than 0")
+		}
+	default:
+		return handler.NewSyntaxErrReply()
+	}
+
+	key, zset, err := k.firstNonEmptySortedSet(keys)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if zset == nil {
+		return database.NewBlockReply(keys, timeout, handler.NewNullMultiBulkReply())
+	}
+
+	popCmd := database.CmdTypeZPopMin
+	if max {
+		popCmd = database.CmdTypeZPopMax
+	}
+	res := k.popFromSortedSet(key, zset, cnt, max)
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(popCmd), []byte(key), []byte(strconv.FormatInt(cnt, 10))}) // 持久化
+
+	// 【key】+【[member, score] 数组】
+	members := make([]handler.Reply, 0, len(res)>>1)
+	for i := 0; i < len(res); i += 2 {
+		members = append(members, handler.NewMultiBulkReply(res[i:i+2]))
+	}
+	return handler.NewMultiRawReply([]handler.Reply{
+		handler.NewBulkReply([]byte(key)),
+		handler.NewMultiRawReply(members),
+	})
+}
+
+// 按照 key 的先后顺序，返回第一个非空的 zset. 被唤醒重试时不经过 executor 的前置处理，需要自行检查过期
+func (k *KVStore) firstNonEmptySortedSet(keys []string) (string, SortedSet, error) {
+	for _, key := range keys {
+		k.ExpirePreprocess(key)
+		zset, err := k.getAsSortedSet(key)
+		if err != nil {
+			return "", nil, err
+		}
+		if zset != nil {
+			return key, zset, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// stream
+// xadd key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func (k *KVStore) XAdd(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 4 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	var (
+		noMkStream bool
+		trim       *streamTrim
+		err        error
+	)
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if option == "nomkstream" {
+			noMkStream = true
+			continue
+		}
+		if option != "maxlen" && option != "minid" {
+			break
+		}
+		if trim, i, err = parseStreamTrim(args, i); err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		i--
+	}
+
+	// 剩余参数为 id 以及成对的 field、value
+	if len(args)-i < 3 || (len(args)-i)&1 != 1 {
+		return handler.NewErrReply("ERR wrong number of arguments for 'xadd' command")
+	}
+
+	key := string(args[0])
+	stream, err := k.getAsStream(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if stream == nil && noMkStream {
+		return handler.NewNillReply()
+	}
+
+	var lastID streamID
+	if stream != nil {
+		lastID = stream.LastID()
+	}
+	id, err := parseXAddID(args[i], lastID, uint64(lib.TimeNow().UnixMilli()))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if stream == nil {
+		stream = newStreamEntity(key)
+		k.putAsStream(key, stream)
+	}
+
+	fields := make([][]byte, 0, len(args)-i-1)
+	fields = append(fields, args[i+1:]...)
+	stream.Add(id, fields)
+	if trim != nil {
+		trim.apply(stream)
+	}
+	// stream 已存在时也可能有 xread 在等待新的 entry
+	k.signalReady(key)
+
+	// 以生成的 id 替换原指令中的 id 进行持久化，保证重放结果一致
+	persistCmd := make([][]byte, 0, len(args)+1)
+	persistCmd = append(persistCmd, []byte(database.CmdTypeXAdd))
+	persistCmd = append(persistCmd, args[:i]...)
+	persistCmd = append(persistCmd, []byte(id.String()))
+	persistCmd = append(persistCmd, args[i+1:]...)
+	k.persister.PersistCmd(cmd.Ctx(), persistCmd) // 持久化
+	return handler.NewBulkReply([]byte(id.String()))
+}
+
+// xrange key start end [COUNT count]
+func (k *KVStore) XRange(cmd *database.Command) handler.Reply {
+	return k.xrange(cmd, false)
+}
+
+// xrevrange key end start [COUNT count]
+func (k *KVStore) XRevRange(cmd *database.Command) handler.Reply {
+	return k.xrange(cmd, true)
+}
+
+func (k *KVStore) xrange(cmd *database.Command, rev bool) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 && (len(args) != 5 || !strings.EqualFold(string(args[3]), "count")) {
+		return handler.NewSyntaxErrReply()
+	}
+
+	startArg, endArg := args[1], args[2]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, err := parseStreamBound(startArg, true)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	end, err := parseStreamBound(endArg, false)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	count := int64(-1)
+	if len(args) == 5 {
+		if count, err = strconv.ParseInt(string(args[4]), 10, 64); err != nil {
+			return handler.NewErrReply(errNotInteger.Error())
+		}
+		if count < 0 {
+			count = 0
+		}
+	}
+
+	stream, err := k.getAsStream(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if stream == nil {
+		return handler.NewEmptyMultiBulkReply()
+	}
+	return streamEntriesReply(stream.Range(start, end, count, rev))
+}
+
+func (k *KVStore) XLen(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	stream, err := k.getAsStream(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if stream == nil {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(stream.Len())
+}
+
+// xtrim key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func (k *KVStore) XTrim(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	option := strings.ToLower(string(args[1]))
+	if option != "maxlen" && option != "minid" {
+		return handler.NewSyntaxErrReply()
+	}
+	trim, i, err := parseStreamTrim(args, 1)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if i != len(args) {
+		return handler.NewSyntaxErrReply()
+	}
+
+	stream, err := k.getAsStream(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if stream == nil {
+		return handler.NewIntReply(0)
+	}
+
+	trimmed := trim.apply(stream)
+	if trimmed > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewIntReply(trimmed)
+}
+
+// xdel key id [id ...]
+func (k *KVStore) XDel(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	ids := make([]streamID, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		ids = append(ids, id)
+	}
+
+	stream, err := k.getAsStream(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if stream == nil {
+		return handler.NewIntReply(0)
+	}
+
+	var deleted int64
+	for _, id := range ids {
+		deleted += stream.Del(id)
+	}
+	if deleted > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewIntReply(deleted)
+}
+
+// xsetid key last-id
+func (k *KVStore) XSetID(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	id, err := parseStreamID(args[1], 0)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	stream, err := k.getAsStream(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if stream == nil {
+		return handler.NewErrReply("ERR no such key")
+	}
+
+	if last := stream.Range(streamID{}, maxStreamID, 1, true); len(last) > 0 && id.less(last[0].id) {
+		return handler.NewErrReply("ERR The ID specified in XSETID is smaller than the target stream top item")
+	}
+	stream.SetLastID(id)
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewOKReply()
+}
+
+// xread [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func (k *KVStore) XRead(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	var (
+		count   int64 = -1
+		block   bool
+		timeout time.Duration
+		i       int
+	)
+
+	for ; i < len(args); i += 2 {
+		option := strings.ToLower(string(args[i]))
+		if option == "streams" {
+			break
+		}
+		if i+1 >= len(args) {
+			return handler.NewSyntaxErrReply()
+		}
+		switch option {
+		case "count":
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return handler.NewErrReply(errNotInteger.Error())
+			}
+			if n > 0 {
+				count = n
+			}
+		case "block":
+			ms, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return handler.NewErrReply("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return handler.NewErrReply("ERR timeout is negative")
+			}
+			block, timeout = true, time.Duration(ms)*time.Millisecond
+		default:
+			return handler.NewSyntaxErrReply()
+		}
+	}
+
+	rest := len(args) - i - 1
+	if i >= len(args) || rest == 0 || rest&1 != 0 {
+		return handler.NewErrReply("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+
+	keys, rawIDs := args[i+1:i+1+rest/2], args[i+1+rest/2:]
+	streams := make([]Stream, 0, len(keys))
+	ids := make([]streamID, 0, len(keys))
+	for j, arg := range keys {
+		// 被唤醒重试时不经过 executor 的前置处理，需要自行检查过期
+		k.ExpirePreprocess(string(arg))
+		stream, err := k.getAsStream(string(arg))
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		streams = append(streams, stream)
+
+		// $ 代表只读取新写入的 entry
+		if string(rawIDs[j]) == "$" {
+			var lastID streamID
+			if stream != nil {
+				lastID = stream.LastID()
+			}
+			ids = append(ids, lastID)
+			continue
+		}
+		id, err := parseStreamID(rawIDs[j], 0)
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		ids = append(ids, id)
+	}
+
+	// 【key】+【entry 数组】
+	var res []handler.Reply
+	for j, stream := range streams {
+		if stream == nil {
+			continue
+		}
+		start, ok := ids[j].incr()
+		if !ok {
+			continue
+		}
+		if entries := stream.Range(start, maxStreamID, count, false); len(entries) > 0 {
+			res = append(res, handler.NewMultiRawReply([]handler.Reply{
+				handler.NewBulkReply(keys[j]),
+				streamEntriesReply(entries),
+			}))
+		}
+	}
+	if len(res) > 0 {
+		return handler.NewMultiRawReply(res)
+	}
+	if !block {
+		return handler.NewNullMultiBulkReply()
+	}
+
+	// 挂起前将 $ 固定为当前的 last id，避免重试时错过挂起期间写入的 entry
+	retryArgs := make([][]byte, 0, len(args))
+	retryArgs = append(retryArgs, args[:i+1+rest/2]...)
+	blockKeys := make([]string, 0, len(keys))
+	for j, arg := range keys {
+		retryArgs = append(retryArgs, []byte(ids[j].String()))
+		blockKeys = append(blockKeys, string(arg))
+	}
+	return database.NewBlockReply(blockKeys, timeout, handler.NewNullMultiBulkReply()).WithArgs(retryArgs)
+}
+
+// stream 消费者组
+
+// xgroup CREATE key group id|$ [MKSTREAM]
+// xgroup SETID key group id|$
+// xgroup DESTROY key group
+// xgroup CREATECONSUMER key group consumer
+// xgroup DELCONSUMER key group consumer
+func (k *KVStore) XGroup(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	// args[0] 为子命令，需要自行检查 key 的过期
+	k.ExpirePreprocess(string(args[1]))
+	switch strings.ToLower(string(args[0])) {
+	case "create":
+		return k.xgroupCreate(cmd)
+	case "setid":
+		return k.xgroupSetID(cmd)
+	case "destroy":
+		return k.xgroupDestroy(cmd)
+	case "createconsumer":
+		return k.xgroupCreateConsumer(cmd)
+	case "delconsumer":
+		return k.xgroupDelConsumer(cmd)
+	}
+	return handler.NewErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XGROUP HELP.")
+}
+
+func (k *KVStore) xgroupCreate(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 4 && (len(args) != 5 || !strings.EqualFold(string(args[4]), "mkstream")) {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key, name := string(args[1]), string(args[2])
+	stream, err := k.getAsStream(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	mkstream := stream == nil
+	if mkstream && len(args) != 5 {
+		return handler.NewErrReply("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	}
+
+	var id streamID
+	if string(args[3]) != "$" {
+		if id, err = parseStreamID(args[3], 0); err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+	} else if stream != nil {
+		id = stream.LastID()
+	}
+
+	if mkstream {
+		stream = newStreamEntity(key)
+		k.putAsStream(key, stream)
+	}
+	if !stream.CreateGroup(name, id) {
+		return handler.NewErrReply(errBusyGroup.Error())
+	}
+
+	// 以具体的 id 替换 $ 进行持久化
+	persistCmd := [][]byte{[]byte(database.CmdTypeXGroup), args[0], args[1], args[2], []byte(id.String())}
+	if mkstream {
+		persistCmd = append(persistCmd, args[4])
+	}
+	k.persister.PersistCmd(cmd.Ctx(), persistCmd) // 持久化
+	return handler.NewOKReply()
+}
+
+func (k *KVStore) xgroupSetID(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 4 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	stream, group, err := k.getStreamGroup(string(args[1]), string(args[2]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	id := stream.LastID()
+	if string(args[3]) != "$" {
+		if id, err = parseStreamID(args[3], 0); err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+	}
+	group.lastDeliveredID = id
+
+	persistCmd := [][]byte{[]byte(database.CmdTypeXGroup), args[0], args[1], args[2], []byte(id.String())}
+	k.persister.PersistCmd(cmd.Ctx(), persistCmd) // 持久化
+	return handler.NewOKReply()
+}
+
+func (k *KVStore) xgroupDestroy(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	stream, err := k.getAsStream(string(args[1]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if stream == nil {
+		return handler.NewErrReply("ERR The XGROUP subcommand requires the key to exist.")
+	}
+
+	if !stream.DestroyGroup(string(args[2])) {
+		return handler.NewIntReply(0)
+	}
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(1)
+}
+
+func (k *KVStore) xgroupCreateConsumer(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 4 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	_, group, err := k.getStreamGroup(string(args[1]), string(args[2]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if _, ok := group.consumers[string(args[3])]; ok {
+		return handler.NewIntReply(0)
+	}
+	group.consumer(string(args[3]), lib.TimeNow())
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(1)
+}
+
+func (k *KVStore) xgroupDelConsumer(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 4 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	_, group, err := k.getStreamGroup(string(args[1]), string(args[2]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if _, ok := group.consumers[string(args[3])]; !ok {
+		return handler.NewIntReply(0)
+	}
+	pending := group.delConsumer(string(args[3]))
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(pending)
+}
+
+// xreadgroup GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func (k *KVStore) XReadGroup(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 || !strings.EqualFold(string(args[0]), "group") {
+		return handler.NewSyntaxErrReply()
+	}
+
+	name, consumerName := string(args[1]), string(args[2])
+	var (
+		count   int64 = -1
+		block   bool
+		noack   bool
+		timeout time.Duration
+		i       = 3
+	)
+
+	for ; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if option == "streams" {
+			break
+		}
+		if option == "noack" {
+			noack = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return handler.NewSyntaxErrReply()
+		}
+		switch option {
+		case "count":
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return handler.NewErrReply(errNotInteger.Error())
+			}
+			if n > 0 {
+				count = n
+			}
+		case "block":
+			ms, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return handler.NewErrReply("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return handler.NewErrReply("ERR timeout is negative")
+			}
+			block, timeout = true, time.Duration(ms)*time.Millisecond
+		default:
+			return handler.NewSyntaxErrReply()
+		}
+		i++
+	}
+
+	rest := len(args) - i - 1
+	if i >= len(args) || rest == 0 || rest&1 != 0 {
+		return handler.NewErrReply("ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified.")
+	}
+
+	keys, rawIDs := args[i+1:i+1+rest/2], args[i+1+rest/2:]
+	streams := make([]Stream, 0, len(keys))
+	groups := make([]*streamGroup, 0, len(keys))
+	// nil 代表读取新的 entry，否则读取消费者名下 id 之后的 pending entry
+	ids := make([]*streamID, 0, len(keys))
+	for j, arg := range keys {
+		// 被唤醒重试时不经过 executor 的前置处理，需要自行检查过期
+		k.ExpirePreprocess(string(arg))
+		stream, group, err := k.getStreamGroup(string(arg), name)
+		if err != nil {
+			return handler.NewErrReply(err.Error() + " in XREADGROUP with GROUP option")
+		}
+		streams, groups = append(streams, stream), append(groups, group)
+
+		if string(rawIDs[j]) == ">" {
+			ids = append(ids, nil)
+			continue
+		}
+		// 读取历史 entry 时不会挂起
+		block = false
+		id, err := parseStreamID(rawIDs[j], 0)
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		ids = append(ids, &id)
+	}
+
+	now := lib.TimeNow()
+	var res []handler.Reply
+	for j, stream := range streams {
+		key, group := string(keys[j]), groups[j]
+		consumer, created := group.consumer(consumerName, now)
+		if created {
+			k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeXGroup), []byte("createconsumer"),
+				keys[j], args[1], args[2]}) // 持久化
+		}
+
+		if ids[j] != nil {
+			// 【key】+【entry 数组】，已被删除的 entry 只返回 id
+			res = append(res, handler.NewMultiRawReply([]handler.Reply{
+				handler.NewBulkReply(keys[j]),
+				k.xreadgroupPending(cmd, key, stream, group, consumer, *ids[j], count, now),
+			}))
+			continue
+		}
+
+		start, ok := group.lastDeliveredID.incr()
+		if !ok {
+			continue
+		}
+		entries := stream.Range(start, maxStreamID, count, false)
+		if len(entries) == 0 {
+			continue
+		}
+
+		group.lastDeliveredID = entries[len(entries)-1].id
+		if noack {
+			k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeXGroup), []byte("setid"), keys[j], args[1],
+				[]byte(group.lastDeliveredID.String())}) // 持久化
+		} else {
+			for _, entry := range entries {
+				pe := group.deliver(entry.id, consumer, now)
+				k.persister.PersistCmd(cmd.Ctx(), xclaimCmd(key, name, pe, &group.lastDeliveredID)) // 持久化
+			}
+		}
+		res = append(res, handler.NewMultiRawReply([]handler.Reply{
+			handler.NewBulkReply(keys[j]),
+			streamEntriesReply(entries),
+		}))
+	}
+	if len(res) > 0 {
+		return handler.NewMultiRawReply(res)
+	}
+	if !block {
+		return handler.NewNullMultiBulkReply()
+	}
+
+	blockKeys := make([]string, 0, len(keys))
+	for _, arg := range keys {
+		blockKeys = append(blockKeys, string(arg))
+	}
+	return database.NewBlockReply(blockKeys, timeout, handler.NewNullMultiBulkReply())
+}
+
+// 重新投递消费者名下 id 之后的 pending entry
+func (k *KVStore) xreadgroupPending(cmd *database.Command, key string, stream Stream, group *streamGroup,
+	consumer *streamConsumer, id streamID, count int64, now time.Time) handler.Reply {
+	start, ok := id.incr()
+	if !ok {
+		return handler.NewEmptyMultiBulkReply()
+	}
+
+	pes := group.pendingRange(start, maxStreamID, count, consumer.name, 0, now)
+	replies := make([]handler.Reply, 0, len(pes))
+	for _, pe := range pes {
+		entry := stream.Get(pe.id)
+		if entry == nil {
+			replies = append(replies, handler.NewMultiRawReply([]handler.Reply{
+				handler.NewBulkReply([]byte(pe.id.String())),
+				handler.NewNullMultiBulkReply(),
+			}))
+			continue
+		}
+		group.deliver(pe.id, consumer, now)
+		k.persister.PersistCmd(cmd.Ctx(), xclaimCmd(key, group.name, pe, nil)) // 持久化
+		replies = append(replies, streamEntryReply(entry))
+	}
+	return handler.NewMultiRawReply(replies)
+}
+
+// xack key group id [id ...]
+func (k *KVStore) XAck(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	ids := make([]streamID, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		ids = append(ids, id)
+	}
+
+	stream, err := k.getAsStream(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if stream == nil || stream.Group(string(args[1])) == nil {
+		return handler.NewIntReply(0)
+	}
+
+	group := stream.Group(string(args[1]))
+	var acked int64
+	for _, id := range ids {
+		acked += group.ack(id)
+	}
+	if acked > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewIntReply(acked)
+}
+
+// xpending key group [[IDLE min-idle-time] start end count [consumer]]
+func (k *KVStore) XPending(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	var minIdle time.Duration
+	rest := args[2:]
+	if len(rest) > 0 && strings.EqualFold(string(rest[0]), "idle") {
+		if len(rest) < 2 {
+			return handler.NewSyntaxErrReply()
+		}
+		ms, err := strconv.ParseInt(string(rest[1]), 10, 64)
+		if err != nil {
+			return handler.NewErrReply(errNotInteger.Error())
+		}
+		minIdle, rest = time.Duration(ms)*time.Millisecond, rest[2:]
+	}
+	if len(args) > 2 && len(rest) != 3 && len(rest) != 4 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	_, group, err := k.getStreamGroup(string(args[0]), string(args[1]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// 概要形式：【pending 总数】+【最小 id】+【最大 id】+【各消费者的 pending 数】
+	if len(args) == 2 {
+		if len(group.pel) == 0 {
+			return handler.NewMultiRawReply([]handler.Reply{
+				handler.NewIntReply(0), handler.NewNillReply(), handler.NewNillReply(), handler.NewNullMultiBulkReply(),
+			})
+		}
+		var consumers []handler.Reply
+		for _, c := range group.sortedConsumers() {
+			if c.pending > 0 {
+				consumers = append(consumers, handler.NewMultiBulkReply([][]byte{
+					[]byte(c.name), []byte(strconv.FormatInt(c.pending, 10)),
+				}))
+			}
+		}
+		return handler.NewMultiRawReply([]handler.Reply{
+			handler.NewIntReply(int64(len(group.pel))),
+			handler.NewBulkReply([]byte(group.pel[0].id.String())),
+			handler.NewBulkReply([]byte(group.pel[len(group.pel)-1].id.String())),
+			handler.NewMultiRawReply(consumers),
+		})
+	}
+
+	start, err := parseStreamBound(rest[0], true)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	end, err := parseStreamBound(rest[1], false)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	count, err := strconv.ParseInt(string(rest[2]), 10, 64)
+	if err != nil {
+		return handler.NewErrReply(errNotInteger.Error())
+	}
+	if count <= 0 || end.less(start) {
+		return handler.NewEmptyMultiBulkReply()
+	}
+	var consumer string
+	if len(rest) == 4 {
+		consumer = string(rest[3])
+	}
+
+	// 明细形式：【id】+【消费者】+【空闲毫秒数】+【投递次数】
+	now := lib.TimeNow()
+	pes := group.pendingRange(start, end, count, consumer, minIdle, now)
+	replies := make([]handler.Reply, 0, len(pes))
+	for _, pe := range pes {
+		replies = append(replies, handler.NewMultiRawReply([]handler.Reply{
+			handler.NewBulkReply([]byte(pe.id.String())),
+			handler.NewBulkReply([]byte(pe.consumer)),
+			handler.NewIntReply(now.Sub(pe.deliveryTime).Milliseconds()),
+			handler.NewIntReply(pe.deliveryCount),
+		}))
+	}
+	return handler.NewMultiRawReply(replies)
+}
+
+// xclaim key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func (k *KVStore) XClaim(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 5 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil || minIdle < 0 {
+		return handler.NewErrReply("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+
+	// id 之后的参数均为选项
+	i := 4
+	ids := make([]streamID, 0, len(args)-4)
+	for ; i < len(args); i++ {
+		id, err := parseStreamID(args[i], 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return handler.NewErrReply(errInvalidStreamID.Error())
+	}
+
+	now := lib.TimeNow()
+	deliveryTime := now
+	var (
+		retryCount    int64 = -1
+		force, justID bool
+		lastID        *streamID
+	)
+	for ; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch option {
+		case "force":
+			force = true
+			continue
+		case "justid":
+			justID = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return handler.NewSyntaxErrReply()
+		}
+		i++
+		if option == "lastid" {
+			id, err := parseStreamID(args[i], 0)
+			if err != nil {
+				return handler.NewErrReply(err.Error())
+			}
+			lastID = &id
+			continue
+		}
+
+		n, err := strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil {
+			return handler.NewErrReply("ERR Invalid " + option + " option argument for XCLAIM")
+		}
+		switch option {
+		case "idle":
+			deliveryTime = now.Add(-time.Duration(n) * time.Millisecond)
+		case "time":
+			deliveryTime = time.UnixMilli(n)
+		case "retrycount":
+			retryCount = n
+		default:
+			return handler.NewErrReply("ERR Unrecognized XCLAIM option '" + string(args[i-1]) + "'")
+		}
+	}
+
+	key, name := string(args[0]), string(args[1])
+	stream, group, err := k.getStreamGroup(key, name)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	consumer, created := group.consumer(string(args[2]), now)
+	if created {
+		k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeXGroup), []byte("createconsumer"),
+			args[0], args[1], args[2]}) // 持久化
+	}
+	if lastID != nil && group.lastDeliveredID.less(*lastID) {
+		group.lastDeliveredID = *lastID
+		k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeXGroup), []byte("setid"), args[0], args[1],
+			[]byte(lastID.String())}) // 持久化
+	}
+
+	var (
+		claimed []*pendingEntry
+		entries []*streamEntry
+		deleted [][]byte
+	)
+	for _, id := range ids {
+		entry := stream.Get(id)
+		pe := group.pending(id)
+		switch {
+		case pe == nil:
+			// FORCE 与 JUSTID 同时指定时用于还原 pel，不要求 entry 依然存在
+			if !force || entry == nil && !justID {
+				continue
+			}
+			pe = group.deliver(id, consumer, deliveryTime)
+		case now.Sub(pe.deliveryTime) < time.Duration(minIdle)*time.Millisecond:
+			continue
+		case entry == nil:
+			// entry 已被删除，从 pel 中移除
+			group.ack(id)
+			deleted = append(deleted, []byte(id.String()))
+			continue
+		default:
+			group.assign(pe, consumer)
+			if !justID {
+				pe.deliveryCount++
+			}
+		}
+
+		pe.deliveryTime = deliveryTime
+		if retryCount >= 0 {
+			pe.deliveryCount = retryCount
+		}
+		claimed = append(claimed, pe)
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	k.persistClaims(cmd.Ctx(), key, name, claimed, deleted)
+
+	if !justID {
+		return streamEntriesReply(entries)
+	}
+	res := make([][]byte, 0, len(claimed))
+	for _, pe := range claimed {
+		res = append(res, []byte(pe.id.String()))
+	}
+	return handler.NewMultiBulkReply(res)
+}
+
+// xautoclaim key group consumer min-idle-time start [COUNT count] [JUSTID]
+func (k *KVStore) XAutoClaim(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 5 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil || minIdle < 0 {
+		return handler.NewErrReply("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	start, err := parseStreamBound(args[4], true)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	var (
+		count  int64 = 100
+		justID bool
+	)
+	for i := 5; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "justid":
+			justID = true
+		case "count":
+			if i+1 >= len(args) {
+				return handler.NewSyntaxErrReply()
+			}
+			i++
+			if count, err = strconv.ParseInt(string(args[i]), 10, 64); err != nil || count <= 0 {
+				return handler.NewErrReply("ERR COUNT must be > 0")
+			}
+		default:
+			return handler.NewSyntaxErrReply()
+		}
+	}
+
+	key, name := string(args[0]), string(args[1])
+	stream, group, err := k.getStreamGroup(key, name)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	now := lib.TimeNow()
+	consumer, created := group.consumer(string(args[2]), now)
+	if created {
+		k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeXGroup), []byte("createconsumer"),
+			args[0], args[1], args[2]}) // 持久化
+	}
+
+	var (
+		next    streamID // 下一次扫描的起点，0-0 代表已扫描完毕
+		claimed []*pendingEntry
+		entries []*streamEntry
+		deleted [][]byte
+	)
+	pes := group.pendingRange(start, maxStreamID, -1, "", time.Duration(minIdle)*time.Millisecond, now)
+	for _, pe := range pes {
+		if int64(len(claimed)+len(deleted)) == count {
+			next = pe.id
+			break
+		}
+
+		entry := stream.Get(pe.id)
+		if entry == nil {
+			group.ack(pe.id)
+			deleted = append(deleted, []byte(pe.id.String()))
+			continue
+		}
+		group.assign(pe, consumer)
+		pe.deliveryTime = now
+		if !justID {
+			pe.deliveryCount++
+		}
+		claimed = append(claimed, pe)
+		entries = append(entries, entry)
+	}
+	k.persistClaims(cmd.Ctx(), key, name, claimed, deleted)
+
+	// 【下一次扫描的起点】+【认领的 entry】+【已被删除的 id】
+	var claimedReply handler.Reply = streamEntriesReply(entries)
+	if justID {
+		ids := make([][]byte, 0, len(claimed))
+		for _, pe := range claimed {
+			ids = append(ids, []byte(pe.id.String()))
+		}
+		claimedReply = handler.NewMultiBulkReply(ids)
+	}
+	return handler.NewMultiRawReply([]handler.Reply{
+		handler.NewBulkReply([]byte(next.String())),
+		claimedReply,
+		handler.NewMultiBulkReply(deleted),
+	})
+}
+
+// xinfo STREAM key
+// xinfo GROUPS key
+// xinfo CONSUMERS key group
+func (k *KVStore) XInfo(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	// args[0] 为子命令，需要自行检查 key 的过期
+	key := string(args[1])
+	k.ExpirePreprocess(key)
+	subCmd := strings.ToLower(string(args[0]))
+	switch {
+	case subCmd == "stream" && len(args) == 2, subCmd == "groups" && len(args) == 2:
+	case subCmd == "consumers" && len(args) == 3:
+		_, group, err := k.getStreamGroup(key, string(args[2]))
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		now := lib.TimeNow()
+		consumers := group.sortedConsumers()
+		replies := make([]handler.Reply, 0, len(consumers))
+		for _, c := range consumers {
+			replies = append(replies, handler.NewMultiRawReply([]handler.Reply{
+				handler.NewBulkReply([]byte("name")), handler.NewBulkReply([]byte(c.name)),
+				handler.NewBulkReply([]byte("pending")), handler.NewIntReply(c.pending),
+				handler.NewBulkReply([]byte("idle")), handler.NewIntReply(now.Sub(c.seenTime).Milliseconds()),
+			}))
+		}
+		return handler.NewMultiRawReply(replies)
+	default:
+		return handler.NewErrReply("ERR unknown subcommand or wrong number of arguments for '" + string(args[0]) + "'. Try XINFO HELP.")
+	}
+
+	stream, err := k.getAsStream(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if stream == nil {
+		return handler.NewErrReply("ERR no such key")
+	}
+
+	groups := stream.Groups()
+	if subCmd == "groups" {
+		replies := make([]handler.Reply, 0, len(groups))
+		for _, group := range groups {
+			replies = append(replies, handler.NewMultiRawReply([]handler.Reply{
+				handler.NewBulkReply([]byte("name")), handler.NewBulkReply([]byte(group.name)),
+				handler.NewBulkReply([]byte("consumers")), handler.NewIntReply(int64(len(group.consumers))),
+				handler.NewBulkReply([]byte("pending")), handler.NewIntReply(int64(len(group.pel))),
+				handler.NewBulkReply([]byte("last-delivered-id")), handler.NewBulkReply([]byte(group.lastDeliveredID.String())),
+			}))
+		}
+		return handler.NewMultiRawReply(replies)
+	}
+
+	var first, last handler.Reply = handler.NewNillReply(), handler.NewNillReply()
+	if entries := stream.Range(streamID{}, maxStreamID, 1, false); len(entries) > 0 {
+		first = streamEntryReply(entries[0])
+	}
+	if entries := stream.Range(streamID{}, maxStreamID, 1, true); len(entries) > 0 {
+		last = streamEntryReply(entries[0])
+	}
+	return handler.NewMultiRawReply([]handler.Reply{
+		handler.NewBulkReply([]byte("length")), handler.NewIntReply(stream.Len()),
+		handler.NewBulkReply([]byte("last-generated-id")), handler.NewBulkReply([]byte(stream.LastID().String())),
+		handler.NewBulkReply([]byte("groups")), handler.NewIntReply(int64(len(groups))),
+		handler.NewBulkReply([]byte("first-entry")), first,
+		handler.NewBulkReply([]byte("last-entry")), last,
+	})
+}
+
+// hyperloglog
+
+// pfadd key [element [element ...]]
+func (k *KVStore) PFAdd(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	hll, err := k.getAsHyperLogLog(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	created := hll == nil
+	if created {
+		hll = newHyperLogLog()
+	}
+	updated, err := hll.add(args[1:])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if !created && !updated {
+		return handler.NewIntReply(0)
+	}
+
+	// 序列化结果以字符串的形式存储，不影响 key 的过期时间
+	k.put(key, string(hll))
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(1)
+}
+
+// pfcount key [key ...]
+func (k *KVStore) PFCount(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	// 单个 key 时使用并更新基数缓存
+	if len(args) == 1 {
+		key := string(args[0])
+		hll, err := k.getAsHyperLogLog(key)
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		if hll == nil {
+			return handler.NewIntReply(0)
+		}
+
+		card, refreshed, err := hll.count()
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		if refreshed {
+			k.put(key, string(hll))
+			k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+		}
+		return handler.NewIntReply(int64(card))
+	}
+
+	// 多个 key 时返回并集的基数
+	var regs [hllRegisters]uint8
+	for _, arg := range args {
+		k.ExpirePreprocess(string(arg))
+		hll, err := k.getAsHyperLogLog(string(arg))
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		if hll == nil {
+			continue
+		}
+		if err = hll.mergeInto(&regs); err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+	}
+	return handler.NewIntReply(int64(hllCount(&regs)))
+}
+
+// pfmerge destkey [sourcekey [sourcekey ...]]
+func (k *KVStore) PFMerge(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	// destkey 自身也参与合并. 只有全部输入均为稀疏编码时才尝试以稀疏编码存储结果
+	var (
+		regs   [hllRegisters]uint8
+		dest   hyperLogLog
+		sparse = true
+	)
+	for i, arg := range args {
+		k.ExpirePreprocess(string(arg))
+		hll, err := k.getAsHyperLogLog(string(arg))
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		if hll == nil {
+			continue
+		}
+		if i == 0 {
+			dest = hll
+		}
+		if !hll.isSparse() {
+			sparse = false
+		}
+		if err = hll.mergeInto(&regs); err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+	}
+
+	if dest == nil {
+		dest = newHyperLogLog()
+	}
+	dest.store(&regs, sparse)
+	value := string(dest)
+	k.put(string(args[0]), value)
+	// 以 set 合并结果的形式持久化，重放时不依赖源 key，并保留 destkey 的过期时间
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeSet), args[0], []byte(value), []byte("keepttl")}) // 持久化
+	return handler.NewOKReply()
+}
+
+// geo
+
+// geoadd key [NX | XX] [CH] longitude latitude member [longitude latitude member ...]
+func (k *KVStore) GeoAdd(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	var nx, xx, ch bool
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			nx = true
+			continue
+		case "xx":
+			xx = true
+			continue
+		case "ch":
+			ch = true
+			continue
+		}
+		break
+	}
+	if nx && xx {
+		return handler.NewErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if len(args) == i || (len(args)-i)%3 != 0 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	points := make([]geoPoint, 0, (len(args)-i)/3)
+	members := make([]string, 0, (len(args)-i)/3)
+	for ; i < len(args); i += 3 {
+		p, err := parseGeoPoint(args[i], args[i+1])
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		points = append(points, p)
+		members = append(members, string(args[i+2]))
+	}
+
+	key := string(args[0])
+	zset, err := k.getAsSortedSet(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	var added, changed int64
+	for j, member := range members {
+		score := float64(geoEncode(points[j], geoStep))
+		old, exist := int64(0), false
+		if zset != nil {
+			var oldScore float64
+			oldScore, exist = zset.Score(member)
+			if exist && oldScore != score {
+				old = 1
+			}
+		}
+		if nx && exist || xx && !exist || exist && old == 0 {
+			continue
+		}
+
+		if zset == nil {
+			zset = newSkiplist(key)
+			k.putAsSortedSet(key, zset)
+		}
+		added += zset.Add(score, member)
+		changed += old
+	}
+
+	if added+changed > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	if ch {
+		return handler.NewIntReply(added + changed)
+	}
+	return handler.NewIntReply(added)
+}
+
+// geodist key member1 member2 [M | KM | FT | MI]
+func (k *KVStore) GeoDist(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 && len(args) != 4 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	unit := 1.0
+	if len(args) == 4 {
+		var err error
+		if unit, err = parseGeoUnit(args[3]); err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+	}
+
+	zset, err := k.getAsSortedSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	if zset == nil {
+		return handler.NewNillReply()
+	}
+	score1, ok1 := zset.Score(string(args[1]))
+	score2, ok2 := zset.Score(string(args[2]))
+	if !ok1 || !ok2 {
+		return handler.NewNillReply()
+	}
+	dist := geoDistance(geoDecodePoint(uint64(score1)), geoDecodePoint(uint64(score2)))
+	return handler.NewBulkReply(formatGeoDist(dist, unit))
+}
+
+// geopos key [member [member ...]]
+func (k *KVStore) GeoPos(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	zset, err := k.getAsSortedSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	replies := make([]handler.Reply, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		var score float64
+		ok := false
+		if zset != nil {
+			score, ok = zset.Score(string(arg))
+		}
+		if !ok {
+			replies = append(replies, handler.NewNullMultiBulkReply())
+			continue
+		}
+		replies = append(replies, geoCoordReply(geoDecodePoint(uint64(score))))
+	}
+	return handler.NewMultiRawReply(replies)
+}
+
+// geohash key [member [member ...]]
+func (k *KVStore) GeoHash(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	zset, err := k.getAsSortedSet(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	res := make([][]byte, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		var score float64
+		ok := false
+		if zset != nil {
+			score, ok = zset.Score(string(arg))
+		}
+		if !ok {
+			res = append(res, nil)
+			continue
+		}
+		res = append(res, geoHashString(score))
+	}
+	return handler.NewMultiBulkReply(res)
+}
+
+// geosearch key FROMMEMBER member | FROMLONLAT longitude latitude BYRADIUS radius M | KM | FT | MI | BYBOX width height M | KM | FT | MI
+// [ASC | DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func (k *KVStore) GeoSearch(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	gargs, err := parseGeoSearchArgs(args[1:], false)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	res, err := k.geoSearch(string(args[0]), gargs)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// 【member】+【距离】+【geohash】+【经纬度】
+	withAny := gargs.withDist || gargs.withHash || gargs.withCoord
+	replies := make([]handler.Reply, 0, len(res))
+	for _, r := range res {
+		if !withAny {
+			replies = append(replies, handler.NewBulkReply([]byte(r.member)))
+			continue
+		}
+		item := []handler.Reply{handler.NewBulkReply([]byte(r.member))}
+		if gargs.withDist {
+			item = append(item, handler.NewBulkReply(formatGeoDist(r.dist, gargs.shape.unit)))
+		}
+		if gargs.withHash {
+			item = append(item, handler.NewIntReply(int64(r.score)))
+		}
+		if gargs.withCoord {
+			item = append(item, geoCoordReply(r.point))
+		}
+		replies = append(replies, handler.NewMultiRawReply(item))
+	}
+	return handler.NewMultiRawReply(replies)
+}
+
+// geosearchstore destination source FROMMEMBER member | FROMLONLAT longitude latitude BYRADIUS radius M | KM | FT | MI | BYBOX width height M | KM | FT | MI
+// [ASC | DESC] [COUNT count [ANY]] [STOREDIST]
+func (k *KVStore) GeoSearchStore(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	gargs, err := parseGeoSearchArgs(args[2:], true)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	k.ExpirePreprocess(string(args[1]))
+	res, err := k.geoSearch(string(args[1]), gargs)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// 与 zunionstore 等指令一致，以 del + zadd 的形式持久化结果
+	dst := string(args[0])
+	k.del(dst)
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeDel), args[0]}) // 持久化
+	if len(res) == 0 {
+		return handler.NewIntReply(0)
+	}
+
+	zset := newSkiplist(dst)
+	for _, r := range res {
+		score := r.score
+		if gargs.storeDist {
+			score = r.dist / gargs.shape.unit
+		}
+		zset.Add(score, r.member)
+	}
+	k.putAsSortedSet(dst, zset)
+	k.persister.PersistCmd(cmd.Ctx(), zset.ToCmd()) // 持久化
+	return handler.NewIntReply(zset.Len())
+}
+
+func (k *KVStore) geoSearch(key string, gargs *geoSearchArgs) ([]*geoResult, error) {
+	zset, err := k.getAsSortedSet(key)
+	if err != nil || zset == nil {
+		return nil, err
+	}
+
+	if gargs.fromMember != nil {
+		score, ok := zset.Score(string(gargs.fromMember))
+		if !ok {
+			return nil, errors.New("ERR could not decode requested zset member")
+		}
+		gargs.shape.center = geoDecodePoint(uint64(score))
+	}
+
+	res := geoSearch(zset, &gargs.shape, gargs.count, gargs.any)
+	sortGeoResults(res, gargs.order)
+	if gargs.count > 0 && int64(len(res)) > gargs.count {
+		res = res[:gargs.count]
+	}
+	return res, nil
+}
+
+// 【经度】+【纬度】
+func geoCoordReply(p geoPoint) handler.Reply {
+	return handler.NewMultiBulkReply([][]byte{
+		[]byte(formatFloat(p.lon)),
+		[]byte(formatFloat(p.lat)),
+	})
+}
+
+// bloom filter
+
+// bf.reserve key error_rate capacity [EXPANSION expansion] [NONSCALING]
+func (k *KVStore) BFReserve(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	errorRate, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || errorRate <= 0 || errorRate >= 1 {
+		return handler.NewErrReply("ERR (0 < error rate range < 1)")
+	}
+	capacity, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil || capacity <= 0 || capacity > maxStringLen {
+		return handler.NewErrReply("ERR (capacity should be larger than 0)")
+	}
+
+	expansion, nonScaling := int64(bloomDefaultExpansion), false
+	var expansionSet bool
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "expansion":
+			if i+1 >= len(args) {
+				return handler.NewSyntaxErrReply()
+			}
+			if expansion, err = strconv.ParseInt(string(args[i+1]), 10, 64); err != nil || expansion < 1 || expansion > bloomMaxExpansion {
+				return handler.NewErrReply("ERR (expansion should be greater or equal to 1)")
+			}
+			expansionSet = true
+			i++
+		case "nonscaling":
+			nonScaling = true
+		default:
+			return handler.NewSyntaxErrReply()
+		}
+	}
+	if nonScaling {
+		if expansionSet {
+			return handler.NewErrReply("ERR Nonscaling filters cannot expand")
+		}
+		expansion = 0
+	}
+	// 位数组需要能够被 loadBloomFilter 重新导入
+	if _, _, ok := bloomLayerSize(capacity, errorRate); !ok {
+		return handler.NewErrReply(errBloomTooLarge.Error())
+	}
+
+	key := string(args[0])
+	if _, ok := k.data[key]; ok {
+		return handler.NewErrReply(errFilterExists.Error())
+	}
+
+	k.putAsBloomFilter(key, newBloomFilter(key, errorRate, capacity, expansion))
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewOKReply()
+}
+
+// bf.add key item
+func (k *KVStore) BFAdd(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	bf, err := k.getOrCreateBloomFilter(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	added, err := bf.Add(args[1])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if !added {
+		return handler.NewIntReply(0)
+	}
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(1)
+}
+
+// bf.madd key item [item ...]
+func (k *KVStore) BFMAdd(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	bf, err := k.getOrCreateBloomFilter(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	var updated bool
+	replies := make([]handler.Reply, 0, len(args)-1)
+	for _, item := range args[1:] {
+		added, err := bf.Add(item)
+		if err != nil {
+			replies = append(replies, handler.NewErrReply(err.Error()))
+			continue
+		}
+		if added {
+			updated = true
+			replies = append(replies, handler.NewIntReply(1))
+			continue
+		}
+		replies = append(replies, handler.NewIntReply(0))
+	}
+
+	if updated {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewMultiRawReply(replies)
+}
+
+// bf.exists key item
+func (k *KVStore) BFExists(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	bf, err := k.getAsBloomFilter(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if bf == nil || !bf.Exists(args[1]) {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(1)
+}
+
+// bf.mexists key item [item ...]
+func (k *KVStore) BFMExists(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	bf, err := k.getAsBloomFilter(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	replies := make([]handler.Reply, 0, len(args)-1)
+	for _, item := range args[1:] {
+		if bf != nil && bf.Exists(item) {
+			replies = append(replies, handler.NewIntReply(1))
+			continue
+		}
+		replies = append(replies, handler.NewIntReply(0))
+	}
+	return handler.NewMultiRawReply(replies)
+}
+
+// bf.info key [CAPACITY | SIZE | FILTERS | ITEMS | EXPANSION]
+func (k *KVStore) BFInfo(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 && len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	bf, err := k.getAsBloomFilter(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if bf == nil {
+		return handler.NewErrReply(errFilterNotFound.Error())
+	}
+
+	// 不可扩容的过滤器 expansion 返回 nil
+	var expansion handler.Reply = handler.NewNillReply()
+	if bf.Expansion() > 0 {
+		expansion = handler.NewIntReply(bf.Expansion())
+	}
+
+	if len(args) == 2 {
+		var reply handler.Reply
+		switch strings.ToLower(string(args[1])) {
+		case "capacity":
+			reply = handler.NewIntReply(bf.Capacity())
+		case "size":
+			reply = handler.NewIntReply(bf.Size())
+		case "filters":
+			reply = handler.NewIntReply(bf.Filters())
+		case "items":
+			reply = handler.NewIntReply(bf.Items())
+		case "expansion":
+			reply = expansion
+		default:
+			return handler.NewErrReply("ERR Invalid information value")
+		}
+		return handler.NewMultiRawReply([]handler.Reply{reply})
+	}
+
+	return handler.NewMultiRawReply([]handler.Reply{
+		handler.NewBulkReply([]byte("Capacity")), handler.NewIntReply(bf.Capacity()),
+		handler.NewBulkReply([]byte("Size")), handler.NewIntReply(bf.Size()),
+		handler.NewBulkReply([]byte("Number of filters")), handler.NewIntReply(bf.Filters()),
+		handler.NewBulkReply([]byte("Number of items inserted")), handler.NewIntReply(bf.Items()),
+		handler.NewBulkReply([]byte("Expansion rate")), expansion,
+	})
+}
+
+// bf.scandump key iterator
+func (k *KVStore) BFScanDump(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	iter, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || iter < 0 {
+		return handler.NewErrReply("ERR invalid iterator")
+	}
+
+	bf, err := k.getAsBloomFilter(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if bf == nil {
+		return handler.NewErrReply(errFilterNotFound.Error())
+	}
+
+	next, data := bf.ScanDump(iter)
+	return handler.NewMultiRawReply([]handler.Reply{handler.NewIntReply(next), handler.NewBulkReply(data)})
+}
+
+// bf.loadchunk key iterator data
+func (k *KVStore) BFLoadChunk(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	iter, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || iter < 1 {
+		return handler.NewErrReply("ERR invalid iterator")
+	}
+
+	key := string(args[0])
+	bf, err := k.getAsBloomFilter(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// 首个分片为头部，据此创建位数组为空的过滤器
+	if iter == 1 {
+		if bf != nil {
+			return handler.NewErrReply(errFilterExists.Error())
+		}
+		if bf, err = loadBloomFilter(key, args[2]); err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		k.putAsBloomFilter(key, bf)
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+		return handler.NewOKReply()
+	}
+
+	if bf == nil {
+		return handler.NewErrReply(errFilterNotFound.Error())
+	}
+	if err = bf.LoadChunk(iter, args[2]); err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewOKReply()
+}
+
+// 不存在时以默认参数创建
+func (k *KVStore) getOrCreateBloomFilter(key string) (BloomFilter, error) {
+	bf, err := k.getAsBloomFilter(key)
+	if err != nil || bf != nil {
+		return bf, err
+	}
+
+	bf = newBloomFilter(key, bloomDefaultErrorRate, bloomDefaultCapacity, bloomDefaultExpansion)
+	k.putAsBloomFilter(key, bf)
+	return bf, nil
+}
+
+// cuckoo filter
+
+// cf.reserve key capacity [BUCKETSIZE bucketsize] [MAXITERATIONS maxiterations] [EXPANSION expansion]
+func (k *KVStore) CFReserve(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 || len(args)%2 != 0 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	capacity, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || capacity < 1 || capacity > maxStringLen {
+		return handler.NewErrReply("ERR Bad capacity")
+	}
+
+	bucketSize, maxIterations, expansion := int64(cuckooDefaultBucketSize), int64(cuckooDefaultMaxIterations), int64(cuckooDefaultExpansion)
+	for i := 2; i < len(args); i += 2 {
+		v, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return handler.NewErrReply(errNotInteger.Error())
 		}
-		if rawCnt < 1 {
+		switch strings.ToLower(string(args[i])) {
+		case "bucketsize":
+			if v < 1 || v > cuckooMaxBucketSize {
+				return handler.NewErrReply("ERR Bad bucket size")
+			}
+			bucketSize = v
+		case "maxiterations":
+			if v < 1 || v > math.MaxUint16 {
+				return handler.NewErrReply("ERR Bad maxIterations")
+			}
+			maxIterations = v
+		case "expansion":
+			if v < 0 || v > cuckooMaxExpansion {
+				return handler.NewErrReply("ERR Bad expansion")
+			}
+			expansion = v
+		default:
 			return handler.NewSyntaxErrReply()
 		}
-		cnt = rawCnt
+	}
+	// 桶数组需要能够被 loadCuckooFilter 重新导入
+	if nextPowerOfTwo((uint64(capacity)+uint64(bucketSize)-1)/uint64(bucketSize)) > maxStringLen/uint64(bucketSize) {
+		return handler.NewErrReply("ERR Bad capacity")
 	}
 
-	list, err := k.getAsList(key)
+	key := string(args[0])
+	if _, ok := k.data[key]; ok {
+		return handler.NewErrReply(errFilterExists.Error())
+	}
+
+	k.putAsCuckooFilter(key, newCuckooFilter(key, capacity, uint64(bucketSize), maxIterations, expansion))
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewOKReply()
+}
+
+// cf.add key item
+func (k *KVStore) CFAdd(cmd *database.Command) handler.Reply {
+	return k.cfAdd(cmd, false)
+}
+
+// cf.addnx key item
+func (k *KVStore) CFAddNX(cmd *database.Command) handler.Reply {
+	return k.cfAdd(cmd, true)
+}
+
+func (k *KVStore) cfAdd(cmd *database.Command, nx bool) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	key := string(args[0])
+	cf, err := k.getAsCuckooFilter(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if nx && cf != nil && cf.Count(args[1]) > 0 {
+		return handler.NewIntReply(0)
+	}
+
+	if cf == nil {
+		cf = newCuckooFilter(key, cuckooDefaultCapacity, cuckooDefaultBucketSize, cuckooDefaultMaxIterations, cuckooDefaultExpansion)
+		k.putAsCuckooFilter(key, cf)
+	}
+	if err = cf.Add(args[1]); err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(1)
+}
+
+// cf.del key item
+func (k *KVStore) CFDel(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	cf, err := k.getAsCuckooFilter(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if cf == nil {
+		return handler.NewErrReply("ERR Not found")
+	}
+
+	if !cf.Del(args[1]) {
+		return handler.NewIntReply(0)
+	}
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewIntReply(1)
+}
+
+// cf.exists key item
+func (k *KVStore) CFExists(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	cf, err := k.getAsCuckooFilter(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if cf == nil || cf.Count(args[1]) == 0 {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(1)
+}
+
+// cf.count key item
+func (k *KVStore) CFCount(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	cf, err := k.getAsCuckooFilter(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if cf == nil {
+		return handler.NewIntReply(0)
+	}
+	return handler.NewIntReply(cf.Count(args[1]))
+}
+
+// cf.scandump key iterator
+func (k *KVStore) CFScanDump(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	iter, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || iter < 0 {
+		return handler.NewErrReply("ERR invalid iterator")
+	}
+
+	cf, err := k.getAsCuckooFilter(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if cf == nil {
+		return handler.NewErrReply(errFilterNotFound.Error())
+	}
+
+	next, data := cf.ScanDump(iter)
+	return handler.NewMultiRawReply([]handler.Reply{handler.NewIntReply(next), handler.NewBulkReply(data)})
+}
+
+// cf.loadchunk key iterator data
+func (k *KVStore) CFLoadChunk(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	iter, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || iter < 1 {
+		return handler.NewErrReply("ERR invalid iterator")
+	}
+
+	key := string(args[0])
+	cf, err := k.getAsCuckooFilter(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+
+	// 首个分片为头部，据此创建桶数组为空的过滤器
+	if iter == 1 {
+		if cf != nil {
+			return handler.NewErrReply(errFilterExists.Error())
+		}
+		if cf, err = loadCuckooFilter(key, args[2]); err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		k.putAsCuckooFilter(key, cf)
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+		return handler.NewOKReply()
+	}
+
+	if cf == nil {
+		return handler.NewErrReply(errFilterNotFound.Error())
+	}
+	if err = cf.LoadChunk(iter, args[2]); err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewOKReply()
+}
+
+// count-min sketch
+
+// cms.initbydim key width depth
+func (k *KVStore) CMSInitByDim(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	width, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || width < 1 || width > maxStringLen/8 {
+		return handler.NewErrReply("CMS: invalid width")
+	}
+	depth, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil || depth < 1 || depth > maxStringLen/8/width {
+		return handler.NewErrReply("CMS: invalid depth")
+	}
+
+	key := string(args[0])
+	if _, ok := k.data[key]; ok {
+		return handler.NewErrReply(errCMSExists.Error())
+	}
+
+	k.putAsCountMinSketch(key, newCountMinSketch(key, width, depth))
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewOKReply()
+}
+
+// cms.incrby key item increment [item increment ...]
+func (k *KVStore) CMSIncrBy(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 || len(args)%2 != 1 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	items := make([][]byte, 0, len(args)/2)
+	increments := make([]int64, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		incr, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil || incr < 0 {
+			return handler.NewErrReply("CMS: Cannot parse number")
+		}
+		items = append(items, args[i])
+		increments = append(increments, incr)
+	}
+
+	cms, err := k.getAsCountMinSketch(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if cms == nil {
+		return handler.NewErrReply(errCMSNotFound.Error())
+	}
+
+	counts, err := cms.IncrBy(items, increments)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+
+	replies := make([]handler.Reply, 0, len(counts))
+	for _, count := range counts {
+		replies = append(replies, handler.NewIntReply(count))
+	}
+	return handler.NewMultiRawReply(replies)
+}
+
+// cms.query key item [item ...]
+func (k *KVStore) CMSQuery(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	cms, err := k.getAsCountMinSketch(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if cms == nil {
+		return handler.NewErrReply(errCMSNotFound.Error())
+	}
+
+	replies := make([]handler.Reply, 0, len(args)-1)
+	for _, item := range args[1:] {
+		replies = append(replies, handler.NewIntReply(cms.Query(item)))
+	}
+	return handler.NewMultiRawReply(replies)
+}
+
+// cms.merge destination numKeys source [source ...] [WEIGHTS weight [weight ...]]
+func (k *KVStore) CMSMerge(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 3 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	numKeys, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || numKeys < 1 || numKeys > int64(len(args)-2) {
+		return handler.NewErrReply("CMS: wrong number of keys")
+	}
+
+	// 未指定权重时均为 1
+	weights := make([]int64, numKeys)
+	rest := args[2+numKeys:]
+	switch {
+	case len(rest) == 0:
+		for i := range weights {
+			weights[i] = 1
+		}
+	case strings.ToLower(string(rest[0])) == "weights" && int64(len(rest)-1) == numKeys:
+		for i, arg := range rest[1:] {
+			if weights[i], err = strconv.ParseInt(string(arg), 10, 64); err != nil || weights[i] < 0 {
+				return handler.NewErrReply("CMS: invalid weight value")
+			}
+		}
+	default:
+		return handler.NewSyntaxErrReply()
+	}
+
+	dst, err := k.getAsCountMinSketch(string(args[0]))
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if dst == nil {
+		return handler.NewErrReply(errCMSNotFound.Error())
+	}
+
+	sources := make([]CountMinSketch, 0, numKeys)
+	for _, arg := range args[2 : 2+numKeys] {
+		k.ExpirePreprocess(string(arg))
+		src, err := k.getAsCountMinSketch(string(arg))
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		if src == nil {
+			return handler.NewErrReply(errCMSNotFound.Error())
+		}
+		sources = append(sources, src)
+	}
+
+	if err = dst.Merge(sources, weights); err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	// 与 aof 重写一致，以 cms.loadchunk 的形式持久化 destination 的计数器，重放时不依赖源 key
+	k.persister.PersistCmd(cmd.Ctx(), [][]byte{[]byte(database.CmdTypeCMSLoadChunk), args[0], dst.Dump()}) // 持久化
+	return handler.NewOKReply()
+}
+
+// cms.loadchunk key data
+// 用于 aof 重写时还原计数器矩阵
+func (k *KVStore) CMSLoadChunk(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	cms, err := k.getAsCountMinSketch(string(args[0]))
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
+	if cms == nil {
+		return handler.NewErrReply(errCMSNotFound.Error())
+	}
+
+	if err = cms.Load(args[1]); err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewOKReply()
+}
+
+// top-k
+
+// topk.reserve key topk [width depth decay]
+func (k *KVStore) TopKReserve(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 2 && len(args) != 5 {
+		return handler.NewSyntaxErrReply()
+	}
 
-	if list == nil {
-		return handler.NewNillReply()
+	topk, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || topk < 1 || topk > maxStringLen {
+		return handler.NewErrReply("TopK: invalid k")
 	}
 
-	if cnt == 0 {
-		cnt = 1
+	width, depth, decay := int64(topKDefaultWidth), int64(topKDefaultDepth), float64(topKDefaultDecay)
+	if len(args) == 5 {
+		if width, err = strconv.ParseInt(string(args[2]), 10, 64); err != nil || width < 1 || width > maxStringLen/12 {
+			return handler.NewErrReply("TopK: invalid width")
+		}
+		if depth, err = strconv.ParseInt(string(args[3]), 10, 64); err != nil || depth < 1 || depth > maxStringLen/12/width {
+			return handler.NewErrReply("TopK: invalid depth")
+		}
+		if decay, err = strconv.ParseFloat(string(args[4]), 64); err != nil || decay <= 0 || decay > 1 {
+			return handler.NewErrReply("TopK: invalid decay value. must be '<= 1' & '> 0'")
+		}
 	}
 
-	poped := list.RPop(cnt)
-	if poped == nil {
-		return handler.NewNillReply()
+	key := string(args[0])
+	if _, ok := k.data[key]; ok {
+		return handler.NewErrReply(errTopKExists.Error())
 	}
 
+	k.putAsTopK(key, newTopK(key, topk, width, depth, decay))
 	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
-	if len(poped) == 1 {
-		return handler.NewBulkReply(poped[0])
+	return handler.NewOKReply()
+}
+
+// topk.add key item [item ...]
+func (k *KVStore) TopKAdd(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
 	}
 
-	return handler.NewMultiBulkReply(poped)
+	increments := make([]int64, len(args)-1)
+	for i := range increments {
+		increments[i] = 1
+	}
+	return k.topKIncrBy(cmd, args[1:], increments)
 }
 
-func (k *KVStore) LRange(cmd *database.Command) handler.Reply {
+// topk.incrby key item increment [item increment ...]
+func (k *KVStore) TopKIncrBy(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
-	if len(args) != 3 {
+	if len(args) < 3 || len(args)%2 != 1 {
 		return handler.NewSyntaxErrReply()
 	}
 
-	key := string(args[0])
-	start, err := strconv.ParseInt(string(args[1]), 10, 64)
-	if err != nil {
-		return handler.NewSyntaxErrReply()
+	items := make([][]byte, 0, len(args)/2)
+	increments := make([]int64, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		incr, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil || incr < 1 || incr > topKMaxIncrement {
+			return handler.NewErrReply("TopK: increment must be an integer greater or equal to 1 and less than or equal to 100000")
+		}
+		items = append(items, args[i])
+		increments = append(increments, incr)
 	}
+	return k.topKIncrBy(cmd, items, increments)
+}
 
-	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+// 返回每个元素写入时被挤出 top k 的元素
+func (k *KVStore) topKIncrBy(cmd *database.Command, items [][]byte, increments []int64) handler.Reply {
+	topk, err := k.getAsTopK(string(cmd.Args()[0]))
 	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if topk == nil {
+		return handler.NewErrReply(errTopKNotFound.Error())
+	}
+
+	replies := make([]handler.Reply, 0, len(items))
+	for i, item := range items {
+		if expelled := topk.IncrBy(item, increments[i]); expelled != nil {
+			replies = append(replies, handler.NewBulkReply(expelled))
+			continue
+		}
+		replies = append(replies, handler.NewNillReply())
+	}
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewMultiRawReply(replies)
+}
+
+// topk.list key [WITHCOUNT]
+func (k *KVStore) TopKList(cmd *database.Command) handler.Reply {
+	args := cmd.Args()
+	if len(args) != 1 && len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+	withCount := len(args) == 2
+	if withCount && strings.ToLower(string(args[1])) != "withcount" {
 		return handler.NewSyntaxErrReply()
 	}
 
-	list, err := k.getAsList(key)
+	topk, err := k.getAsTopK(string(args[0]))
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
-
-	if list == nil {
-		return handler.NewNillReply()
+	if topk == nil {
+		return handler.NewErrReply(errTopKNotFound.Error())
 	}
 
-	if got := list.Range(start, stop); got != nil {
-		return handler.NewMultiBulkReply(got)
+	items, counts := topk.List()
+	if !withCount {
+		return handler.NewMultiBulkReply(items)
 	}
-
-	return handler.NewNillReply()
+	replies := make([]handler.Reply, 0, 2*len(items))
+	for i, item := range items {
+		replies = append(replies, handler.NewBulkReply(item), handler.NewIntReply(counts[i]))
+	}
+	return handler.NewMultiRawReply(replies)
 }
 
-// set
-func (k *KVStore) SAdd(cmd *database.Command) handler.Reply {
+// topk.query key item [item ...]
+func (k *KVStore) TopKQuery(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
-	key := string(args[0])
-	set, err := k.getAsSet(key)
+	if len(args) < 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	topk, err := k.getAsTopK(string(args[0]))
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
-
-	if set == nil {
-		set = newSetEntity(key)
-		k.putAsSet(key, set)
+	if topk == nil {
+		return handler.NewErrReply(errTopKNotFound.Error())
 	}
 
-	var added int64
-	for _, arg := range args[1:] {
-		added += set.Add(string(arg))
+	replies := make([]handler.Reply, 0, len(args)-1)
+	for _, item := range args[1:] {
+		if topk.Query(item) {
+			replies = append(replies, handler.NewIntReply(1))
+			continue
+		}
+		replies = append(replies, handler.NewIntReply(0))
 	}
-
-	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
-	return handler.NewIntReply(added)
+	return handler.NewMultiRawReply(replies)
 }
 
-func (k *KVStore) SIsMember(cmd *database.Command) handler.Reply {
+// topk.loadchunk key data
+// 用于 aof 重写时还原桶、top k 元素以及随机数状态
+func (k *KVStore) TopKLoadChunk(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
 	if len(args) != 2 {
 		return handler.NewSyntaxErrReply()
 	}
 
-	key := string(args[0])
-	set, err := k.getAsSet(key)
+	topk, err := k.getAsTopK(string(args[0]))
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
-
-	if set == nil {
-		return handler.NewIntReply(0)
+	if topk == nil {
+		return handler.NewErrReply(errTopKNotFound.Error())
 	}
 
-	return handler.NewIntReply(set.Exist(string(args[1])))
+	if err = topk.Load(args[1]); err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewOKReply()
 }
 
-func (k *KVStore) SRem(cmd *database.Command) handler.Reply {
+// json
+
+// json.set key path value [NX | XX]
+func (k *KVStore) JSONSet(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
-	key := string(args[0])
-	set, err := k.getAsSet(key)
+	if len(args) != 3 && len(args) != 4 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	var nx, xx bool
+	if len(args) == 4 {
+		switch strings.ToLower(string(args[3])) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		default:
+			return handler.NewSyntaxErrReply()
+		}
+	}
+
+	path, err := parseJSONPath(string(args[1]))
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
-
-	if set == nil {
-		return handler.NewIntReply(0)
+	value, err := parseJSON(args[2])
+	if err != nil {
+		return handler.NewErrReply(err.Error())
 	}
 
-	var remed int64
-	for _, arg := range args[1:] {
-		remed += set.Rem(string(arg))
+	key := string(args[0])
+	doc, err := k.getAsJSON(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
 	}
 
-	if remed > 0 {
+	// key 不存在时只能在根节点创建文档
+	if doc == nil {
+		if len(path.segs) > 0 {
+			return handler.NewErrReply("ERR new objects must be created at the root")
+		}
+		if xx {
+			return handler.NewNillReply()
+		}
+		k.putAsJSON(key, newJSON(key, value))
 		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+		return handler.NewOKReply()
 	}
-	return handler.NewIntReply(remed)
+
+	if !doc.Set(path, value, nx, xx) {
+		return handler.NewNillReply()
+	}
+	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	return handler.NewOKReply()
 }
 
-// hash
-func (k *KVStore) HSet(cmd *database.Command) handler.Reply {
+// json.get key [INDENT indent] [NEWLINE newline] [SPACE space] [path [path ...]]
+func (k *KVStore) JSONGet(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
-	if len(args)&1 != 1 {
+	if len(args) < 1 {
 		return handler.NewSyntaxErrReply()
 	}
 
-	key := string(args[0])
-	hmap, err := k.getAsHashMap(key)
+	var format jsonFormat
+	rest := args[1:]
+	for len(rest) >= 2 {
+		switch strings.ToLower(string(rest[0])) {
+		case "indent":
+			format.indent = string(rest[1])
+		case "newline":
+			format.newline = string(rest[1])
+		case "space":
+			format.space = string(rest[1])
+		default:
+			goto paths
+		}
+		rest = rest[2:]
+	}
+
+paths:
+	// 默认为 legacy 的根路径
+	if len(rest) == 0 {
+		rest = [][]byte{[]byte(".")}
+	}
+	paths := make([]*jsonPath, 0, len(rest))
+	legacy := true
+	for _, arg := range rest {
+		path, err := parseJSONPath(string(arg))
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		legacy = legacy && path.legacy
+		paths = append(paths, path)
+	}
+
+	doc, err := k.getAsJSON(string(args[0]))
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
+	if doc == nil {
+		return handler.NewNillReply()
+	}
 
-	if hmap == nil {
-		hmap = newHashMapEntity(key)
-		k.putAsHashMap(key, hmap)
+	// legacy 路径返回首个匹配项，否则返回全部匹配项构成的数组
+	result := func(path *jsonPath) (interface{}, error) {
+		values := doc.Get(path)
+		if !legacy {
+			return &jsonArray{elems: values}, nil
+		}
+		if len(values) == 0 {
+			return nil, errJSONPathNotExist(path.raw)
+		}
+		return values[0], nil
 	}
 
-	for i := 0; i < len(args)-1; i += 2 {
-		hkey := string(args[i+1])
-		hvalue := args[i+2]
-		hmap.Put(hkey, hvalue)
+	if len(paths) == 1 {
+		v, err := result(paths[0])
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		return handler.NewBulkReply(marshalJSON(v, &format))
 	}
 
-	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
-	return handler.NewIntReply(int64((len(args) - 1) >> 1))
+	// 多个路径时返回以路径为 key 的对象
+	obj := newJSONObject()
+	for _, path := range paths {
+		v, err := result(path)
+		if err != nil {
+			return handler.NewErrReply(err.Error())
+		}
+		obj.set(path.raw, v)
+	}
+	return handler.NewBulkReply(marshalJSON(obj, &format))
 }
 
-func (k *KVStore) HGet(cmd *database.Command) handler.Reply {
+// json.del key [path]
+func (k *KVStore) JSONDel(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
-	key := string(args[0])
-	hmap, err := k.getAsHashMap(key)
+	if len(args) != 1 && len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	rawPath := "$"
+	if len(args) == 2 {
+		rawPath = string(args[1])
+	}
+	path, err := parseJSONPath(rawPath)
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
 
-	if hmap == nil {
-		return handler.NewNillReply()
+	key := string(args[0])
+	doc, err := k.getAsJSON(key)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
+	}
+	if doc == nil {
+		return handler.NewIntReply(0)
 	}
 
-	if v := hmap.Get(string(args[1])); v != nil {
-		return handler.NewBulkReply(v)
+	// 删除根节点时删除整个 key
+	if len(path.segs) == 0 {
+		k.del(key)
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+		return handler.NewIntReply(1)
 	}
 
-	return handler.NewNillReply()
+	deleted := doc.Del(path)
+	if deleted > 0 {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	}
+	return handler.NewIntReply(deleted)
 }
 
-func (k *KVStore) HDel(cmd *database.Command) handler.Reply {
+// json.type key [path]
+func (k *KVStore) JSONType(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
-	key := string(args[0])
-	hmap, err := k.getAsHashMap(key)
+	if len(args) != 1 && len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	doc, path, err := k.getJSONPath(args, ".")
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
-
-	if hmap == nil {
-		return handler.NewIntReply(0)
+	if doc == nil {
+		return handler.NewNillReply()
 	}
 
-	var remed int64
-	for _, arg := range args[1:] {
-		remed += hmap.Del(string(arg))
+	types := doc.Types(path)
+	if path.legacy {
+		if len(types) == 0 {
+			return handler.NewNillReply()
+		}
+		return handler.NewSimpleStringReply(types[0])
 	}
 
-	if remed > 0 {
-		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	res := make([][]byte, 0, len(types))
+	for _, typ := range types {
+		res = append(res, []byte(typ))
 	}
-	return handler.NewIntReply(remed)
+	return handler.NewMultiBulkReply(res)
 }
 
-// sorted set
-func (k *KVStore) ZAdd(cmd *database.Command) handler.Reply {
+// json.arrappend key path value [value ...]
+func (k *KVStore) JSONArrAppend(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
-	if len(args)&1 != 1 {
+	if len(args) < 3 {
 		return handler.NewSyntaxErrReply()
 	}
 
-	key := string(args[0])
-	var (
-		scores  = make([]int64, 0, (len(args)-1)>>1)
-		members = make([]string, 0, (len(args)-1)>>1)
-	)
-
-	for i := 0; i < len(args)-1; i += 2 {
-		score, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+	values := make([]interface{}, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		v, err := parseJSON(arg)
 		if err != nil {
-			return handler.NewSyntaxErrReply()
+			return handler.NewErrReply(err.Error())
 		}
-
-		scores = append(scores, score)
-		members = append(members, string(args[i+2]))
+		values = append(values, v)
 	}
 
-	zset, err := k.getAsSortedSet(key)
+	doc, path, err := k.getJSONPath(args, "")
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
-
-	if zset == nil {
-		zset = newSkiplist(key)
-		k.putAsSortedSet(key, zset)
+	if doc == nil {
+		return handler.NewErrReply(errJSONNotExist.Error())
 	}
 
-	for i := 0; i < len(scores); i++ {
-		zset.Add(scores[i], members[i])
+	lens := doc.ArrAppend(path, values)
+	replies := make([]handler.Reply, 0, len(lens))
+	var last handler.Reply
+	for _, l := range lens {
+		if l < 0 {
+			replies = append(replies, handler.NewNillReply())
+			continue
+		}
+		last = handler.NewIntReply(l)
+		replies = append(replies, last)
+	}
+	if last != nil {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
 	}
 
-	k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
-	return handler.NewIntReply(int64(len(scores)))
+	// legacy 路径返回最后一个数组的长度
+	if !path.legacy {
+		return handler.NewMultiRawReply(replies)
+	}
+	if last == nil {
+		return handler.NewErrReply(errJSONPathNotExist(path.raw).Error())
+	}
+	return last
 }
 
-func (k *KVStore) ZRangeByScore(cmd *database.Command) handler.Reply {
+// json.numincrby key path value
+func (k *KVStore) JSONNumIncrBy(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
-	if len(args) < 3 {
+	if len(args) != 3 {
 		return handler.NewSyntaxErrReply()
 	}
 
-	key := string(args[0])
-	score1, err := strconv.ParseInt(string(args[1]), 10, 64)
+	delta, err := parseJSON(args[2])
 	if err != nil {
-		return handler.NewSyntaxErrReply()
+		return handler.NewErrReply(err.Error())
 	}
-	score2, err := strconv.ParseInt(string(args[2]), 10, 64)
-	if err != nil {
-		return handler.NewSyntaxErrReply()
+	switch delta.(type) {
+	case int64, float64:
+	default:
+		return handler.NewErrReply(errJSONNotNumber.Error())
 	}
 
-	zset, err := k.getAsSortedSet(key)
+	doc, path, err := k.getJSONPath(args, "")
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
-
-	if zset == nil {
-		return handler.NewNillReply()
+	if doc == nil {
+		return handler.NewErrReply(errJSONNotExist.Error())
 	}
 
-	rawRes := zset.Range(score1, score2)
-	if len(rawRes) == 0 {
-		return handler.NewNillReply()
+	res, err := doc.NumIncrBy(path, delta)
+	if err != nil {
+		return handler.NewErrReply(err.Error())
 	}
-
-	res := make([][]byte, 0, len(rawRes))
-	for _, item := range rawRes {
-		res = append(res, []byte(item))
+	var last interface{}
+	for _, v := range res {
+		if v != nil {
+			last = v
+		}
+	}
+	if last != nil {
+		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
 	}
 
-	return handler.NewMultiBulkReply(res)
+	// legacy 路径返回最后一个数字，否则返回全部结果构成的 json 数组
+	if !path.legacy {
+		return handler.NewBulkReply(marshalJSON(&jsonArray{elems: res}, nil))
+	}
+	if last == nil {
+		return handler.NewErrReply(errJSONNotNumber.Error())
+	}
+	return handler.NewBulkReply(marshalJSON(last, nil))
 }
 
-func (k *KVStore) ZRem(cmd *database.Command) handler.Reply {
+// json.objkeys key [path]
+func (k *KVStore) JSONObjKeys(cmd *database.Command) handler.Reply {
 	args := cmd.Args()
-	key := string(args[0])
-	zset, err := k.getAsSortedSet(key)
+	if len(args) != 1 && len(args) != 2 {
+		return handler.NewSyntaxErrReply()
+	}
+
+	doc, path, err := k.getJSONPath(args, ".")
 	if err != nil {
 		return handler.NewErrReply(err.Error())
 	}
+	if doc == nil {
+		return handler.NewNillReply()
+	}
 
-	if zset == nil {
-		return handler.NewIntReply(0)
+	keysList := doc.ObjKeys(path)
+	toReply := func(keys []string) handler.Reply {
+		if keys == nil {
+			return handler.NewNillReply()
+		}
+		res := make([][]byte, 0, len(keys))
+		for _, key := range keys {
+			res = append(res, []byte(key))
+		}
+		return handler.NewMultiBulkReply(res)
 	}
 
-	var remed int64
-	for _, arg := range args {
-		remed += zset.Rem(string(arg))
+	// legacy 路径返回首个对象的成员
+	if path.legacy {
+		for _, keys := range keysList {
+			if keys != nil {
+				return toReply(keys)
+			}
+		}
+		return handler.NewErrReply(errJSONPathNotExist(path.raw).Error())
 	}
 
-	if remed > 0 {
-		k.persister.PersistCmd(cmd.Ctx(), cmd.Cmd()) // 持久化
+	replies := make([]handler.Reply, 0, len(keysList))
+	for _, keys := range keysList {
+		replies = append(replies, toReply(keys))
 	}
-	return handler.NewIntReply(remed)
+	return handler.NewMultiRawReply(replies)
+}
+
+// args 为【key】+【path】，path 缺省时使用 defaultPath
+func (k *KVStore) getJSONPath(args [][]byte, defaultPath string) (JSON, *jsonPath, error) {
+	rawPath := defaultPath
+	if len(args) > 1 {
+		rawPath = string(args[1])
+	}
+	path, err := parseJSONPath(rawPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := k.getAsJSON(string(args[0]))
+	return doc, path, err
 }
@@ -0,0 +1,79 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/AlphaMinZ/myredis_go/handler"
+)
+
+// 记录持久化的指令，用于验证指令重放后的数据
+type cmdRecorder struct {
+	cmds [][][]byte
+}
+
+func (c *cmdRecorder) Reloader() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(nil)), nil
+}
+
+func (c *cmdRecorder) PersistCmd(ctx context.Context, cmd [][]byte) {
+	cp := make([][]byte, 0, len(cmd))
+	for _, arg := range cmd {
+		cp = append(cp, append([]byte(nil), arg...))
+	}
+	c.cmds = append(c.cmds, cp)
+}
+
+func (c *cmdRecorder) Close() {}
+
+type testDB struct {
+	db        handler.DB
+	persister *cmdRecorder
+}
+
+func newTestDB(t *testing.T) *testDB {
+	persister := cmdRecorder{}
+	db := database.NewDBTrigger(database.NewDBExecutor(NewKVStore(&persister, nil)))
+	t.Cleanup(db.Close)
+	return &testDB{db: db, persister: &persister}
+}
+
+// 返回 reply 的 resp 格式
+func (d *testDB) do(args ...string) string {
+	return d.doCtx(context.Background(), args...)
+}
+
+func (d *testDB) doCtx(ctx context.Context, args ...string) string {
+	cmdLine := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		cmdLine = append(cmdLine, []byte(arg))
+	}
+	return string(d.db.Do(ctx, cmdLine).ToBytes())
+}
+
+// 在新的实例中以加载 aof 的模式重放已经持久化的指令
+func (d *testDB) replay(t *testing.T) *testDB {
+	replayed := newTestDB(t)
+	ctx := handler.SetLoadingPattern(context.Background())
+	for _, cmd := range d.persister.cmds {
+		replayed.db.Do(ctx, cmd)
+	}
+	return replayed
+}
+
+// 为 key 设置即将到达的过期时间，之后通过 waitExpired 等待 key 过期
+func (d *testDB) expireSoon(t *testing.T, keys ...string) {
+	for _, key := range keys {
+		if reply := d.do("pexpire", key, "20"); reply != ":1\r\n" {
+			t.Fatalf("pexpire %s: %q", key, reply)
+		}
+	}
+}
+
+func waitExpired() {
+	time.Sleep(40 * time.Millisecond)
+}
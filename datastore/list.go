@@ -1,6 +1,13 @@
 package datastore
 
 import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/AlphaMinZ/myredis_go/database"
 	"github.com/AlphaMinZ/myredis_go/handler"
 )
@@ -20,7 +27,14 @@ func (k *KVStore) getAsList(key string) (List, error) {
 }
 
 func (k *KVStore) putAsList(key string, list List) {
-	k.data[key] = list
+	k.putData(key, list)
+}
+
+// 与 redis 保持一致，list 中元素被移除完毕后，同时删除 key
+func (k *KVStore) delIfEmptyList(key string, list List) {
+	if list.Len() == 0 {
+		k.del(key)
+	}
 }
 
 type List interface {
@@ -30,72 +44,532 @@ type List interface {
 	RPop(cnt int64) [][]byte
 	Len() int64
 	Range(start, stop int64) [][]byte
+	Index(index int64) ([]byte, bool)
+	Set(index int64, value []byte) bool
+	Insert(pivot, value []byte, before bool) int64
+	Rem(cnt int64, value []byte) int64
+	Trim(start, stop int64)
+	Pos(value []byte, rank, cnt, maxLen int64) []int64
 	database.CmdAdapter
 }
 
+// 单个 chunk 最多容纳的元素个数
+const listChunkSize = 128
+
+// quicklist 中的节点. elems[start:end] 为有效元素，头尾预留空位使得两端插入均为 O(1)
+type listChunk struct {
+	prev, next *listChunk
+	elems      [][]byte
+	start, end int
+}
+
+func newListChunk(elements [][]byte) *listChunk {
+	elems := make([][]byte, len(elements))
+	copy(elems, elements)
+	return &listChunk{
+		elems: elems,
+		end:   len(elems),
+	}
+}
+
+func (c *listChunk) len() int {
+	return c.end - c.start
+}
+
+func (c *listChunk) full() bool {
+	return c.len() >= listChunkSize
+}
+
+// 按倍数扩容，left 为 true 时在头部留出空位，否则在尾部留出空位
+func (c *listChunk) grow(left bool) {
+	n := c.len()
+	capacity := 2 * len(c.elems)
+	if capacity < 4 {
+		capacity = 4
+	}
+	if capacity > listChunkSize {
+		capacity = listChunkSize
+	}
+
+	elems := make([][]byte, capacity)
+	var start int
+	if left {
+		start = capacity - n
+	}
+	copy(elems[start:], c.elems[c.start:c.end])
+	c.elems, c.start, c.end = elems, start, start+n
+}
+
+func (c *listChunk) pushFront(value []byte) {
+	if c.start == 0 {
+		c.grow(true)
+	}
+	c.start--
+	c.elems[c.start] = value
+}
+
+func (c *listChunk) pushBack(value []byte) {
+	if c.end == len(c.elems) {
+		c.grow(false)
+	}
+	c.elems[c.end] = value
+	c.end++
+}
+
+// 在 chunk 内第 i 个元素的位置插入 value，调用方需要保证 chunk 未满
+func (c *listChunk) insert(i int, value []byte) {
+	if c.end == len(c.elems) {
+		c.grow(false)
+	}
+	copy(c.elems[c.start+i+1:c.end+1], c.elems[c.start+i:c.end])
+	c.elems[c.start+i] = value
+	c.end++
+}
+
+// 移除满足 match 的元素，最多移除 limit 个，limit 为 0 时不限制. reverse 为 true 时从尾部开始移除
+func (c *listChunk) remove(match func([]byte) bool, limit int64, reverse bool) int64 {
+	var remed int64
+	if !reverse {
+		w := c.start
+		for i := c.start; i < c.end; i++ {
+			if (limit == 0 || remed < limit) && match(c.elems[i]) {
+				remed++
+				continue
+			}
+			c.elems[w] = c.elems[i]
+			w++
+		}
+		clear(c.elems[w:c.end])
+		c.end = w
+		return remed
+	}
+
+	w := c.end - 1
+	for i := c.end - 1; i >= c.start; i-- {
+		if (limit == 0 || remed < limit) && match(c.elems[i]) {
+			remed++
+			continue
+		}
+		c.elems[w] = c.elems[i]
+		w--
+	}
+	clear(c.elems[c.start : w+1])
+	c.start = w + 1
+	return remed
+}
+
+// 基于 chunk 双向链表实现的 quicklist. 两端的插入、弹出为 O(1)，下标访问为 O(n/listChunkSize)
 type listEntity struct {
-	key  string
-	data [][]byte
+	key        string
+	head, tail *listChunk
+	len        int64
 }
 
 func newListEntity(key string, elements ...[]byte) List {
-	return &listEntity{
-		key:  key,
-		data: elements,
+	l := listEntity{
+		key: key,
+	}
+	for _, element := range elements {
+		l.RPush(element)
 	}
+	return &l
 }
 
 func (l *listEntity) LPush(value []byte) {
-	l.data = append([][]byte{value}, l.data...)
+	if l.head == nil || l.head.full() {
+		l.linkBefore(l.head, &listChunk{})
+	}
+	l.head.pushFront(value)
+	l.len++
 }
 
 func (l *listEntity) LPop(cnt int64) [][]byte {
-	if int64(len(l.data)) < cnt {
+	if l.len < cnt {
 		return nil
 	}
 
-	poped := l.data[:cnt]
-	l.data = l.data[cnt:]
+	poped := make([][]byte, 0, cnt)
+	for c := l.head; int64(len(poped)) < cnt; c = c.next {
+		n := cnt - int64(len(poped))
+		if n > int64(c.len()) {
+			n = int64(c.len())
+		}
+		poped = append(poped, c.elems[c.start:c.start+int(n)]...)
+	}
+	l.dropFront(cnt)
 	return poped
 }
 
 func (l *listEntity) RPush(value []byte) {
-	l.data = append(l.data, value)
+	if l.tail == nil || l.tail.full() {
+		l.linkAfter(l.tail, &listChunk{})
+	}
+	l.tail.pushBack(value)
+	l.len++
 }
 
+// 返回尾部 cnt 个元素，保持其在 list 中的顺序
 func (l *listEntity) RPop(cnt int64) [][]byte {
-	if int64(len(l.data)) < cnt {
+	if l.len < cnt {
 		return nil
 	}
 
-	poped := l.data[int64(len(l.data))-cnt:]
-	l.data = l.data[:int64(len(l.data))-cnt]
+	poped := make([][]byte, cnt)
+	i := cnt
+	for c := l.tail; i > 0; c = c.prev {
+		n := i
+		if n > int64(c.len()) {
+			n = int64(c.len())
+		}
+		i -= n
+		copy(poped[i:], c.elems[c.end-int(n):c.end])
+	}
+	l.dropBack(cnt)
 	return poped
 }
 
 func (l *listEntity) Len() int64 {
-	return int64(len(l.data))
+	return l.len
 }
 
+// [start,stop]，支持负数下标，越界部分会被截断
 func (l *listEntity) Range(start, stop int64) [][]byte {
-	if stop == -1 {
-		stop = int64(len(l.data) - 1)
+	start, stop, ok := normalizeListRange(start, stop, l.Len())
+	if !ok {
+		return [][]byte{}
 	}
 
-	if start < 0 || start >= int64(len(l.data)) {
-		return nil
+	res := make([][]byte, 0, stop-start+1)
+	c, offset := l.locate(start)
+	for ; int64(len(res)) <= stop-start; c, offset = c.next, 0 {
+		n := stop - start + 1 - int64(len(res))
+		if n > int64(c.len()-offset) {
+			n = int64(c.len() - offset)
+		}
+		res = append(res, c.elems[c.start+offset:c.start+offset+int(n)]...)
 	}
+	return res
+}
 
-	if stop < 0 || stop >= int64(len(l.data)) || stop < start {
-		return nil
+func (l *listEntity) Index(index int64) ([]byte, bool) {
+	index, ok := normalizeListIndex(index, l.Len())
+	if !ok {
+		return nil, false
+	}
+	c, offset := l.locate(index)
+	return c.elems[c.start+offset], true
+}
+
+func (l *listEntity) Set(index int64, value []byte) bool {
+	index, ok := normalizeListIndex(index, l.Len())
+	if !ok {
+		return false
+	}
+	c, offset := l.locate(index)
+	c.elems[c.start+offset] = value
+	return true
+}
+
+// 在首个 pivot 元素前/后插入 value. 返回插入后的长度，pivot 不存在时返回 -1
+func (l *listEntity) Insert(pivot, value []byte, before bool) int64 {
+	for c := l.head; c != nil; c = c.next {
+		for i := 0; i < c.len(); i++ {
+			if !bytes.Equal(c.elems[c.start+i], pivot) {
+				continue
+			}
+			if !before {
+				i++
+			}
+
+			// chunk 已满时，拆分为两个 chunk
+			if c.full() {
+				half := c.len() / 2
+				l.linkAfter(c, newListChunk(c.elems[c.start+half:c.end]))
+				clear(c.elems[c.start+half : c.end])
+				c.end = c.start + half
+				if i > half {
+					c, i = c.next, i-half
+				}
+			}
+			c.insert(i, value)
+			l.len++
+			return l.len
+		}
+	}
+	return -1
+}
+
+// cnt > 0 时从头部开始移除，cnt < 0 时从尾部开始移除，cnt = 0 时全部移除
+func (l *listEntity) Rem(cnt int64, value []byte) int64 {
+	var remed int64
+	limit := cnt
+	if limit < 0 {
+		limit = -limit
+	}
+	match := func(element []byte) bool {
+		return bytes.Equal(element, value)
+	}
+
+	if cnt >= 0 {
+		for c := l.head; c != nil && (limit == 0 || remed < limit); {
+			next := c.next
+			if limit == 0 {
+				remed += c.remove(match, 0, false)
+			} else {
+				remed += c.remove(match, limit-remed, false)
+			}
+			if c.len() == 0 {
+				l.unlink(c)
+			}
+			c = next
+		}
+	} else {
+		for c := l.tail; c != nil && remed < limit; {
+			prev := c.prev
+			remed += c.remove(match, limit-remed, true)
+			if c.len() == 0 {
+				l.unlink(c)
+			}
+			c = prev
+		}
 	}
 
-	return l.data[start : stop+1]
+	l.len -= remed
+	return remed
+}
+
+// 仅保留 [start,stop] 范围内的元素
+func (l *listEntity) Trim(start, stop int64) {
+	start, stop, ok := normalizeListRange(start, stop, l.Len())
+	if !ok {
+		l.head, l.tail, l.len = nil, nil, 0
+		return
+	}
+	l.dropBack(l.len - 1 - stop)
+	l.dropFront(start)
+}
+
+// 返回 value 的下标. rank 为负数时从尾部开始查找，跳过前 |rank|-1 个匹配项；
+// cnt 为 0 时返回全部匹配项；maxLen 为 0 时不限制比较的元素个数
+func (l *listEntity) Pos(value []byte, rank, cnt, maxLen int64) []int64 {
+	var (
+		res      []int64
+		skipped  int64
+		compared int64
+	)
+	visit := func(i int64, element []byte) bool {
+		if maxLen > 0 && compared >= maxLen {
+			return false
+		}
+		compared++
+		if !bytes.Equal(element, value) {
+			return true
+		}
+		if skipped++; skipped < rank {
+			return true
+		}
+		res = append(res, i)
+		return cnt == 0 || int64(len(res)) < cnt
+	}
+
+	if rank > 0 {
+		l.forEach(visit)
+		return res
+	}
+
+	rank = -rank
+	i := l.len - 1
+	for c := l.tail; c != nil; c = c.prev {
+		for j := c.end - 1; j >= c.start; j-- {
+			if !visit(i, c.elems[j]) {
+				return res
+			}
+			i--
+		}
+	}
+	return res
+}
+
+func (l *listEntity) Encoding() string {
+	return "quicklist"
+}
+
+func (l *listEntity) setKey(key string) {
+	l.key = key
 }
 
 func (l *listEntity) ToCmd() [][]byte {
 	args := make([][]byte, 0, 2+l.Len())
 	args = append(args, []byte(database.CmdTypeRPush), []byte(l.key))
-	args = append(args, l.data...)
+	l.forEach(func(_ int64, element []byte) bool {
+		args = append(args, element)
+		return true
+	})
 	return args
 }
+
+// 从头部开始遍历，f 返回 false 时终止
+func (l *listEntity) forEach(f func(i int64, element []byte) bool) {
+	var i int64
+	for c := l.head; c != nil; c = c.next {
+		for j := c.start; j < c.end; j++ {
+			if !f(i, c.elems[j]) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+// 返回下标 index 所在的 chunk 及其在 chunk 内的偏移量，根据距离选择从头部或尾部开始查找
+func (l *listEntity) locate(index int64) (*listChunk, int) {
+	if index < l.len/2 {
+		c := l.head
+		for index >= int64(c.len()) {
+			index -= int64(c.len())
+			c = c.next
+		}
+		return c, int(index)
+	}
+
+	index = l.len - 1 - index
+	c := l.tail
+	for index >= int64(c.len()) {
+		index -= int64(c.len())
+		c = c.prev
+	}
+	return c, c.len() - 1 - int(index)
+}
+
+// 移除头部 n 个元素
+func (l *listEntity) dropFront(n int64) {
+	l.len -= n
+	for n > 0 {
+		c := l.head
+		if n >= int64(c.len()) {
+			n -= int64(c.len())
+			l.unlink(c)
+			continue
+		}
+		clear(c.elems[c.start : c.start+int(n)])
+		c.start += int(n)
+		n = 0
+	}
+}
+
+// 移除尾部 n 个元素
+func (l *listEntity) dropBack(n int64) {
+	l.len -= n
+	for n > 0 {
+		c := l.tail
+		if n >= int64(c.len()) {
+			n -= int64(c.len())
+			l.unlink(c)
+			continue
+		}
+		clear(c.elems[c.end-int(n) : c.end])
+		c.end -= int(n)
+		n = 0
+	}
+}
+
+// 将 c 插入到 mark 之前，mark 为 nil 时插入到尾部
+func (l *listEntity) linkBefore(mark, c *listChunk) {
+	if mark == nil {
+		l.linkAfter(l.tail, c)
+		return
+	}
+	c.prev, c.next = mark.prev, mark
+	if mark.prev == nil {
+		l.head = c
+	} else {
+		mark.prev.next = c
+	}
+	mark.prev = c
+}
+
+// 将 c 插入到 mark 之后，mark 为 nil 时插入到头部
+func (l *listEntity) linkAfter(mark, c *listChunk) {
+	if mark == nil {
+		c.prev, c.next = nil, l.head
+		if l.head == nil {
+			l.tail = c
+		} else {
+			l.head.prev = c
+		}
+		l.head = c
+		return
+	}
+	c.prev, c.next = mark, mark.next
+	if mark.next == nil {
+		l.tail = c
+	} else {
+		mark.next.prev = c
+	}
+	mark.next = c
+}
+
+func (l *listEntity) unlink(c *listChunk) {
+	if c.prev == nil {
+		l.head = c.next
+	} else {
+		c.prev.next = c.next
+	}
+	if c.next == nil {
+		l.tail = c.prev
+	} else {
+		c.next.prev = c.prev
+	}
+	c.prev, c.next = nil, nil
+}
+
+func parseListDirection(b []byte) (bool, error) {
+	switch strings.ToLower(string(b)) {
+	case "left":
+		return true, nil
+	case "right":
+		return false, nil
+	default:
+		return false, handler.NewSyntaxErrReply()
+	}
+}
+
+// 阻塞指令的超时时间，单位为秒，支持小数. 0 代表永久阻塞
+func parseBlockTimeout(b []byte) (time.Duration, error) {
+	timeout, err := strconv.ParseFloat(string(b), 64)
+	if err != nil || math.IsNaN(timeout) || timeout*float64(time.Second) >= math.MaxInt64 {
+		return 0, errors.New("ERR timeout is not a float or out of range")
+	}
+	if timeout < 0 {
+		return 0, errors.New("ERR timeout is negative")
+	}
+	return time.Duration(timeout * float64(time.Second)), nil
+}
+
+// 负数下标转为正数下标，判断是否越界
+func normalizeListIndex(index, length int64) (int64, bool) {
+	if index < 0 {
+		index += length
+	}
+	return index, index >= 0 && index < length
+}
+
+// 将 [start,stop] 转为合法的正数闭区间，区间为空时 ok 为 false
+func normalizeListRange(start, stop, length int64) (int64, int64, bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
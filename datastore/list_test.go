@@ -88,3 +88,194 @@ func Test_list_to_cmds(t *testing.T) {
 		assert.Equal(t, expect, actual)
 	})
 }
+
+func Test_list_edit(t *testing.T) {
+	list := newListEntity("")
+	l := make([][]byte, 0, 1000)
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	for i := 0; i < 1000; i++ {
+		member := []byte(cast.ToString(rander.Intn(10)))
+		list.RPush(member)
+		l = append(l, member)
+	}
+
+	t.Run("index", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			index := rander.Intn(1000)
+			actual, ok := list.Index(int64(index))
+			assert.True(t, ok)
+			assert.Equal(t, l[index], actual)
+
+			actual, ok = list.Index(int64(index - 1000))
+			assert.True(t, ok)
+			assert.Equal(t, l[index], actual)
+		}
+	})
+
+	t.Run("negative_range", func(t *testing.T) {
+		assert.Equal(t, l[990:], list.Range(-10, -1))
+		assert.Equal(t, l, list.Range(-2000, 2000))
+		assert.Equal(t, [][]byte{}, list.Range(-1, -2))
+	})
+
+	t.Run("rem", func(t *testing.T) {
+		target := []byte(cast.ToString(rander.Intn(10)))
+		var expect [][]byte
+		for _, member := range l {
+			if string(member) != string(target) {
+				expect = append(expect, member)
+			}
+		}
+		remed := list.Rem(0, target)
+		assert.Equal(t, int64(len(l)-len(expect)), remed)
+		assert.Equal(t, expect, list.Range(0, -1))
+		l = expect
+	})
+
+	t.Run("pos", func(t *testing.T) {
+		target := l[len(l)/2]
+		var expect []int64
+		for i, member := range l {
+			if string(member) == string(target) {
+				expect = append(expect, int64(i))
+			}
+		}
+		assert.Equal(t, expect, list.Pos(target, 1, 0, 0))
+		assert.Equal(t, expect[1:2], list.Pos(target, 2, 1, 0))
+		assert.Equal(t, []int64{expect[len(expect)-1]}, list.Pos(target, -1, 1, 0))
+	})
+
+	t.Run("insert", func(t *testing.T) {
+		// 反复在同一位置插入，触发 chunk 拆分
+		pivot := l[len(l)/2]
+		index := 0
+		for string(l[index]) != string(pivot) {
+			index++
+		}
+		for i := 0; i < 300; i++ {
+			member := []byte(cast.ToString(100 + i))
+			assert.Equal(t, int64(len(l)+1), list.Insert(pivot, member, true))
+			l = append(l[:index], append([][]byte{member}, l[index:]...)...)
+			index++
+		}
+		assert.Equal(t, l, list.Range(0, -1))
+		assert.Equal(t, int64(-1), list.Insert([]byte("none"), []byte("x"), true))
+	})
+
+	t.Run("trim", func(t *testing.T) {
+		list.Trim(10, -11)
+		assert.Equal(t, l[10:len(l)-10], list.Range(0, -1))
+	})
+}
+
+// 基于切片实现的 list，作为 quicklist 的性能对照
+type sliceList struct {
+	data [][]byte
+}
+
+func (l *sliceList) LPush(value []byte) {
+	l.data = append([][]byte{value}, l.data...)
+}
+
+func (l *sliceList) LPop() []byte {
+	poped := l.data[0]
+	l.data = l.data[1:]
+	return poped
+}
+
+func (l *sliceList) RPush(value []byte) {
+	l.data = append(l.data, value)
+}
+
+func (l *sliceList) Index(index int64) []byte {
+	return l.data[index]
+}
+
+const benchmarkListLen = 100000
+
+func Benchmark_list_lpush(b *testing.B) {
+	member := []byte("member")
+	b.Run("quicklist", func(b *testing.B) {
+		list := newListEntity("")
+		for i := 0; i < benchmarkListLen; i++ {
+			list.RPush(member)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			list.LPush(member)
+			list.LPop(1)
+		}
+	})
+
+	b.Run("slice", func(b *testing.B) {
+		list := &sliceList{}
+		for i := 0; i < benchmarkListLen; i++ {
+			list.RPush(member)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			list.LPush(member)
+			list.LPop()
+		}
+	})
+}
+
+func Benchmark_list_rpush(b *testing.B) {
+	member := []byte("member")
+	b.Run("quicklist", func(b *testing.B) {
+		list := newListEntity("")
+		for i := 0; i < b.N; i++ {
+			list.RPush(member)
+		}
+	})
+
+	b.Run("slice", func(b *testing.B) {
+		list := &sliceList{}
+		for i := 0; i < b.N; i++ {
+			list.RPush(member)
+		}
+	})
+}
+
+func Benchmark_list_index(b *testing.B) {
+	member := []byte("member")
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	b.Run("quicklist", func(b *testing.B) {
+		list := newListEntity("")
+		for i := 0; i < benchmarkListLen; i++ {
+			list.RPush(member)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			list.Index(rander.Int63n(benchmarkListLen))
+		}
+	})
+
+	b.Run("slice", func(b *testing.B) {
+		list := &sliceList{}
+		for i := 0; i < benchmarkListLen; i++ {
+			list.RPush(member)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			list.Index(rander.Int63n(benchmarkListLen))
+		}
+	})
+}
+
+func Test_lmove_replay(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, ":3\r\n", db.do("rpush", "l1", "a", "b", "c"))
+	assert.Equal(t, ":1\r\n", db.do("rpush", "l3", "x"))
+	db.expireSoon(t, "l1")
+	assert.Equal(t, "$1\r\na\r\n", db.do("lmove", "l1", "l2", "LEFT", "RIGHT"))
+	assert.Equal(t, "$1\r\nc\r\n", db.do("lmove", "l1", "l2", "RIGHT", "LEFT"))
+	// src 与 dst 相同时轮转元素
+	assert.Equal(t, "$1\r\nx\r\n", db.do("lmove", "l3", "l3", "LEFT", "RIGHT"))
+	waitExpired()
+
+	replayed := db.replay(t)
+	assert.Equal(t, ":0\r\n", replayed.do("exists", "l1"))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\na\r\n", replayed.do("lrange", "l2", "0", "-1"))
+	assert.Equal(t, db.do("lrange", "l3", "0", "-1"), replayed.do("lrange", "l3", "0", "-1"))
+}
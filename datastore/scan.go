@@ -0,0 +1,236 @@
+package datastore
+
+import (
+	"errors"
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/AlphaMinZ/myredis_go/handler"
+)
+
+const (
+	scanIndexMinBuckets = 16
+	scanDefaultCount    = 10
+	// 负数 count 时允许返回的最大成员数
+	maxRandomCount = 1 << 24
+)
+
+// 基于散列桶实现的成员索引，用于支持无状态的 scan 游标.
+// 游标采用 redis 的高位进位（reverse binary）方式递增，保证两次 scan 之间即便发生了扩缩容，
+// 在整个遍历过程中始终存在的成员也至少会被返回一次
+type scanIndex struct {
+	seed    maphash.Seed
+	buckets [][]string
+	size    int
+}
+
+func newScanIndex() *scanIndex {
+	return &scanIndex{
+		seed:    maphash.MakeSeed(),
+		buckets: make([][]string, scanIndexMinBuckets),
+	}
+}
+
+// 调用方需要保证 member 此前不存在于索引中
+func (s *scanIndex) add(member string) {
+	s.size++
+	if s.size > len(s.buckets)<<1 {
+		s.resize(len(s.buckets) << 1)
+	}
+	i := s.bucketOf(member)
+	s.buckets[i] = append(s.buckets[i], member)
+}
+
+func (s *scanIndex) rem(member string) {
+	i := s.bucketOf(member)
+	bucket := s.buckets[i]
+	for j := range bucket {
+		if bucket[j] != member {
+			continue
+		}
+		bucket[j] = bucket[len(bucket)-1]
+		bucket[len(bucket)-1] = ""
+		s.buckets[i] = bucket[:len(bucket)-1]
+		s.size--
+		break
+	}
+
+	if len(s.buckets) > scanIndexMinBuckets && s.size<<3 < len(s.buckets) {
+		s.resize(len(s.buckets) >> 1)
+	}
+}
+
+// 从 cursor 开始遍历，直到至少返回 count 个成员或者遍历结束. 返回值中的游标为 0 代表遍历结束
+func (s *scanIndex) scan(cursor uint64, count int64) (uint64, []string) {
+	if count <= 0 {
+		count = scanDefaultCount
+	}
+
+	mask := uint64(len(s.buckets) - 1)
+	members := make([]string, 0, count)
+	for {
+		members = append(members, s.buckets[cursor&mask]...)
+
+		// 对游标的高位进行 +1 操作
+		cursor |= ^mask
+		cursor = bits.Reverse64(cursor)
+		cursor++
+		cursor = bits.Reverse64(cursor)
+
+		if cursor == 0 || int64(len(members)) >= count {
+			return cursor, members
+		}
+	}
+}
+
+// 随机返回一个成员，调用方需要保证索引非空
+func (s *scanIndex) random() string {
+	for {
+		bucket := s.buckets[rand.Intn(len(s.buckets))]
+		if len(bucket) > 0 {
+			return bucket[rand.Intn(len(bucket))]
+		}
+	}
+}
+
+// 随机返回成员. cnt > 0 时返回至多 cnt 个不重复的成员，cnt < 0 时返回 |cnt| 个可能重复的成员
+func (s *scanIndex) randomMembers(cnt int64) []string {
+	if s.size == 0 || cnt == 0 {
+		return nil
+	}
+
+	// 可能重复的成员边取边扩容，不按 |cnt| 预分配
+	if cnt < 0 {
+		var members []string
+		for i := int64(0); i < -cnt; i++ {
+			members = append(members, s.random())
+		}
+		return members
+	}
+
+	// 先把 cnt 收敛到全集大小，避免后续运算溢出和超大预分配
+	if cnt > int64(s.size) {
+		cnt = int64(s.size)
+	}
+
+	// 数量接近全集时，打乱全集后截取；否则随机挑选并去重
+	if cnt*3 > int64(s.size) {
+		members := make([]string, 0, s.size)
+		for _, bucket := range s.buckets {
+			members = append(members, bucket...)
+		}
+		rand.Shuffle(len(members), func(i, j int) {
+			members[i], members[j] = members[j], members[i]
+		})
+		if cnt < int64(len(members)) {
+			members = members[:cnt]
+		}
+		return members
+	}
+
+	picked := make(map[string]struct{}, cnt)
+	members := make([]string, 0, cnt)
+	for int64(len(members)) < cnt {
+		member := s.random()
+		if _, ok := picked[member]; ok {
+			continue
+		}
+		picked[member] = struct{}{}
+		members = append(members, member)
+	}
+	return members
+}
+
+// 解析 hrandfield、srandmember 等指令的 count 参数
+func parseRandomCount(b []byte) (int64, error) {
+	cnt, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0, errors.New("ERR value is not an integer or out of range")
+	}
+	// 负数 count 需要逐个生成可能重复的成员，过大时会长时间阻塞执行协程
+	if cnt < -maxRandomCount || cnt > math.MaxInt64/2 {
+		return 0, errors.New("ERR value is out of range")
+	}
+	return cnt, nil
+}
+
+func (s *scanIndex) bucketOf(member string) uint64 {
+	return maphash.String(s.seed, member) & uint64(len(s.buckets)-1)
+}
+
+func (s *scanIndex) resize(n int) {
+	old := s.buckets
+	s.buckets = make([][]string, n)
+	for _, bucket := range old {
+		for _, member := range bucket {
+			i := s.bucketOf(member)
+			s.buckets[i] = append(s.buckets[i], member)
+		}
+	}
+}
+
+// scan 系列指令的参数. cursor [MATCH pattern] [COUNT count] [TYPE type]
+type scanArgs struct {
+	cursor  uint64
+	pattern string
+	count   int64
+	typ     string
+}
+
+func parseScanArgs(args [][]byte, allowType bool) (*scanArgs, error) {
+	if len(args) == 0 {
+		return nil, errors.New("ERR syntax error")
+	}
+
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return nil, errors.New("ERR invalid cursor")
+	}
+
+	scan := scanArgs{
+		cursor:  cursor,
+		pattern: "*",
+		count:   scanDefaultCount,
+	}
+	for i := 1; i < len(args); i += 2 {
+		if i == len(args)-1 {
+			return nil, errors.New("ERR syntax error")
+		}
+
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			scan.pattern = value
+		case "count":
+			count, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, errors.New("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return nil, errors.New("ERR syntax error")
+			}
+			scan.count = count
+		case "type":
+			if !allowType {
+				return nil, errors.New("ERR syntax error")
+			}
+			scan.typ = strings.ToLower(value)
+		default:
+			return nil, errors.New("ERR syntax error")
+		}
+	}
+
+	return &scan, nil
+}
+
+// scan 系列指令的响应. 【游标】+【成员数组】
+func scanReply(cursor uint64, members [][]byte) handler.Reply {
+	return handler.NewMultiRawReply([]handler.Reply{
+		handler.NewBulkReply([]byte(strconv.FormatUint(cursor, 10))),
+		handler.NewMultiBulkReply(members),
+	})
+}
@@ -0,0 +1,85 @@
+package datastore
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/AlphaMinZ/myredis_go/lib"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_scan_index_full_iteration(t *testing.T) {
+	index := newScanIndex()
+	expect := make(map[string]struct{}, 1000)
+	for i := 0; i < 1000; i++ {
+		member := cast.ToString(i)
+		index.add(member)
+		expect[member] = struct{}{}
+	}
+
+	actual := make(map[string]struct{}, 1000)
+	var cursor uint64
+	for {
+		var members []string
+		cursor, members = index.scan(cursor, 10)
+		for _, member := range members {
+			actual[member] = struct{}{}
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	assert.Equal(t, expect, actual)
+}
+
+func Test_scan_index_with_resize(t *testing.T) {
+	index := newScanIndex()
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+
+	// 全程存在的成员
+	stable := make(map[string]struct{}, 500)
+	for i := 0; i < 500; i++ {
+		member := cast.ToString(i)
+		index.add(member)
+		stable[member] = struct{}{}
+	}
+
+	// 遍历过程中不断增删成员，触发扩缩容
+	var (
+		cursor   uint64
+		volatile []string
+		next     = 500
+		seen     = make(map[string]struct{}, 500)
+	)
+	for {
+		var members []string
+		cursor, members = index.scan(cursor, 10)
+		for _, member := range members {
+			seen[member] = struct{}{}
+		}
+		if cursor == 0 {
+			break
+		}
+
+		if rander.Intn(2) == 0 {
+			for i := 0; i < 200; i++ {
+				member := cast.ToString(next)
+				next++
+				index.add(member)
+				volatile = append(volatile, member)
+			}
+			continue
+		}
+		for len(volatile) > 0 {
+			index.rem(volatile[len(volatile)-1])
+			volatile = volatile[:len(volatile)-1]
+		}
+	}
+
+	for member := range stable {
+		_, ok := seen[member]
+		assert.True(t, ok, member)
+	}
+}
@@ -1,6 +1,10 @@
 package datastore
 
 import (
+	"math/rand"
+	"sort"
+	"strconv"
+
 	"github.com/AlphaMinZ/myredis_go/database"
 	"github.com/AlphaMinZ/myredis_go/handler"
 )
@@ -20,37 +24,104 @@ func (k *KVStore) getAsSet(key string) (Set, error) {
 }
 
 func (k *KVStore) putAsSet(key string, set Set) {
-	k.data[key] = set
+	k.putData(key, set)
+}
+
+// 获取多个 set，key 不存在时对应位置为 nil
+func (k *KVStore) getAsSets(keys [][]byte) ([]Set, error) {
+	sets := make([]Set, 0, len(keys))
+	for _, key := range keys {
+		k.ExpirePreprocess(string(key))
+		set, err := k.getAsSet(string(key))
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+// 与 redis 保持一致，set 中元素被移除完毕后，同时删除 key
+func (k *KVStore) delIfEmptySet(key string, set Set) {
+	if set.Len() == 0 {
+		k.del(key)
+	}
 }
 
 type Set interface {
 	Add(value string) int64
 	Exist(value string) int64
 	Rem(value string) int64
+	Len() int64
+	ForEach(f func(value string))
+	RandomMembers(cnt int64) []string
+	Scan(cursor uint64, count int64) (uint64, []string)
 	database.CmdAdapter
 }
 
+// set 的默认 intset 编码阈值，与 redis 保持一致
+const defaultMaxIntsetEntries = 512
+
+// 元素均为整数且个数不超过阈值时，采用有序整数数组（intset）编码；否则采用 map（hashtable）编码.
+// 编码一旦转为 hashtable 就不再转回
 type setEntity struct {
-	key       string
-	container map[string]struct{}
+	key              string
+	intset           []int64
+	container        map[string]struct{}
+	index            *scanIndex
+	maxIntsetEntries int
 }
 
-func newSetEntity(key string) Set {
+func newSetEntity(key string, maxIntsetEntries int) Set {
+	if maxIntsetEntries <= 0 {
+		maxIntsetEntries = defaultMaxIntsetEntries
+	}
 	return &setEntity{
-		key:       key,
-		container: make(map[string]struct{}),
+		key:              key,
+		intset:           []int64{},
+		maxIntsetEntries: maxIntsetEntries,
 	}
 }
 
 func (s *setEntity) Add(value string) int64 {
+	if s.isIntset() {
+		num, ok := parseStrictInt([]byte(value))
+		if ok {
+			i, exist := s.search(num)
+			if exist {
+				return 0
+			}
+			if len(s.intset) < s.maxIntsetEntries {
+				s.intset = append(s.intset, 0)
+				copy(s.intset[i+1:], s.intset[i:])
+				s.intset[i] = num
+				return 1
+			}
+		}
+		// 出现非整数元素或者超过阈值，转为 hashtable 编码
+		s.toHashtable()
+	}
+
 	if _, ok := s.container[value]; ok {
 		return 0
 	}
 	s.container[value] = struct{}{}
+	s.index.add(value)
 	return 1
 }
 
 func (s *setEntity) Exist(value string) int64 {
+	if s.isIntset() {
+		num, ok := parseStrictInt([]byte(value))
+		if !ok {
+			return 0
+		}
+		if _, exist := s.search(num); exist {
+			return 1
+		}
+		return 0
+	}
+
 	if _, ok := s.container[value]; ok {
 		return 1
 	}
@@ -58,19 +129,196 @@ func (s *setEntity) Exist(value string) int64 {
 }
 
 func (s *setEntity) Rem(value string) int64 {
+	if s.isIntset() {
+		num, ok := parseStrictInt([]byte(value))
+		if !ok {
+			return 0
+		}
+		i, exist := s.search(num)
+		if !exist {
+			return 0
+		}
+		s.intset = append(s.intset[:i], s.intset[i+1:]...)
+		return 1
+	}
+
 	if _, ok := s.container[value]; ok {
 		delete(s.container, value)
+		s.index.rem(value)
 		return 1
 	}
 	return 0
 }
 
+func (s *setEntity) Len() int64 {
+	if s.isIntset() {
+		return int64(len(s.intset))
+	}
+	return int64(len(s.container))
+}
+
+func (s *setEntity) ForEach(f func(value string)) {
+	if s.isIntset() {
+		for _, num := range s.intset {
+			f(strconv.FormatInt(num, 10))
+		}
+		return
+	}
+
+	for value := range s.container {
+		f(value)
+	}
+}
+
+// cnt > 0 时返回至多 cnt 个不重复的元素，cnt < 0 时返回 |cnt| 个可能重复的元素
+func (s *setEntity) RandomMembers(cnt int64) []string {
+	if !s.isIntset() {
+		return s.index.randomMembers(cnt)
+	}
+
+	n := int64(len(s.intset))
+	if n == 0 || cnt == 0 {
+		return nil
+	}
+
+	var indexes []int
+	if cnt < 0 {
+		// 边取边扩容，不按 |cnt| 预分配
+		for i := int64(0); i < -cnt; i++ {
+			indexes = append(indexes, rand.Intn(int(n)))
+		}
+	} else {
+		// intset 元素个数有限，直接打乱下标后截取
+		indexes = rand.Perm(int(n))
+		if cnt < n {
+			indexes = indexes[:cnt]
+		}
+	}
+
+	members := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		members = append(members, strconv.FormatInt(s.intset[i], 10))
+	}
+	return members
+}
+
+// intset 编码下元素个数有限，一次性返回全部元素
+func (s *setEntity) Scan(cursor uint64, count int64) (uint64, []string) {
+	if !s.isIntset() {
+		return s.index.scan(cursor, count)
+	}
+
+	members := make([]string, 0, len(s.intset))
+	s.ForEach(func(value string) {
+		members = append(members, value)
+	})
+	return 0, members
+}
+
+func (s *setEntity) Encoding() string {
+	if s.isIntset() {
+		return "intset"
+	}
+	return "hashtable"
+}
+
+func (s *setEntity) setKey(key string) {
+	s.key = key
+}
+
 func (s *setEntity) ToCmd() [][]byte {
-	args := make([][]byte, 0, 2+len(s.container))
+	args := make([][]byte, 0, 2+s.Len())
 	args = append(args, []byte(database.CmdTypeSAdd), []byte(s.key))
-	for k := range s.container {
-		args = append(args, []byte(k))
-	}
+	s.ForEach(func(value string) {
+		args = append(args, []byte(value))
+	})
 
 	return args
 }
+
+func (s *setEntity) isIntset() bool {
+	return s.container == nil
+}
+
+// 二分查找 num 所在的下标，不存在时返回插入位置
+func (s *setEntity) search(num int64) (int, bool) {
+	i := sort.Search(len(s.intset), func(i int) bool {
+		return s.intset[i] >= num
+	})
+	return i, i < len(s.intset) && s.intset[i] == num
+}
+
+func (s *setEntity) toHashtable() {
+	s.container = make(map[string]struct{}, len(s.intset))
+	s.index = newScanIndex()
+	for _, num := range s.intset {
+		value := strconv.FormatInt(num, 10)
+		s.container[value] = struct{}{}
+		s.index.add(value)
+	}
+	s.intset = nil
+}
+
+// 交集，不存在的 key 视为空集. limit 大于 0 时，交集元素达到 limit 个后提前返回
+func setInter(sets []Set, limit int64) []string {
+	var smallest Set
+	for _, set := range sets {
+		if set == nil {
+			return nil
+		}
+		if smallest == nil || set.Len() < smallest.Len() {
+			smallest = set
+		}
+	}
+
+	// 遍历元素最少的 set，逐个判断是否存在于其他 set 中
+	var members []string
+	smallest.ForEach(func(value string) {
+		if limit > 0 && int64(len(members)) >= limit {
+			return
+		}
+		for _, set := range sets {
+			if set.Exist(value) == 0 {
+				return
+			}
+		}
+		members = append(members, value)
+	})
+	return members
+}
+
+func setUnion(sets []Set) []string {
+	union := make(map[string]struct{})
+	for _, set := range sets {
+		if set == nil {
+			continue
+		}
+		set.ForEach(func(value string) {
+			union[value] = struct{}{}
+		})
+	}
+
+	members := make([]string, 0, len(union))
+	for member := range union {
+		members = append(members, member)
+	}
+	return members
+}
+
+// 差集，第一个 set 中不存在于其他 set 的元素
+func setDiff(sets []Set) []string {
+	if sets[0] == nil {
+		return nil
+	}
+
+	var members []string
+	sets[0].ForEach(func(value string) {
+		for _, set := range sets[1:] {
+			if set != nil && set.Exist(value) == 1 {
+				return
+			}
+		}
+		members = append(members, value)
+	})
+	return members
+}
@@ -12,7 +12,7 @@ import (
 )
 
 func Test_set_crud(t *testing.T) {
-	set := newSetEntity("")
+	set := newSetEntity("", 0)
 	s := make(map[int]struct{}, 1000)
 	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
 
@@ -47,7 +47,7 @@ func Test_set_crud(t *testing.T) {
 }
 
 func Test_set_to_cmd(t *testing.T) {
-	set := newSetEntity("")
+	set := newSetEntity("", 0)
 	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
 	s := make(map[int]struct{}, 1000)
 	// 插入1000条数据
@@ -88,3 +88,149 @@ func Test_set_to_cmd(t *testing.T) {
 		assert.Equal(t, expect, actual)
 	})
 }
+
+func Test_set_algebra(t *testing.T) {
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	sets := make([]Set, 0, 3)
+	ss := make([]map[string]struct{}, 0, 3)
+	for i := 0; i < 3; i++ {
+		set := newSetEntity("", 0)
+		s := make(map[string]struct{})
+		for j := 0; j < 500; j++ {
+			member := cast.ToString(rander.Intn(1000))
+			set.Add(member)
+			s[member] = struct{}{}
+		}
+		sets = append(sets, set)
+		ss = append(ss, s)
+	}
+
+	var inter, union, diff []string
+	for member := range ss[0] {
+		_, ok1 := ss[1][member]
+		_, ok2 := ss[2][member]
+		if ok1 && ok2 {
+			inter = append(inter, member)
+		}
+		if !ok1 && !ok2 {
+			diff = append(diff, member)
+		}
+	}
+	all := make(map[string]struct{})
+	for _, s := range ss {
+		for member := range s {
+			all[member] = struct{}{}
+		}
+	}
+	for member := range all {
+		union = append(union, member)
+	}
+
+	t.Run("inter", func(t *testing.T) {
+		assert.ElementsMatch(t, inter, setInter(sets, 0))
+		assert.Empty(t, setInter([]Set{sets[0], nil}, 0))
+		if len(inter) > 1 {
+			assert.Equal(t, 1, len(setInter(sets, 1)))
+		}
+	})
+	t.Run("union", func(t *testing.T) {
+		assert.ElementsMatch(t, union, setUnion(append(sets, nil)))
+	})
+	t.Run("diff", func(t *testing.T) {
+		assert.ElementsMatch(t, diff, setDiff(append(sets, nil)))
+		assert.Empty(t, setDiff([]Set{nil, sets[0]}))
+	})
+}
+
+func Test_set_encoding(t *testing.T) {
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+
+	t.Run("non_integer", func(t *testing.T) {
+		set := newSetEntity("", 0)
+		members := make(map[string]struct{}, 100)
+		for i := 0; i < 100; i++ {
+			member := cast.ToString(rander.Int63() - rander.Int63())
+			set.Add(member)
+			members[member] = struct{}{}
+		}
+		assert.Equal(t, "intset", set.(encoder).Encoding())
+
+		set.Add("a")
+		members["a"] = struct{}{}
+		assert.Equal(t, "hashtable", set.(encoder).Encoding())
+		assert.Equal(t, int64(len(members)), set.Len())
+		for member := range members {
+			assert.Equal(t, int64(1), set.Exist(member))
+		}
+	})
+
+	t.Run("threshold", func(t *testing.T) {
+		set := newSetEntity("", 10)
+		for i := 0; i < 10; i++ {
+			set.Add(cast.ToString(i))
+		}
+		assert.Equal(t, "intset", set.(encoder).Encoding())
+
+		// 非规范整数形式的成员不能采用 intset 编码
+		assert.Equal(t, int64(0), set.Exist("01"))
+
+		set.Add("10")
+		assert.Equal(t, "hashtable", set.(encoder).Encoding())
+		for i := 0; i <= 10; i++ {
+			assert.Equal(t, int64(1), set.Exist(cast.ToString(i)))
+		}
+	})
+}
+
+func Test_set_algebra_store_replay(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, ":3\r\n", db.do("sadd", "s1", "a", "b", "c"))
+	assert.Equal(t, ":2\r\n", db.do("sadd", "s2", "b", "c"))
+	assert.Equal(t, "+OK\r\n", db.do("set", "inter", "x"))
+	assert.Equal(t, ":3\r\n", db.do("sadd", "diff", "x", "y", "z"))
+
+	// 重放时源 set 已经过期，结果不能依赖源 set
+	db.expireSoon(t, "s1", "s2")
+	assert.Equal(t, ":2\r\n", db.do("sinterstore", "inter", "s1", "s2"))
+	assert.Equal(t, ":3\r\n", db.do("sunionstore", "union", "s1", "s2", "none"))
+	assert.Equal(t, ":0\r\n", db.do("sdiffstore", "diff", "s2", "s1"))
+	waitExpired()
+	assert.Equal(t, ":0\r\n", db.do("exists", "s1", "s2"))
+
+	replayed := db.replay(t)
+	assert.Equal(t, ":0\r\n", replayed.do("exists", "s1", "s2"))
+	assert.Equal(t, "*3\r\n:0\r\n:1\r\n:1\r\n", replayed.do("smismember", "inter", "a", "b", "c"))
+	assert.Equal(t, ":3\r\n", replayed.do("scard", "union"))
+	assert.Equal(t, ":0\r\n", replayed.do("exists", "diff"))
+}
+
+func Test_smove_replay(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, ":2\r\n", db.do("sadd", "s1", "a", "b"))
+	db.expireSoon(t, "s1")
+	assert.Equal(t, ":1\r\n", db.do("smove", "s1", "s2", "a"))
+	assert.Equal(t, ":0\r\n", db.do("smove", "s1", "s2", "c"))
+	waitExpired()
+
+	replayed := db.replay(t)
+	assert.Equal(t, ":0\r\n", replayed.do("exists", "s1"))
+	assert.Equal(t, db.do("smembers", "s2"), replayed.do("smembers", "s2"))
+	assert.Equal(t, ":1\r\n", replayed.do("scard", "s2"))
+}
+
+func Test_set_random_huge_count(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, ":3\r\n", db.do("sadd", "s", "a", "b", "c"))
+	assert.Equal(t, ":3\r\n", db.do("sadd", "i", "1", "2", "3"))
+	assert.Equal(t, "$6\r\nintset\r\n", db.do("object", "encoding", "i"))
+
+	// 超大 count 不能导致执行协程崩溃
+	for _, key := range []string{"s", "i"} {
+		assert.Equal(t, "*3\r\n", db.do("srandmember", key, "4000000000000000000")[:4])
+		assert.Equal(t, "-ERR value is out of range\r\n", db.do("srandmember", key, "-4000000000000000000"))
+		assert.Equal(t, "*5\r\n", db.do("srandmember", key, "-5")[:4])
+	}
+
+	assert.Equal(t, "*3\r\n", db.do("spop", "s", "4000000000000000000")[:4])
+	assert.Equal(t, ":0\r\n", db.do("exists", "s"))
+}
@@ -1,9 +1,11 @@
 package datastore
 
 import (
+	"errors"
 	"math"
 	"math/rand"
 	"strconv"
+	"strings"
 
 	"github.com/AlphaMinZ/myredis_go/database"
 	"github.com/AlphaMinZ/myredis_go/handler"
@@ -25,169 +27,911 @@ func (k *KVStore) getAsSortedSet(key string) (SortedSet, error) {
 }
 
 func (k *KVStore) putAsSortedSet(key string, zset SortedSet) {
-	k.data[key] = zset
+	k.putData(key, zset)
+}
+
+// 与 redis 保持一致，zset 中 member 被移除完毕后，同时删除 key
+func (k *KVStore) delIfEmptySortedSet(key string, zset SortedSet) {
+	if zset.Len() == 0 {
+		k.del(key)
+	}
+}
+
+// 获取参与 zunion 等运算的集合，不存在的 key 对应 nil. 与 redis 保持一致，set 中的 member 视为 score 为 1
+func (k *KVStore) getAsZSources(keys [][]byte) ([]zsource, error) {
+	srcs := make([]zsource, 0, len(keys))
+	for _, key := range keys {
+		k.ExpirePreprocess(string(key))
+		switch v := k.data[string(key)].(type) {
+		case nil:
+			srcs = append(srcs, nil)
+		case SortedSet:
+			srcs = append(srcs, v)
+		case Set:
+			srcs = append(srcs, setSource{set: v})
+		default:
+			return nil, handler.NewWrongTypeErrReply()
+		}
+	}
+	return srcs, nil
 }
 
 type SortedSet interface {
-	Add(score int64, member string)
+	Add(score float64, member string) int64
 	Rem(member string) int64
-	Range(score1, score2 int64) []string
+	Range(r scoreRange, offset, count int64, rev bool) []string
+	RangeByRank(start, stop int64, rev bool) []string
+	Rank(member string) (int64, bool)
+	Count(r scoreRange) int64
+	RangeByLex(r lexRange, offset, count int64, rev bool) []string
+	LexCount(r lexRange) int64
+	RemRangeByScore(r scoreRange) int64
+	RemRangeByLex(r lexRange) int64
+	RemRangeByRank(start, stop int64) int64
+	ForEach(f func(member string, score float64))
+	RandomMembers(cnt int64) []string
+	Pop(cnt int64, max bool) []zmember
+	Score(member string) (float64, bool)
+	Len() int64
+	Scan(cursor uint64, count int64) (uint64, []string)
 	database.CmdAdapter
 }
 
+// 分值区间，minEx、maxEx 为 true 时对应开区间
+type scoreRange struct {
+	min, max     float64
+	minEx, maxEx bool
+}
+
+func (r *scoreRange) aboveMin(score float64) bool {
+	if r.minEx {
+		return score > r.min
+	}
+	return score >= r.min
+}
+
+func (r *scoreRange) belowMax(score float64) bool {
+	if r.maxEx {
+		return score < r.max
+	}
+	return score <= r.max
+}
+
+func (r *scoreRange) empty() bool {
+	return r.min > r.max || (r.min == r.max && (r.minEx || r.maxEx))
+}
+
+func (r *scoreRange) gteMin(node *skipnode) bool {
+	return r.aboveMin(node.score)
+}
+
+func (r *scoreRange) lteMax(node *skipnode) bool {
+	return r.belowMax(node.score)
+}
+
+// 字典序区间的边界. inf 为 -1、1 时分别对应 - 和 +
+type lexBound struct {
+	value     string
+	exclusive bool
+	inf       int
+}
+
+// 字典序区间，只对 score 全部相同的 zset 有意义
+type lexRange struct {
+	min, max lexBound
+}
+
+func (r *lexRange) aboveMin(member string) bool {
+	switch {
+	case r.min.inf != 0:
+		return r.min.inf < 0
+	case r.min.exclusive:
+		return member > r.min.value
+	default:
+		return member >= r.min.value
+	}
+}
+
+func (r *lexRange) belowMax(member string) bool {
+	switch {
+	case r.max.inf != 0:
+		return r.max.inf > 0
+	case r.max.exclusive:
+		return member < r.max.value
+	default:
+		return member <= r.max.value
+	}
+}
+
+func (r *lexRange) empty() bool {
+	switch {
+	case r.min.inf > 0 || r.max.inf < 0:
+		return true
+	case r.min.inf < 0 || r.max.inf > 0:
+		return false
+	default:
+		return r.min.value > r.max.value || (r.min.value == r.max.value && (r.min.exclusive || r.max.exclusive))
+	}
+}
+
+func (r *lexRange) gteMin(node *skipnode) bool {
+	return r.aboveMin(node.member)
+}
+
+func (r *lexRange) lteMax(node *skipnode) bool {
+	return r.belowMax(node.member)
+}
+
+// 跳表节点的区间判定，由 scoreRange 和 lexRange 实现
+type rangeSpec interface {
+	empty() bool
+	gteMin(node *skipnode) bool
+	lteMax(node *skipnode) bool
+}
+
+// 解析 zrangebyscore 等指令的区间参数，支持 -inf、+inf 以及 ( 前缀的开区间
+func parseScoreRange(min, max []byte) (scoreRange, error) {
+	var (
+		r   scoreRange
+		err error
+	)
+	if r.min, r.minEx, err = parseScoreBound(min); err != nil {
+		return r, err
+	}
+	if r.max, r.maxEx, err = parseScoreBound(max); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+func parseScoreBound(b []byte) (float64, bool, error) {
+	var exclusive bool
+	if len(b) > 0 && b[0] == '(' {
+		exclusive = true
+		b = b[1:]
+	}
+	score, err := strconv.ParseFloat(string(b), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false, errors.New("ERR min or max is not a float")
+	}
+	return score, exclusive, nil
+}
+
+// 解析 zrangebylex 等指令的区间参数. - 和 + 分别代表负无穷和正无穷，[ 和 ( 分别代表闭区间和开区间
+func parseLexRange(min, max []byte) (lexRange, error) {
+	var (
+		r   lexRange
+		err error
+	)
+	if r.min, err = parseLexBound(min); err != nil {
+		return r, err
+	}
+	if r.max, err = parseLexBound(max); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+func parseLexBound(b []byte) (lexBound, error) {
+	switch {
+	case len(b) == 1 && b[0] == '-':
+		return lexBound{inf: -1}, nil
+	case len(b) == 1 && b[0] == '+':
+		return lexBound{inf: 1}, nil
+	case len(b) > 0 && b[0] == '[':
+		return lexBound{value: string(b[1:])}, nil
+	case len(b) > 0 && b[0] == '(':
+		return lexBound{value: string(b[1:]), exclusive: true}, nil
+	default:
+		return lexBound{}, errors.New("ERR min or max not valid string range item")
+	}
+}
+
+func parseScore(b []byte) (float64, error) {
+	score, err := strconv.ParseFloat(string(b), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, errNotFloat
+	}
+	return score, nil
+}
+
+// 与 redis 保持一致，无穷大格式化为 inf、-inf
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	default:
+		return formatFloat(score)
+	}
+}
+
+const skiplistMaxLevel = 32
+
+// 带有跨度信息的跳表，节点按照 (score, member) 排序，支持 O(logN) 的排名查询
 type skiplist struct {
 	key           string
-	scoreToNode   map[int64]*skipnode
-	memberToScore map[string]int64
+	memberToScore map[string]float64
 	head          *skipnode
+	tail          *skipnode
+	length        int64
+	level         int
 	rander        *rand.Rand
+	index         *scanIndex
 }
 
 func newSkiplist(key string) SortedSet {
 	return &skiplist{
 		key:           key,
-		memberToScore: make(map[string]int64),
-		scoreToNode:   make(map[int64]*skipnode),
-		head:          newSkipnode(0, 0),
+		memberToScore: make(map[string]float64),
+		head:          newSkipnode(0, "", skiplistMaxLevel),
+		level:         1,
 		rander:        rand.New((rand.NewSource(lib.TimeNow().UnixNano()))),
+		index:         newScanIndex(),
 	}
 }
 
-func (s *skiplist) Add(score int64, member string) {
+// 返回 member 是否为新插入
+func (s *skiplist) Add(score float64, member string) int64 {
 	// 之前存在，需要删除
 	oldScore, ok := s.memberToScore[member]
 	if ok {
 		if oldScore == score {
-			return
+			return 0
 		}
-		s.rem(oldScore, member)
+		s.delete(oldScore, member)
+	} else {
+		s.index.add(member)
 	}
 
 	s.memberToScore[member] = score
-	node, ok := s.scoreToNode[score]
+	s.insert(score, member)
 	if ok {
-		node.members[member] = struct{}{}
-		return
+		return 0
 	}
+	return 1
+}
 
-	// 新插入，roll 出高度
-	height := s.roll()
-	for int64(len(s.head.nexts)) < height+1 {
-		s.head.nexts = append(s.head.nexts, nil)
+func (s *skiplist) Rem(member string) int64 {
+	score, ok := s.memberToScore[member]
+	if !ok {
+		return 0
 	}
+	delete(s.memberToScore, member)
+	s.delete(score, member)
+	s.index.rem(member)
+	return 1
+}
 
-	inserted := newSkipnode(score, height+1)
-	inserted.members[member] = struct{}{}
-	s.scoreToNode[score] = inserted
+func (s *skiplist) Score(member string) (float64, bool) {
+	score, ok := s.memberToScore[member]
+	return score, ok
+}
 
-	move := s.head
-	for i := height; i >= 0; i-- {
-		for move.nexts[i] != nil && move.nexts[i].score < score {
-			move = move.nexts[i]
-			continue
+func (s *skiplist) Len() int64 {
+	return s.length
+}
+
+// 按照 (score, member) 的顺序遍历
+func (s *skiplist) ForEach(f func(member string, score float64)) {
+	for node := s.head.levels[0].forward; node != nil; node = node.levels[0].forward {
+		f(node.member, node.score)
+	}
+}
+
+// 随机返回 member. cnt > 0 时返回至多 cnt 个不重复的 member，cnt < 0 时返回 |cnt| 个可能重复的 member
+func (s *skiplist) RandomMembers(cnt int64) []string {
+	return s.index.randomMembers(cnt)
+}
+
+// 弹出 score 最小或最大的至多 cnt 个 member，按照弹出的先后顺序返回
+func (s *skiplist) Pop(cnt int64, max bool) []zmember {
+	var poped []zmember
+	for ; cnt > 0 && s.length > 0; cnt-- {
+		node := s.head.levels[0].forward
+		if max {
+			node = s.tail
 		}
+		poped = append(poped, zmember{member: node.member, score: node.score})
+		s.Rem(node.member)
+	}
+	return poped
+}
+
+func (s *skiplist) Scan(cursor uint64, count int64) (uint64, []string) {
+	return s.index.scan(cursor, count)
+}
+
+// 返回分值位于区间 r 内的 member，按照 (score, member) 排序，rev 为 true 时逆序返回.
+// 结果跳过前 offset 个，count < 0 时不限制返回的个数
+func (s *skiplist) Range(r scoreRange, offset, count int64, rev bool) []string {
+	return s.rangeBySpec(&r, offset, count, rev)
+}
+
+// 返回字典序位于区间 r 内的 member，参数含义同 Range
+func (s *skiplist) RangeByLex(r lexRange, offset, count int64, rev bool) []string {
+	return s.rangeBySpec(&r, offset, count, rev)
+}
 
-		inserted.nexts[i] = move.nexts[i]
-		move.nexts[i] = inserted
+func (s *skiplist) rangeBySpec(spec rangeSpec, offset, count int64, rev bool) []string {
+	if spec.empty() || offset < 0 || count == 0 {
+		return []string{}
+	}
+
+	var (
+		node *skipnode
+		rank int64
+	)
+	if rev {
+		node, rank = s.lastInRange(spec)
+	} else {
+		node, rank = s.firstInRange(spec)
+	}
+	if node == nil {
+		return []string{}
 	}
+
+	// 借助跨度直接定位到 offset 之后的节点
+	if offset > 0 {
+		if rev {
+			rank -= offset
+		} else {
+			rank += offset
+		}
+		if node = s.byRank(rank); node == nil {
+			return []string{}
+		}
+	}
+
+	res := []string{}
+	for ; node != nil && count != 0 && spec.gteMin(node) && spec.lteMax(node); count-- {
+		res = append(res, node.member)
+		if rev {
+			node = node.backward
+		} else {
+			node = node.levels[0].forward
+		}
+	}
+	return res
 }
 
-func (s *skiplist) Rem(member string) int64 {
-	// 之前存在，需要删除
+// 返回排名位于 [start,stop] 的 member，排名从 0 开始，支持负数下标. rev 为 true 时按照逆序计算排名
+func (s *skiplist) RangeByRank(start, stop int64, rev bool) []string {
+	start, stop, ok := normalizeListRange(start, stop, s.length)
+	if !ok {
+		return []string{}
+	}
+
+	res := make([]string, 0, stop-start+1)
+	var node *skipnode
+	if rev {
+		node = s.byRank(s.length - start)
+	} else {
+		node = s.byRank(start + 1)
+	}
+	for i := start; i <= stop; i++ {
+		res = append(res, node.member)
+		if rev {
+			node = node.backward
+		} else {
+			node = node.levels[0].forward
+		}
+	}
+	return res
+}
+
+// 返回 member 的正序排名，排名从 0 开始
+func (s *skiplist) Rank(member string) (int64, bool) {
 	score, ok := s.memberToScore[member]
 	if !ok {
-		return 0
+		return 0, false
 	}
-	s.rem(score, member)
-	return 1
+
+	var rank int64
+	move := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for next := move.levels[i].forward; next != nil && !next.after(score, member); next = move.levels[i].forward {
+			rank += move.levels[i].span
+			move = next
+		}
+		if move.member == member && move != s.head {
+			break
+		}
+	}
+	return rank - 1, true
 }
 
-// [score1,score2]
-func (s *skiplist) Range(score1, score2 int64) []string {
-	if score2 == -1 {
-		score2 = math.MaxInt64
+func (s *skiplist) Count(r scoreRange) int64 {
+	return s.count(&r)
+}
+
+func (s *skiplist) LexCount(r lexRange) int64 {
+	return s.count(&r)
+}
+
+func (s *skiplist) count(spec rangeSpec) int64 {
+	if spec.empty() {
+		return 0
+	}
+	first, firstRank := s.firstInRange(spec)
+	if first == nil {
+		return 0
 	}
+	_, lastRank := s.lastInRange(spec)
+	return lastRank - firstRank + 1
+}
 
-	if score1 > score2 {
-		return []string{}
+// 移除分值位于区间 r 内的 member，返回移除的个数
+func (s *skiplist) RemRangeByScore(r scoreRange) int64 {
+	return s.deleteRange(&r)
+}
+
+// 移除字典序位于区间 r 内的 member，返回移除的个数
+func (s *skiplist) RemRangeByLex(r lexRange) int64 {
+	return s.deleteRange(&r)
+}
+
+// 移除排名位于 [start,stop] 的 member，排名从 0 开始，支持负数下标. 返回移除的个数
+func (s *skiplist) RemRangeByRank(start, stop int64) int64 {
+	start, stop, ok := normalizeListRange(start, stop, s.length)
+	if !ok {
+		return 0
 	}
 
+	var (
+		update    [skiplistMaxLevel]*skipnode
+		traversed int64
+	)
 	move := s.head
-	for i := len(s.head.nexts) - 1; i >= 0; i-- {
-		for move.nexts[i] != nil && move.nexts[i].score < score1 {
-			move = move.nexts[i]
+	for i := s.level - 1; i >= 0; i-- {
+		for move.levels[i].forward != nil && traversed+move.levels[i].span <= start {
+			traversed += move.levels[i].span
+			move = move.levels[i].forward
 		}
+		update[i] = move
 	}
 
-	// 来到了 level0 层，move.nexts[i] 如果存在，就是首个 >= score1 的元素
-	if len(move.nexts) == 0 || move.nexts[0] == nil {
-		return []string{}
+	var removed int64
+	for move = move.levels[0].forward; move != nil && removed <= stop-start; removed++ {
+		next := move.levels[0].forward
+		s.deleteNode(move, &update)
+		move = next
 	}
+	return removed
+}
 
-	res := []string{}
-	for move.nexts[0] != nil && move.nexts[0].score >= score1 && move.nexts[0].score <= score2 {
-		for member := range move.nexts[0].members {
-			res = append(res, member)
+// 一次遍历移除区间内的全部节点. 被移除节点的前驱节点保持不变，update 可以复用
+func (s *skiplist) deleteRange(spec rangeSpec) int64 {
+	if spec.empty() {
+		return 0
+	}
+
+	var update [skiplistMaxLevel]*skipnode
+	move := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for move.levels[i].forward != nil && !spec.gteMin(move.levels[i].forward) {
+			move = move.levels[i].forward
 		}
-		move = move.nexts[0]
+		update[i] = move
 	}
-	return res
+
+	var removed int64
+	for move = move.levels[0].forward; move != nil && spec.lteMax(move); removed++ {
+		next := move.levels[0].forward
+		s.deleteNode(move, &update)
+		move = next
+	}
+	return removed
 }
 
-func (s *skiplist) roll() int64 {
-	var level int64
-	for s.rander.Intn(2) > 0 {
-		level++
+// 调用方需要保证 member 此前不存在于跳表中
+func (s *skiplist) insert(score float64, member string) {
+	var (
+		update [skiplistMaxLevel]*skipnode
+		rank   [skiplistMaxLevel]int64
+	)
+
+	// 记录每一层中插入位置的前驱节点，以及前驱节点的排名
+	move := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		if i < s.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for move.levels[i].forward != nil && move.levels[i].forward.before(score, member) {
+			rank[i] += move.levels[i].span
+			move = move.levels[i].forward
+		}
+		update[i] = move
 	}
-	return level
+
+	// 新插入，roll 出高度
+	level := s.roll()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = s.head
+			update[i].levels[i].span = s.length
+		}
+		s.level = level
+	}
+
+	inserted := newSkipnode(score, member, level)
+	for i := 0; i < level; i++ {
+		inserted.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = inserted
+		inserted.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+
+	// 高于新节点的层，跨度均增加 1
+	for i := level; i < s.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != s.head {
+		inserted.backward = update[0]
+	}
+	if inserted.levels[0].forward != nil {
+		inserted.levels[0].forward.backward = inserted
+	} else {
+		s.tail = inserted
+	}
+	s.length++
 }
 
-func (s *skiplist) rem(score int64, member string) {
-	delete(s.memberToScore, member)
-	skipnode := s.scoreToNode[score]
+func (s *skiplist) delete(score float64, member string) {
+	var update [skiplistMaxLevel]*skipnode
+	move := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for move.levels[i].forward != nil && move.levels[i].forward.before(score, member) {
+			move = move.levels[i].forward
+		}
+		update[i] = move
+	}
 
-	delete(skipnode.members, member)
-	if len(skipnode.members) > 0 {
+	remed := move.levels[0].forward
+	if remed == nil || remed.score != score || remed.member != member {
 		return
 	}
+	s.unlink(remed, &update)
+}
+
+// 移除节点，同时清理 member 的索引
+func (s *skiplist) deleteNode(remed *skipnode, update *[skiplistMaxLevel]*skipnode) {
+	s.unlink(remed, update)
+	delete(s.memberToScore, remed.member)
+	s.index.rem(remed.member)
+}
+
+// 将节点从跳表中摘除，update 中记录了节点在每一层的前驱节点
+func (s *skiplist) unlink(remed *skipnode, update *[skiplistMaxLevel]*skipnode) {
+	for i := 0; i < s.level; i++ {
+		if update[i].levels[i].forward == remed {
+			update[i].levels[i].span += remed.levels[i].span - 1
+			update[i].levels[i].forward = remed.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+
+	if remed.levels[0].forward != nil {
+		remed.levels[0].forward.backward = remed.backward
+	} else {
+		s.tail = remed.backward
+	}
+
+	for s.level > 1 && s.head.levels[s.level-1].forward == nil {
+		s.level--
+	}
+	s.length--
+}
+
+// 返回排名为 rank 的节点，排名从 1 开始
+func (s *skiplist) byRank(rank int64) *skipnode {
+	if rank < 1 || rank > s.length {
+		return nil
+	}
 
-	delete(s.scoreToNode, score)
+	var traversed int64
 	move := s.head
-	for i := len(s.head.nexts) - 1; i >= 0; i-- {
-		for move.nexts[i] != nil && move.nexts[i].score < score {
-			move = move.nexts[i]
+	for i := s.level - 1; i >= 0; i-- {
+		for move.levels[i].forward != nil && traversed+move.levels[i].span <= rank {
+			traversed += move.levels[i].span
+			move = move.levels[i].forward
 		}
+		if traversed == rank {
+			return move
+		}
+	}
+	return nil
+}
 
-		if move.nexts[i] == nil || move.nexts[i].score > score {
-			continue
+// 返回区间内的首个节点及其排名，排名从 1 开始
+func (s *skiplist) firstInRange(spec rangeSpec) (*skipnode, int64) {
+	var rank int64
+	move := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for move.levels[i].forward != nil && !spec.gteMin(move.levels[i].forward) {
+			rank += move.levels[i].span
+			move = move.levels[i].forward
+		}
+	}
+
+	move = move.levels[0].forward
+	if move == nil || !spec.lteMax(move) {
+		return nil, 0
+	}
+	return move, rank + 1
+}
+
+// 返回区间内的最后一个节点及其排名，排名从 1 开始
+func (s *skiplist) lastInRange(spec rangeSpec) (*skipnode, int64) {
+	var rank int64
+	move := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for move.levels[i].forward != nil && spec.lteMax(move.levels[i].forward) {
+			rank += move.levels[i].span
+			move = move.levels[i].forward
 		}
+	}
+
+	if move == s.head || !spec.gteMin(move) {
+		return nil, 0
+	}
+	return move, rank
+}
 
-		remed := move.nexts[i]
-		move.nexts[i] = move.nexts[i].nexts[i]
-		remed.nexts[i] = nil
+func (s *skiplist) roll() int {
+	level := 1
+	for level < skiplistMaxLevel && s.rander.Intn(2) > 0 {
+		level++
 	}
+	return level
+}
+
+func (s *skiplist) Encoding() string {
+	return "skiplist"
+}
+
+func (s *skiplist) setKey(key string) {
+	s.key = key
 }
 
 func (s *skiplist) ToCmd() [][]byte {
-	args := make([][]byte, 0, 2+2*len(s.memberToScore))
+	args := make([][]byte, 0, 2+2*s.length)
 	args = append(args, []byte(database.CmdTypeZAdd), []byte(s.key))
-	for member, score := range s.memberToScore {
-		scoreStr := strconv.FormatInt(score, 10)
-		args = append(args, []byte(scoreStr), []byte(member))
+	for node := s.head.levels[0].forward; node != nil; node = node.levels[0].forward {
+		args = append(args, []byte(formatScore(node.score)), []byte(node.member))
 	}
 	return args
 }
 
+type zmember struct {
+	member string
+	score  float64
+}
+
+type skiplevel struct {
+	forward *skipnode
+	span    int64 // 到 forward 节点之间跨越的节点个数
+}
+
 type skipnode struct {
-	score   int64
-	members map[string]struct{}
-	nexts   []*skipnode
+	score    float64
+	member   string
+	backward *skipnode
+	levels   []skiplevel
 }
 
-func newSkipnode(score, height int64) *skipnode {
+func newSkipnode(score float64, member string, level int) *skipnode {
 	return &skipnode{
-		score:   score,
-		members: make(map[string]struct{}),
-		nexts:   make([]*skipnode, height),
+		score:  score,
+		member: member,
+		levels: make([]skiplevel, level),
+	}
+}
+
+// 节点是否排在 (score, member) 之前
+func (s *skipnode) before(score float64, member string) bool {
+	return s.score < score || (s.score == score && s.member < member)
+}
+
+// 节点是否排在 (score, member) 之后
+func (s *skipnode) after(score float64, member string) bool {
+	return s.score > score || (s.score == score && s.member > member)
+}
+
+// 参与 zunion、zinter、zdiff 运算的集合
+type zsource interface {
+	Len() int64
+	Score(member string) (float64, bool)
+	ForEach(f func(member string, score float64))
+}
+
+type setSource struct {
+	set Set
+}
+
+func (s setSource) Len() int64 {
+	return s.set.Len()
+}
+
+func (s setSource) Score(member string) (float64, bool) {
+	return 1, s.set.Exist(member) == 1
+}
+
+func (s setSource) ForEach(f func(member string, score float64)) {
+	s.set.ForEach(func(value string) {
+		f(value, 1)
+	})
+}
+
+// score 的聚合方式，对应 AGGREGATE SUM|MIN|MAX
+type zaggregate func(a, b float64) float64
+
+func zaggregateSum(a, b float64) float64 {
+	// 与 redis 保持一致，inf 与 -inf 相加的结果视为 0
+	if sum := a + b; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
+
+func zaggregateMin(a, b float64) float64 {
+	return math.Min(a, b)
+}
+
+func zaggregateMax(a, b float64) float64 {
+	return math.Max(a, b)
+}
+
+// score 乘以权重，结果为 NaN 时视为 0
+func zweighted(score, weight float64) float64 {
+	if score *= weight; math.IsNaN(score) {
+		return 0
+	}
+	return score
+}
+
+// 并集，不存在的 key 视为空集
+func zunion(srcs []zsource, weights []float64, aggregate zaggregate) map[string]float64 {
+	union := make(map[string]float64)
+	for i, src := range srcs {
+		if src == nil {
+			continue
+		}
+		src.ForEach(func(member string, score float64) {
+			score = zweighted(score, weights[i])
+			if old, ok := union[member]; ok {
+				score = aggregate(old, score)
+			}
+			union[member] = score
+		})
+	}
+	return union
+}
+
+// 交集，不存在的 key 视为空集
+func zinter(srcs []zsource, weights []float64, aggregate zaggregate) map[string]float64 {
+	var smallest zsource
+	for _, src := range srcs {
+		if src == nil {
+			return nil
+		}
+		if smallest == nil || src.Len() < smallest.Len() {
+			smallest = src
+		}
+	}
+
+	// 遍历元素最少的集合，按照参数顺序聚合各集合中的 score
+	inter := make(map[string]float64)
+	smallest.ForEach(func(member string, _ float64) {
+		var res float64
+		for i, src := range srcs {
+			score, ok := src.Score(member)
+			if !ok {
+				return
+			}
+			if score = zweighted(score, weights[i]); i == 0 {
+				res = score
+			} else {
+				res = aggregate(res, score)
+			}
+		}
+		inter[member] = res
+	})
+	return inter
+}
+
+// 差集，结果中保留首个集合中的 score
+func zdiff(srcs []zsource) map[string]float64 {
+	if srcs[0] == nil {
+		return nil
+	}
+
+	diff := make(map[string]float64)
+	srcs[0].ForEach(func(member string, score float64) {
+		for _, src := range srcs[1:] {
+			if src == nil {
+				continue
+			}
+			if _, ok := src.Score(member); ok {
+				return
+			}
+		}
+		diff[member] = score
+	})
+	return diff
+}
+
+// zunion、zinter、zdiff 系列指令的参数. numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+type zalgebraArgs struct {
+	keys       [][]byte
+	weights    []float64
+	aggregate  zaggregate
+	withScores bool
+}
+
+// 集合运算，返回 member -> score
+type zalgebraOp func(srcs []zsource, zargs *zalgebraArgs) map[string]float64
+
+func parseZAlgebraArgs(args [][]byte, allowWeights, allowScores bool) (*zalgebraArgs, error) {
+	if len(args) == 0 {
+		return nil, handler.NewSyntaxErrReply()
+	}
+	numKeys, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || numKeys <= 0 {
+		return nil, errors.New("ERR numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-1) {
+		return nil, errors.New("ERR Number of keys can't be greater than number of args")
+	}
+
+	zargs := zalgebraArgs{
+		keys:      args[1 : 1+numKeys],
+		weights:   make([]float64, numKeys),
+		aggregate: zaggregateSum,
+	}
+	for i := range zargs.weights {
+		zargs.weights[i] = 1
+	}
+
+	rest := args[1+numKeys:]
+	for i := 0; i < len(rest); i++ {
+		switch option := strings.ToLower(string(rest[i])); {
+		case option == "weights" && allowWeights:
+			if int64(len(rest)-i-1) < numKeys {
+				return nil, handler.NewSyntaxErrReply()
+			}
+			for j := range zargs.weights {
+				weight, err := strconv.ParseFloat(string(rest[i+1+j]), 64)
+				if err != nil || math.IsNaN(weight) {
+					return nil, errors.New("ERR weight value is not a float")
+				}
+				zargs.weights[j] = weight
+			}
+			i += int(numKeys)
+		case option == "aggregate" && allowWeights:
+			if i+1 >= len(rest) {
+				return nil, handler.NewSyntaxErrReply()
+			}
+			switch strings.ToLower(string(rest[i+1])) {
+			case "sum":
+				zargs.aggregate = zaggregateSum
+			case "min":
+				zargs.aggregate = zaggregateMin
+			case "max":
+				zargs.aggregate = zaggregateMax
+			default:
+				return nil, handler.NewSyntaxErrReply()
+			}
+			i++
+		case option == "withscores" && allowScores:
+			zargs.withScores = true
+		default:
+			return nil, handler.NewSyntaxErrReply()
+		}
 	}
+	return &zargs, nil
 }
@@ -2,6 +2,7 @@ package datastore
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"sort"
 	"strings"
@@ -17,8 +18,8 @@ func Test_skiplist_add_rem_range(t *testing.T) {
 	skiplist := newSkiplist("")
 	// 添加 1000 条指令
 	for i := 0; i < 1000; i++ {
-		skiplist.Add(int64(i), fmt.Sprintf("%d_0", i))
-		skiplist.Add(int64(i), fmt.Sprintf("%d_1", i))
+		skiplist.Add(float64(i), fmt.Sprintf("%d_0", i))
+		skiplist.Add(float64(i), fmt.Sprintf("%d_1", i))
 	}
 
 	// 随机移除 1000 个 member
@@ -34,8 +35,8 @@ func Test_skiplist_add_rem_range(t *testing.T) {
 
 	t.Run("single_score", func(t *testing.T) {
 		for i := 0; i < 100; i++ {
-			score := int64(rander.Intn(1000))
-			member := skiplist.Range(score, score)
+			score := rander.Intn(1000)
+			member := skiplist.Range(scoreRange{min: float64(score), max: float64(score)}, 0, -1, false)
 			sort.Slice(member, func(i, j int) bool {
 				return member[i] < member[j]
 			})
@@ -55,9 +56,9 @@ func Test_skiplist_add_rem_range(t *testing.T) {
 
 	t.Run("normal_score_range", func(t *testing.T) {
 		for i := 0; i < 100; i++ {
-			leftScore := int64(rander.Intn(501))
-			rightScore := leftScore + int64(rander.Intn(500))
-			member := skiplist.Range(leftScore, rightScore)
+			leftScore := rander.Intn(501)
+			rightScore := leftScore + rander.Intn(500)
+			member := skiplist.Range(scoreRange{min: float64(leftScore), max: float64(rightScore)}, 0, -1, false)
 			sort.Slice(member, func(i, j int) bool {
 				splitted1 := strings.Split(member[i], "_")
 				splitted2 := strings.Split(member[j], "_")
@@ -84,9 +85,8 @@ func Test_skiplist_add_rem_range(t *testing.T) {
 
 	t.Run("with_maximum_right_range", func(t *testing.T) {
 		for i := 0; i < 100; i++ {
-			leftScore := int64(rander.Intn(1000))
-			rightScore := int64(-1)
-			member := skiplist.Range(leftScore, rightScore)
+			leftScore := rander.Intn(1000)
+			member := skiplist.Range(scoreRange{min: float64(leftScore), max: math.Inf(1)}, 0, -1, false)
 			sort.Slice(member, func(i, j int) bool {
 				splitted1 := strings.Split(member[i], "_")
 				splitted2 := strings.Split(member[j], "_")
@@ -115,17 +115,17 @@ func Test_skiplist_add_rem_range(t *testing.T) {
 func Test_skiplist_upsert_member_with_dif_score(t *testing.T) {
 	skiplist := newSkiplist("")
 	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
-	scoreToMembers := make(map[int64][]string)
+	scoreToMembers := make(map[float64][]string)
 	memberSet := make(map[string]struct{})
 	for i := 0; i < 1000; i++ {
-		score1 := int64(rander.Intn(1000))
+		score1 := float64(rander.Intn(1000))
 		member := cast.ToString(score1)
 		if _, ok := memberSet[member]; ok {
 			continue
 		}
 		memberSet[member] = struct{}{}
 		skiplist.Add(score1, member)
-		score2 := int64(rander.Intn(1000))
+		score2 := float64(rander.Intn(1000))
 		skiplist.Add(score2, member)
 		scoreToMembers[score2] = append(scoreToMembers[score2], member)
 	}
@@ -136,7 +136,7 @@ func Test_skiplist_upsert_member_with_dif_score(t *testing.T) {
 				return cast.ToInt(members[i]) < cast.ToInt(members[j])
 			})
 
-			actualMembers := skiplist.Range(score, score)
+			actualMembers := skiplist.Range(scoreRange{min: score, max: score}, 0, -1, false)
 			sort.Slice(actualMembers, func(i, j int) bool {
 				return cast.ToInt(actualMembers[i]) < cast.ToInt(actualMembers[j])
 			})
@@ -145,13 +145,13 @@ func Test_skiplist_upsert_member_with_dif_score(t *testing.T) {
 
 			// member 对应的前一个 score 不能查询得到 member
 			for _, member := range members {
-				oldScore := cast.ToInt64(member)
+				oldScore := cast.ToFloat64(member)
 				if oldScore == score {
 					continue
 				}
-				for _, gotMember := range skiplist.Range(oldScore, oldScore) {
+				for _, gotMember := range skiplist.Range(scoreRange{min: oldScore, max: oldScore}, 0, -1, false) {
 					if gotMember == member {
-						t.Errorf("old score: %d, members: %s", oldScore, gotMember)
+						t.Errorf("old score: %v, members: %s", oldScore, gotMember)
 					}
 				}
 			}
@@ -168,7 +168,7 @@ func Test_skiplist_to_cmd(t *testing.T) {
 	for i := 0; i < 1000; i++ {
 		score := rander.Intn(1000)
 		member := rander.Intn(1000)
-		skiplist.Add(int64(score), cast.ToString(member))
+		skiplist.Add(float64(score), cast.ToString(member))
 		memberToScore[member] = score
 	}
 
@@ -219,3 +219,361 @@ func Test_skiplist_to_cmd(t *testing.T) {
 		assert.Equal(t, expect, actual)
 	})
 }
+
+func Test_skiplist_range_bound(t *testing.T) {
+	skiplist := newSkiplist("")
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	scores := make(map[string]float64, 1000)
+	for i := 0; i < 1000; i++ {
+		member := cast.ToString(i)
+		score := float64(rander.Intn(200)) / 4
+		skiplist.Add(score, member)
+		scores[member] = score
+	}
+	skiplist.Add(math.Inf(-1), "min")
+	skiplist.Add(math.Inf(1), "max")
+	scores["min"], scores["max"] = math.Inf(-1), math.Inf(1)
+
+	// 按照 score、member 排序后的全部成员
+	sorted := make([]string, 0, len(scores))
+	for member := range scores {
+		sorted = append(sorted, member)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if scores[sorted[i]] == scores[sorted[j]] {
+			return sorted[i] < sorted[j]
+		}
+		return scores[sorted[i]] < scores[sorted[j]]
+	})
+
+	expectRange := func(r scoreRange) []string {
+		res := []string{}
+		for _, member := range sorted {
+			if r.aboveMin(scores[member]) && r.belowMax(scores[member]) {
+				res = append(res, member)
+			}
+		}
+		return res
+	}
+
+	t.Run("infinity", func(t *testing.T) {
+		assert.Equal(t, sorted, skiplist.Range(scoreRange{min: math.Inf(-1), max: math.Inf(1)}, 0, -1, false))
+		assert.Equal(t, []string{"min"}, skiplist.Range(scoreRange{min: math.Inf(-1), max: math.Inf(-1)}, 0, -1, false))
+		assert.Equal(t, []string{}, skiplist.Range(scoreRange{min: math.Inf(-1), max: math.Inf(-1), minEx: true}, 0, -1, false))
+	})
+
+	t.Run("exclusive", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			r := scoreRange{
+				min:   float64(rander.Intn(200)) / 4,
+				max:   float64(rander.Intn(200)) / 4,
+				minEx: rander.Intn(2) == 0,
+				maxEx: rander.Intn(2) == 0,
+			}
+			assert.Equal(t, expectRange(r), skiplist.Range(r, 0, -1, false))
+		}
+	})
+
+	t.Run("limit_and_rev", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			r := scoreRange{min: float64(rander.Intn(100)) / 4, max: 50}
+			offset, count := int64(rander.Intn(100)), int64(rander.Intn(100))
+			expect := expectRange(r)
+			rev := make([]string, 0, len(expect))
+			for j := len(expect) - 1; j >= 0; j-- {
+				rev = append(rev, expect[j])
+			}
+
+			limit := func(members []string) []string {
+				if offset >= int64(len(members)) {
+					return []string{}
+				}
+				members = members[offset:]
+				if count < int64(len(members)) {
+					members = members[:count]
+				}
+				return members
+			}
+			assert.Equal(t, limit(expect), skiplist.Range(r, offset, count, false))
+			assert.Equal(t, limit(rev), skiplist.Range(r, offset, count, true))
+		}
+	})
+}
+
+func Test_skiplist_rank(t *testing.T) {
+	skiplist := newSkiplist("")
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	scores := make(map[string]float64, 1000)
+	// 随机插入、更新、删除
+	for i := 0; i < 3000; i++ {
+		member := cast.ToString(rander.Intn(1000))
+		if rander.Intn(4) == 0 {
+			skiplist.Rem(member)
+			delete(scores, member)
+			continue
+		}
+		score := float64(rander.Intn(100)) / 2
+		skiplist.Add(score, member)
+		scores[member] = score
+	}
+
+	sorted := make([]string, 0, len(scores))
+	for member := range scores {
+		sorted = append(sorted, member)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if scores[sorted[i]] == scores[sorted[j]] {
+			return sorted[i] < sorted[j]
+		}
+		return scores[sorted[i]] < scores[sorted[j]]
+	})
+
+	t.Run("len", func(t *testing.T) {
+		assert.Equal(t, int64(len(sorted)), skiplist.Len())
+	})
+
+	t.Run("rank", func(t *testing.T) {
+		for i, member := range sorted {
+			rank, ok := skiplist.Rank(member)
+			assert.True(t, ok)
+			assert.Equal(t, int64(i), rank)
+		}
+		_, ok := skiplist.Rank("none")
+		assert.False(t, ok)
+	})
+
+	t.Run("range_by_rank", func(t *testing.T) {
+		assert.Equal(t, sorted, skiplist.RangeByRank(0, -1, false))
+		for i := 0; i < 100; i++ {
+			start := int64(rander.Intn(len(sorted)))
+			stop := start + int64(rander.Intn(len(sorted)-int(start)))
+			assert.Equal(t, sorted[start:stop+1], skiplist.RangeByRank(start, stop, false))
+
+			rev := skiplist.RangeByRank(start, stop, true)
+			assert.Equal(t, int(stop-start+1), len(rev))
+			for j, member := range rev {
+				assert.Equal(t, sorted[len(sorted)-1-int(start)-j], member)
+			}
+		}
+	})
+
+	t.Run("count", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			r := scoreRange{
+				min:   float64(rander.Intn(100)) / 2,
+				max:   float64(rander.Intn(100)) / 2,
+				minEx: rander.Intn(2) == 0,
+				maxEx: rander.Intn(2) == 0,
+			}
+			var expect int64
+			for _, member := range sorted {
+				if r.aboveMin(scores[member]) && r.belowMax(scores[member]) {
+					expect++
+				}
+			}
+			assert.Equal(t, expect, skiplist.Count(r))
+		}
+	})
+}
+
+func Test_skiplist_lex(t *testing.T) {
+	skiplist := newSkiplist("")
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	members := make(map[string]struct{}, 500)
+	for i := 0; i < 500; i++ {
+		member := cast.ToString(rander.Intn(10000))
+		skiplist.Add(0, member)
+		members[member] = struct{}{}
+	}
+	sorted := make([]string, 0, len(members))
+	for member := range members {
+		sorted = append(sorted, member)
+	}
+	sort.Strings(sorted)
+
+	randBound := func() lexBound {
+		switch rander.Intn(10) {
+		case 0:
+			return lexBound{inf: -1}
+		case 1:
+			return lexBound{inf: 1}
+		default:
+			return lexBound{value: cast.ToString(rander.Intn(10000)), exclusive: rander.Intn(2) == 0}
+		}
+	}
+	expectRange := func(r lexRange) []string {
+		res := []string{}
+		for _, member := range sorted {
+			if r.aboveMin(member) && r.belowMax(member) {
+				res = append(res, member)
+			}
+		}
+		return res
+	}
+
+	t.Run("range_and_count", func(t *testing.T) {
+		assert.Equal(t, sorted, skiplist.RangeByLex(lexRange{min: lexBound{inf: -1}, max: lexBound{inf: 1}}, 0, -1, false))
+		for i := 0; i < 100; i++ {
+			r := lexRange{min: randBound(), max: randBound()}
+			expect := expectRange(r)
+			assert.Equal(t, expect, skiplist.RangeByLex(r, 0, -1, false))
+			assert.Equal(t, int64(len(expect)), skiplist.LexCount(r))
+		}
+	})
+
+	t.Run("rem_range", func(t *testing.T) {
+		r := lexRange{min: randBound(), max: randBound()}
+		expect := expectRange(r)
+		assert.Equal(t, int64(len(expect)), skiplist.RemRangeByLex(r))
+		assert.Equal(t, int64(len(sorted)-len(expect)), skiplist.Len())
+		for _, member := range expect {
+			_, ok := skiplist.Score(member)
+			assert.False(t, ok)
+		}
+		assert.Equal(t, []string{}, skiplist.RangeByLex(r, 0, -1, false))
+	})
+}
+
+func Test_skiplist_rem_range(t *testing.T) {
+	skiplist := newSkiplist("")
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	for i := 0; i < 1000; i++ {
+		skiplist.Add(float64(i), cast.ToString(i))
+	}
+
+	t.Run("by_score", func(t *testing.T) {
+		assert.Equal(t, int64(100), skiplist.RemRangeByScore(scoreRange{min: 100, max: 200, maxEx: true}))
+		assert.Equal(t, int64(0), skiplist.Count(scoreRange{min: 100, max: 200, maxEx: true}))
+		assert.Equal(t, int64(900), skiplist.Len())
+	})
+
+	t.Run("by_rank", func(t *testing.T) {
+		start := int64(rander.Intn(800))
+		stop := start + int64(rander.Intn(100))
+		expect := append(skiplist.RangeByRank(0, start-1, false), skiplist.RangeByRank(stop+1, -1, false)...)
+		assert.Equal(t, stop-start+1, skiplist.RemRangeByRank(start, stop))
+		assert.Equal(t, expect, skiplist.RangeByRank(0, -1, false))
+		for i, member := range expect {
+			rank, _ := skiplist.Rank(member)
+			assert.Equal(t, int64(i), rank)
+		}
+		assert.Equal(t, int64(1), skiplist.RemRangeByRank(-1, -1))
+		assert.Equal(t, int64(0), skiplist.RemRangeByRank(5, 1))
+	})
+}
+
+func Test_sorted_set_algebra(t *testing.T) {
+	zset1, zset2 := newSkiplist(""), newSkiplist("")
+	zset1.Add(1, "a")
+	zset1.Add(2, "b")
+	zset1.Add(math.Inf(1), "c")
+	zset2.Add(10, "b")
+	zset2.Add(math.Inf(-1), "c")
+	zset2.Add(20, "d")
+	set := newSetEntity("", 0)
+	set.Add("a")
+	set.Add("d")
+	srcs := []zsource{zset1, zset2, setSource{set: set}}
+
+	t.Run("union", func(t *testing.T) {
+		assert.Equal(t, map[string]float64{"a": 2, "b": 12, "c": 0, "d": 21}, zunion(srcs, []float64{1, 1, 1}, zaggregateSum))
+		assert.Equal(t, map[string]float64{"a": 1, "b": 2, "c": math.Inf(-1), "d": 1}, zunion(srcs, []float64{1, 1, 1}, zaggregateMin))
+		assert.Equal(t, map[string]float64{"a": 2, "b": 10, "c": math.Inf(1), "d": 20}, zunion(srcs[:2], []float64{2, 1}, zaggregateMax))
+		assert.Equal(t, map[string]float64{"a": 1, "d": 1}, zunion([]zsource{nil, setSource{set: set}}, []float64{1, 1}, zaggregateSum))
+	})
+
+	t.Run("inter", func(t *testing.T) {
+		assert.Equal(t, map[string]float64{"b": 32, "c": 0}, zinter(srcs[:2], []float64{1, 3}, zaggregateSum))
+		assert.Equal(t, map[string]float64{"b": 10, "c": math.Inf(1)}, zinter(srcs[:2], []float64{1, 1}, zaggregateMax))
+		assert.Equal(t, map[string]float64{}, zinter(srcs, []float64{1, 1, 1}, zaggregateSum))
+		assert.Nil(t, zinter([]zsource{zset1, nil}, []float64{1, 1}, zaggregateSum))
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		assert.Equal(t, map[string]float64{"a": 1}, zdiff(srcs[:2]))
+		assert.Equal(t, map[string]float64{}, zdiff(srcs))
+		assert.Equal(t, map[string]float64{"a": 1, "b": 2, "c": math.Inf(1)}, zdiff([]zsource{zset1, nil}))
+	})
+}
+
+func Test_skiplist_pop(t *testing.T) {
+	skiplist := newSkiplist("")
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	for i := 0; i < 1000; i++ {
+		skiplist.Add(float64(rander.Intn(100)), cast.ToString(i))
+	}
+	sorted := skiplist.RangeByRank(0, -1, false)
+
+	t.Run("random", func(t *testing.T) {
+		members := skiplist.RandomMembers(100)
+		unique := make(map[string]struct{}, len(members))
+		for _, member := range members {
+			_, ok := skiplist.Score(member)
+			assert.True(t, ok)
+			unique[member] = struct{}{}
+		}
+		assert.Equal(t, 100, len(unique))
+		assert.Equal(t, 2000, len(skiplist.RandomMembers(-2000)))
+	})
+
+	t.Run("min", func(t *testing.T) {
+		poped := skiplist.Pop(10, false)
+		for i, zm := range poped {
+			assert.Equal(t, sorted[i], zm.member)
+		}
+		sorted = sorted[10:]
+	})
+
+	t.Run("max", func(t *testing.T) {
+		poped := skiplist.Pop(10, true)
+		for i, zm := range poped {
+			assert.Equal(t, sorted[len(sorted)-1-i], zm.member)
+			_, ok := skiplist.Score(zm.member)
+			assert.False(t, ok)
+		}
+		sorted = sorted[:len(sorted)-10]
+	})
+
+	t.Run("all", func(t *testing.T) {
+		assert.Equal(t, sorted, skiplist.RangeByRank(0, -1, false))
+		assert.Equal(t, len(sorted), len(skiplist.Pop(2000, false)))
+		assert.Equal(t, int64(0), skiplist.Len())
+		assert.Nil(t, skiplist.Pop(1, true))
+	})
+}
+
+func Test_sorted_set_algebra_store_replay(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, ":3\r\n", db.do("zadd", "z1", "1", "a", "2", "b", "3", "c"))
+	assert.Equal(t, ":2\r\n", db.do("zadd", "z2", "0.1", "b", "0.2", "c"))
+	assert.Equal(t, "+OK\r\n", db.do("set", "inter", "x"))
+	assert.Equal(t, ":1\r\n", db.do("zadd", "diff", "1", "x"))
+
+	// 重放时源 zset 已经过期，结果不能依赖源 zset
+	db.expireSoon(t, "z1", "z2")
+	assert.Equal(t, ":2\r\n", db.do("zinterstore", "inter", "2", "z1", "z2", "WEIGHTS", "1", "10", "AGGREGATE", "MAX"))
+	assert.Equal(t, ":3\r\n", db.do("zunionstore", "union", "2", "z1", "z2"))
+	assert.Equal(t, ":0\r\n", db.do("zdiffstore", "diff", "2", "z2", "z1"))
+	waitExpired()
+	assert.Equal(t, ":0\r\n", db.do("exists", "z1", "z2"))
+
+	replayed := db.replay(t)
+	assert.Equal(t, ":0\r\n", replayed.do("exists", "z1", "z2"))
+	for _, key := range []string{"inter", "union"} {
+		assert.Equal(t, db.do("zrange", key, "0", "-1", "WITHSCORES"), replayed.do("zrange", key, "0", "-1", "WITHSCORES"))
+	}
+	assert.Equal(t, "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n", replayed.do("zrange", "inter", "0", "-1", "WITHSCORES"))
+	assert.Equal(t, ":3\r\n", replayed.do("zcard", "union"))
+	assert.Equal(t, ":0\r\n", replayed.do("exists", "diff"))
+}
+
+func Test_zrandmember_huge_count(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, ":2\r\n", db.do("zadd", "z", "1", "a", "2", "b"))
+
+	// 超大 count 不能导致执行协程崩溃
+	assert.Equal(t, "*2\r\n", db.do("zrandmember", "z", "4000000000000000000")[:4])
+	assert.Equal(t, "*4\r\n", db.do("zrandmember", "z", "4000000000000000000", "withscores")[:4])
+	assert.Equal(t, "-ERR value is out of range\r\n", db.do("zrandmember", "z", "-4000000000000000000"))
+	assert.Equal(t, ":2\r\n", db.do("zcard", "z"))
+}
@@ -0,0 +1,462 @@
+package datastore
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/AlphaMinZ/myredis_go/handler"
+)
+
+var (
+	errInvalidStreamID  = errors.New("ERR Invalid stream ID specified as stream command argument")
+	errStreamIDTooSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	errStreamIDZero     = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+)
+
+func (k *KVStore) getAsStream(key string) (Stream, error) {
+	v, ok := k.data[key]
+	if !ok {
+		return nil, nil
+	}
+
+	stream, ok := v.(Stream)
+	if !ok {
+		return nil, handler.NewWrongTypeErrReply()
+	}
+
+	return stream, nil
+}
+
+func (k *KVStore) putAsStream(key string, stream Stream) {
+	k.putData(key, stream)
+}
+
+// stream 中 entry 的 id，由毫秒时间戳和序列号组成
+type streamID struct {
+	ms, seq uint64
+}
+
+var maxStreamID = streamID{ms: math.MaxUint64, seq: math.MaxUint64}
+
+func (id streamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+// 返回后继 id，溢出时 ok 为 false
+func (id streamID) incr() (streamID, bool) {
+	switch {
+	case id.seq < math.MaxUint64:
+		return streamID{ms: id.ms, seq: id.seq + 1}, true
+	case id.ms < math.MaxUint64:
+		return streamID{ms: id.ms + 1}, true
+	default:
+		return id, false
+	}
+}
+
+// 返回前驱 id，溢出时 ok 为 false
+func (id streamID) decr() (streamID, bool) {
+	switch {
+	case id.seq > 0:
+		return streamID{ms: id.ms, seq: id.seq - 1}, true
+	case id.ms > 0:
+		return streamID{ms: id.ms - 1, seq: math.MaxUint64}, true
+	default:
+		return id, false
+	}
+}
+
+// 解析 ms-seq 格式的 id，只给出 ms 时 seq 取 defaultSeq
+func parseStreamID(b []byte, defaultSeq uint64) (streamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(string(b), "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return streamID{}, errInvalidStreamID
+	}
+	if !hasSeq {
+		return streamID{ms: ms, seq: defaultSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return streamID{}, errInvalidStreamID
+	}
+	return streamID{ms: ms, seq: seq}, nil
+}
+
+// 解析 xrange 的区间边界. - 和 + 分别代表最小和最大的 id，( 前缀代表开区间
+func parseStreamBound(b []byte, start bool) (streamID, error) {
+	switch string(b) {
+	case "-":
+		return streamID{}, nil
+	case "+":
+		return maxStreamID, nil
+	}
+
+	var exclusive bool
+	if len(b) > 0 && b[0] == '(' {
+		exclusive = true
+		b = b[1:]
+	}
+
+	var defaultSeq uint64
+	if !start {
+		defaultSeq = math.MaxUint64
+	}
+	id, err := parseStreamID(b, defaultSeq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+
+	var ok bool
+	if start {
+		if id, ok = id.incr(); !ok {
+			return id, errors.New("ERR invalid start ID for the interval")
+		}
+	} else if id, ok = id.decr(); !ok {
+		return id, errors.New("ERR invalid end ID for the interval")
+	}
+	return id, nil
+}
+
+// 生成 xadd 新增 entry 的 id. 支持 *、ms-*、ms-seq 三种格式，新 id 需要大于 last
+func parseXAddID(b []byte, last streamID, nowMs uint64) (streamID, error) {
+	if string(b) == "*" {
+		if nowMs > last.ms {
+			return streamID{ms: nowMs}, nil
+		}
+		id, ok := last.incr()
+		if !ok {
+			return id, errStreamIDTooSmall
+		}
+		return id, nil
+	}
+
+	if msPart, ok := strings.CutSuffix(string(b), "-*"); ok {
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		if err != nil {
+			return streamID{}, errInvalidStreamID
+		}
+		switch {
+		case ms > last.ms:
+			return streamID{ms: ms}, nil
+		case ms < last.ms || last.seq == math.MaxUint64:
+			return streamID{}, errStreamIDTooSmall
+		default:
+			return streamID{ms: ms, seq: last.seq + 1}, nil
+		}
+	}
+
+	id, err := parseStreamID(b, 0)
+	if err != nil {
+		return id, err
+	}
+	if id == (streamID{}) {
+		return id, errStreamIDZero
+	}
+	if !last.less(id) {
+		return id, errStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// maxlen、minid 裁剪策略. MAXLEN|MINID [=|~] threshold [LIMIT count]
+type streamTrim struct {
+	byMinID bool
+	maxLen  int64
+	minID   streamID
+	limit   int64 // 单次裁剪的最大条数，为 0 时不限制
+}
+
+// 从 args[i] 开始解析裁剪策略，返回下一个待解析参数的位置
+func parseStreamTrim(args [][]byte, i int) (*streamTrim, int, error) {
+	trim := streamTrim{byMinID: strings.EqualFold(string(args[i]), "minid")}
+	i++
+
+	// 近似裁剪 ~ 按照精确裁剪处理
+	var approx bool
+	if i < len(args) && (string(args[i]) == "=" || string(args[i]) == "~") {
+		approx = string(args[i]) == "~"
+		i++
+	}
+	if i >= len(args) {
+		return nil, 0, handler.NewSyntaxErrReply()
+	}
+
+	if trim.byMinID {
+		minID, err := parseStreamID(args[i], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		trim.minID = minID
+	} else {
+		maxLen, err := strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil {
+			return nil, 0, errNotInteger
+		}
+		if maxLen < 0 {
+			return nil, 0, errors.New("ERR The MAXLEN argument must be >= 0.")
+		}
+		trim.maxLen = maxLen
+	}
+	i++
+
+	if i < len(args) && strings.EqualFold(string(args[i]), "limit") {
+		if i+1 >= len(args) {
+			return nil, 0, handler.NewSyntaxErrReply()
+		}
+		if !approx {
+			return nil, 0, errors.New("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		limit, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil || limit < 0 {
+			return nil, 0, errors.New("ERR The LIMIT argument must be >= 0.")
+		}
+		trim.limit = limit
+		i += 2
+	}
+	return &trim, i, nil
+}
+
+func (t *streamTrim) apply(stream Stream) int64 {
+	if t.byMinID {
+		return stream.TrimMinID(t.minID, t.limit)
+	}
+	return stream.TrimMaxLen(t.maxLen, t.limit)
+}
+
+type streamEntry struct {
+	id     streamID
+	fields [][]byte // field、value 交替排列
+}
+
+type Stream interface {
+	Add(id streamID, fields [][]byte)
+	LastID() streamID
+	SetLastID(id streamID)
+	Len() int64
+	Range(start, end streamID, count int64, rev bool) []*streamEntry
+	Del(id streamID) int64
+	TrimMaxLen(maxLen, limit int64) int64
+	TrimMinID(minID streamID, limit int64) int64
+	Get(id streamID) *streamEntry
+	Group(name string) *streamGroup
+	CreateGroup(name string, lastDeliveredID streamID) bool
+	DestroyGroup(name string) bool
+	Groups() []*streamGroup
+	database.MultiCmdAdapter
+}
+
+// entry 按照 id 升序存放在切片中，借助二分查找定位
+type streamEntity struct {
+	key     string
+	entries []*streamEntry
+	lastID  streamID // 曾经写入过的最大 id，entry 被删除后依然保留
+	groups  map[string]*streamGroup
+}
+
+func newStreamEntity(key string) Stream {
+	return &streamEntity{
+		key: key,
+	}
+}
+
+// 调用方需要保证 id 大于 LastID
+func (s *streamEntity) Add(id streamID, fields [][]byte) {
+	s.entries = append(s.entries, &streamEntry{id: id, fields: fields})
+	s.lastID = id
+}
+
+func (s *streamEntity) LastID() streamID {
+	return s.lastID
+}
+
+func (s *streamEntity) SetLastID(id streamID) {
+	s.lastID = id
+}
+
+func (s *streamEntity) Len() int64 {
+	return int64(len(s.entries))
+}
+
+// 返回 id 位于 [start,end] 的 entry，rev 为 true 时逆序返回. count < 0 时不限制返回的个数
+func (s *streamEntity) Range(start, end streamID, count int64, rev bool) []*streamEntry {
+	if end.less(start) || count == 0 {
+		return nil
+	}
+
+	left, right := s.search(start), s.search(end)
+	if right < len(s.entries) && s.entries[right].id == end {
+		right++
+	}
+	if left >= right {
+		return nil
+	}
+
+	n := int64(right - left)
+	if count > 0 && count < n {
+		n = count
+	}
+	res := make([]*streamEntry, 0, n)
+	for i := int64(0); i < n; i++ {
+		if rev {
+			res = append(res, s.entries[right-1-int(i)])
+		} else {
+			res = append(res, s.entries[left+int(i)])
+		}
+	}
+	return res
+}
+
+func (s *streamEntity) Del(id streamID) int64 {
+	i := s.search(id)
+	if i >= len(s.entries) || s.entries[i].id != id {
+		return 0
+	}
+	copy(s.entries[i:], s.entries[i+1:])
+	s.entries[len(s.entries)-1] = nil
+	s.entries = s.entries[:len(s.entries)-1]
+	return 1
+}
+
+// 移除最早写入的 entry，直到长度不超过 maxLen
+func (s *streamEntity) TrimMaxLen(maxLen, limit int64) int64 {
+	return s.trimFront(int64(len(s.entries))-maxLen, limit)
+}
+
+// 移除 id 小于 minID 的 entry
+func (s *streamEntity) TrimMinID(minID streamID, limit int64) int64 {
+	return s.trimFront(int64(s.search(minID)), limit)
+}
+
+func (s *streamEntity) trimFront(n, limit int64) int64 {
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	if n <= 0 {
+		return 0
+	}
+
+	// 拷贝到新的切片中，释放底层数组中被裁剪的部分
+	entries := make([]*streamEntry, int64(len(s.entries))-n)
+	copy(entries, s.entries[n:])
+	s.entries = entries
+	return n
+}
+
+func (s *streamEntity) Get(id streamID) *streamEntry {
+	if i := s.search(id); i < len(s.entries) && s.entries[i].id == id {
+		return s.entries[i]
+	}
+	return nil
+}
+
+func (s *streamEntity) Group(name string) *streamGroup {
+	return s.groups[name]
+}
+
+func (s *streamEntity) CreateGroup(name string, lastDeliveredID streamID) bool {
+	if _, ok := s.groups[name]; ok {
+		return false
+	}
+	if s.groups == nil {
+		s.groups = make(map[string]*streamGroup)
+	}
+	s.groups[name] = newStreamGroup(name, lastDeliveredID)
+	return true
+}
+
+func (s *streamEntity) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// 按照名称升序返回全部消费者组
+func (s *streamEntity) Groups() []*streamGroup {
+	groups := make([]*streamGroup, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].name < groups[j].name
+	})
+	return groups
+}
+
+// 返回首个 id 不小于 id 的 entry 下标
+func (s *streamEntity) search(id streamID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return !s.entries[i].id.less(id)
+	})
+}
+
+func (s *streamEntity) Encoding() string {
+	return "stream"
+}
+
+func (s *streamEntity) setKey(key string) {
+	s.key = key
+}
+
+// 以显式 id 的 xadd 指令还原 entry. 空 stream 借助 maxlen 0 创建，同时还原 last id
+func (s *streamEntity) ToCmd() [][]byte {
+	if len(s.entries) == 0 {
+		// xadd 不接受 0-0，由 ExtraCmds 通过 xsetid 回退
+		lastID := s.lastID
+		if lastID == (streamID{}) {
+			lastID.seq = 1
+		}
+		return [][]byte{[]byte(database.CmdTypeXAdd), []byte(s.key), []byte("maxlen"), []byte("0"),
+			[]byte(lastID.String()), []byte(""), []byte("")}
+	}
+	return s.xaddCmd(s.entries[0])
+}
+
+func (s *streamEntity) ExtraCmds() [][][]byte {
+	var cmds [][][]byte
+	if len(s.entries) > 0 {
+		for _, entry := range s.entries[1:] {
+			cmds = append(cmds, s.xaddCmd(entry))
+		}
+	}
+	// 末尾的 entry 被删除过时，需要还原 last id
+	if len(s.entries) == 0 && s.lastID == (streamID{}) || len(s.entries) > 0 && s.entries[len(s.entries)-1].id != s.lastID {
+		cmds = append(cmds, [][]byte{[]byte(database.CmdTypeXSetID), []byte(s.key), []byte(s.lastID.String())})
+	}
+	for _, group := range s.Groups() {
+		cmds = append(cmds, group.toCmds(s.key)...)
+	}
+	return cmds
+}
+
+func (s *streamEntity) xaddCmd(entry *streamEntry) [][]byte {
+	args := make([][]byte, 0, 3+len(entry.fields))
+	args = append(args, []byte(database.CmdTypeXAdd), []byte(s.key), []byte(entry.id.String()))
+	return append(args, entry.fields...)
+}
+
+// 【id】+【field、value 数组】
+func streamEntryReply(entry *streamEntry) handler.Reply {
+	return handler.NewMultiRawReply([]handler.Reply{
+		handler.NewBulkReply([]byte(entry.id.String())),
+		handler.NewMultiBulkReply(entry.fields),
+	})
+}
+
+func streamEntriesReply(entries []*streamEntry) handler.Reply {
+	replies := make([]handler.Reply, 0, len(entries))
+	for _, entry := range entries {
+		replies = append(replies, streamEntryReply(entry))
+	}
+	return handler.NewMultiRawReply(replies)
+}
@@ -0,0 +1,217 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+)
+
+var errBusyGroup = errors.New("BUSYGROUP Consumer Group name already exists")
+
+func errNoGroup(key, group string) error {
+	return errors.New("NOGROUP No such key '" + key + "' or consumer group '" + group + "'")
+}
+
+func (k *KVStore) getStreamGroup(key, name string) (Stream, *streamGroup, error) {
+	stream, err := k.getAsStream(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if stream == nil || stream.Group(name) == nil {
+		return nil, nil, errNoGroup(key, name)
+	}
+	return stream, stream.Group(name), nil
+}
+
+// 认领的 pending entry 以 xclaim 持久化，已被删除的 entry 以 xack 从 pel 中移除
+func (k *KVStore) persistClaims(ctx context.Context, key, group string, claimed []*pendingEntry, deleted [][]byte) {
+	for _, pe := range claimed {
+		k.persister.PersistCmd(ctx, xclaimCmd(key, group, pe, nil)) // 持久化
+	}
+	if len(deleted) > 0 {
+		cmd := [][]byte{[]byte(database.CmdTypeXAck), []byte(key), []byte(group)}
+		k.persister.PersistCmd(ctx, append(cmd, deleted...)) // 持久化
+	}
+}
+
+// 已投递但尚未被 ack 的 entry
+type pendingEntry struct {
+	id            streamID
+	consumer      string
+	deliveryTime  time.Time
+	deliveryCount int64
+}
+
+type streamConsumer struct {
+	name     string
+	seenTime time.Time // 最近一次读取或认领的时间
+	pending  int64     // 名下 pending entry 的个数
+}
+
+// 消费者组. pel 中的 pending entry 按照 id 升序排列
+type streamGroup struct {
+	name            string
+	lastDeliveredID streamID
+	pel             []*pendingEntry
+	consumers       map[string]*streamConsumer
+}
+
+func newStreamGroup(name string, lastDeliveredID streamID) *streamGroup {
+	return &streamGroup{
+		name:            name,
+		lastDeliveredID: lastDeliveredID,
+		consumers:       make(map[string]*streamConsumer),
+	}
+}
+
+// 获取消费者，不存在时创建. created 代表是否为新建
+func (g *streamGroup) consumer(name string, now time.Time) (c *streamConsumer, created bool) {
+	if c, ok := g.consumers[name]; ok {
+		c.seenTime = now
+		return c, false
+	}
+	c = &streamConsumer{name: name, seenTime: now}
+	g.consumers[name] = c
+	return c, true
+}
+
+// 删除消费者以及名下的 pending entry，返回删除的 pending entry 个数
+func (g *streamGroup) delConsumer(name string) int64 {
+	c, ok := g.consumers[name]
+	if !ok {
+		return 0
+	}
+	delete(g.consumers, name)
+
+	pel := g.pel[:0]
+	for _, pe := range g.pel {
+		if pe.consumer != name {
+			pel = append(pel, pe)
+		}
+	}
+	for i := len(pel); i < len(g.pel); i++ {
+		g.pel[i] = nil
+	}
+	g.pel = pel
+	return c.pending
+}
+
+func (g *streamGroup) pending(id streamID) *pendingEntry {
+	if i := g.search(id); i < len(g.pel) && g.pel[i].id == id {
+		return g.pel[i]
+	}
+	return nil
+}
+
+// 将 entry 投递给消费者. entry 已经处于 pending 状态时转移归属
+func (g *streamGroup) deliver(id streamID, c *streamConsumer, now time.Time) *pendingEntry {
+	i := g.search(id)
+	if i < len(g.pel) && g.pel[i].id == id {
+		pe := g.pel[i]
+		g.assign(pe, c)
+		pe.deliveryTime = now
+		pe.deliveryCount++
+		return pe
+	}
+
+	pe := &pendingEntry{id: id, consumer: c.name, deliveryTime: now, deliveryCount: 1}
+	c.pending++
+	g.pel = append(g.pel, nil)
+	copy(g.pel[i+1:], g.pel[i:])
+	g.pel[i] = pe
+	return pe
+}
+
+func (g *streamGroup) assign(pe *pendingEntry, c *streamConsumer) {
+	if pe.consumer == c.name {
+		return
+	}
+	if old, ok := g.consumers[pe.consumer]; ok {
+		old.pending--
+	}
+	pe.consumer = c.name
+	c.pending++
+}
+
+func (g *streamGroup) ack(id streamID) int64 {
+	i := g.search(id)
+	if i >= len(g.pel) || g.pel[i].id != id {
+		return 0
+	}
+	if c, ok := g.consumers[g.pel[i].consumer]; ok {
+		c.pending--
+	}
+	copy(g.pel[i:], g.pel[i+1:])
+	g.pel[len(g.pel)-1] = nil
+	g.pel = g.pel[:len(g.pel)-1]
+	return 1
+}
+
+// 返回 id 位于 [start,end] 的 pending entry. consumer 非空时只返回该消费者名下的，count < 0 时不限制个数
+func (g *streamGroup) pendingRange(start, end streamID, count int64, consumer string, minIdle time.Duration, now time.Time) []*pendingEntry {
+	var res []*pendingEntry
+	for i := g.search(start); i < len(g.pel) && !end.less(g.pel[i].id) && count != int64(len(res)); i++ {
+		pe := g.pel[i]
+		if consumer != "" && pe.consumer != consumer {
+			continue
+		}
+		if now.Sub(pe.deliveryTime) < minIdle {
+			continue
+		}
+		res = append(res, pe)
+	}
+	return res
+}
+
+// 按照名称升序返回全部消费者
+func (g *streamGroup) sortedConsumers() []*streamConsumer {
+	consumers := make([]*streamConsumer, 0, len(g.consumers))
+	for _, c := range g.consumers {
+		consumers = append(consumers, c)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].name < consumers[j].name
+	})
+	return consumers
+}
+
+func (g *streamGroup) search(id streamID) int {
+	return sort.Search(len(g.pel), func(i int) bool {
+		return !g.pel[i].id.less(id)
+	})
+}
+
+// 以 xgroup create、xgroup createconsumer 以及 xclaim 的形式还原消费者组
+func (g *streamGroup) toCmds(key string) [][][]byte {
+	cmds := make([][][]byte, 0, 1+len(g.consumers)+len(g.pel))
+	cmds = append(cmds, [][]byte{[]byte(database.CmdTypeXGroup), []byte("create"), []byte(key), []byte(g.name),
+		[]byte(g.lastDeliveredID.String())})
+
+	for _, c := range g.sortedConsumers() {
+		cmds = append(cmds, [][]byte{[]byte(database.CmdTypeXGroup), []byte("createconsumer"), []byte(key), []byte(g.name),
+			[]byte(c.name)})
+	}
+
+	for _, pe := range g.pel {
+		cmds = append(cmds, xclaimCmd(key, g.name, pe, nil))
+	}
+	return cmds
+}
+
+// 还原 pending entry 状态的 xclaim 指令. lastID 非空时同时更新 last delivered id
+func xclaimCmd(key, group string, pe *pendingEntry, lastID *streamID) [][]byte {
+	cmd := [][]byte{[]byte(database.CmdTypeXClaim), []byte(key), []byte(group), []byte(pe.consumer), []byte("0"),
+		[]byte(pe.id.String()),
+		[]byte("time"), []byte(strconv.FormatInt(pe.deliveryTime.UnixMilli(), 10)),
+		[]byte("retrycount"), []byte(strconv.FormatInt(pe.deliveryCount, 10)),
+		[]byte("force"), []byte("justid")}
+	if lastID != nil {
+		cmd = append(cmd, []byte("lastid"), []byte(lastID.String()))
+	}
+	return cmd
+}
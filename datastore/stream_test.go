@@ -0,0 +1,200 @@
+package datastore
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/AlphaMinZ/myredis_go/lib"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_stream_id(t *testing.T) {
+	t.Run("parse", func(t *testing.T) {
+		id, err := parseStreamID([]byte("5-3"), 0)
+		assert.Nil(t, err)
+		assert.Equal(t, streamID{ms: 5, seq: 3}, id)
+
+		id, err = parseStreamID([]byte("5"), math.MaxUint64)
+		assert.Nil(t, err)
+		assert.Equal(t, streamID{ms: 5, seq: math.MaxUint64}, id)
+
+		_, err = parseStreamID([]byte("5-a"), 0)
+		assert.Equal(t, errInvalidStreamID, err)
+	})
+
+	t.Run("bound", func(t *testing.T) {
+		id, _ := parseStreamBound([]byte("(5-3"), true)
+		assert.Equal(t, streamID{ms: 5, seq: 4}, id)
+		id, _ = parseStreamBound([]byte("(5-0"), false)
+		assert.Equal(t, streamID{ms: 4, seq: math.MaxUint64}, id)
+		id, _ = parseStreamBound([]byte("+"), false)
+		assert.Equal(t, maxStreamID, id)
+		_, err := parseStreamBound([]byte("(0-0"), false)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("xadd", func(t *testing.T) {
+		last := streamID{ms: 10, seq: 2}
+		id, _ := parseXAddID([]byte("*"), last, 20)
+		assert.Equal(t, streamID{ms: 20}, id)
+		// 时钟回拨时沿用 last 的毫秒时间戳
+		id, _ = parseXAddID([]byte("*"), last, 5)
+		assert.Equal(t, streamID{ms: 10, seq: 3}, id)
+		id, _ = parseXAddID([]byte("10-*"), last, 0)
+		assert.Equal(t, streamID{ms: 10, seq: 3}, id)
+		_, err := parseXAddID([]byte("9-*"), last, 0)
+		assert.Equal(t, errStreamIDTooSmall, err)
+		_, err = parseXAddID([]byte("10-2"), last, 0)
+		assert.Equal(t, errStreamIDTooSmall, err)
+		_, err = parseXAddID([]byte("0-0"), streamID{}, 0)
+		assert.Equal(t, errStreamIDZero, err)
+	})
+}
+
+func Test_stream_range_trim(t *testing.T) {
+	stream := newStreamEntity("")
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	ids := make([]streamID, 0, 1000)
+	var last streamID
+	for i := 0; i < 1000; i++ {
+		id := streamID{ms: last.ms + uint64(rander.Intn(2)), seq: last.seq + 1}
+		if id.ms != last.ms {
+			id.seq = 0
+		}
+		stream.Add(id, [][]byte{[]byte("i"), []byte(cast.ToString(i))})
+		ids = append(ids, id)
+		last = id
+	}
+
+	t.Run("range", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			left := rander.Intn(1000)
+			right := left + rander.Intn(1000-left)
+			entries := stream.Range(ids[left], ids[right], -1, false)
+			assert.Equal(t, right-left+1, len(entries))
+			for j, entry := range entries {
+				assert.Equal(t, ids[left+j], entry.id)
+			}
+
+			entries = stream.Range(ids[left], ids[right], 3, true)
+			for j, entry := range entries {
+				assert.Equal(t, ids[right-j], entry.id)
+			}
+		}
+	})
+
+	t.Run("del", func(t *testing.T) {
+		assert.Equal(t, int64(1), stream.Del(ids[500]))
+		assert.Equal(t, int64(0), stream.Del(ids[500]))
+		assert.Equal(t, int64(999), stream.Len())
+		assert.Equal(t, 0, len(stream.Range(ids[500], ids[500], -1, false)))
+		ids = append(ids[:500], ids[501:]...)
+	})
+
+	t.Run("trim", func(t *testing.T) {
+		assert.Equal(t, int64(10), stream.TrimMaxLen(989, 0))
+		assert.Equal(t, int64(5), stream.TrimMinID(ids[100], 5))
+		assert.Equal(t, int64(85), stream.TrimMinID(ids[100], 0))
+		assert.Equal(t, int64(0), stream.TrimMinID(ids[100], 0))
+		entries := stream.Range(streamID{}, maxStreamID, 1, false)
+		assert.Equal(t, ids[100], entries[0].id)
+		assert.Equal(t, int64(899), stream.Len())
+	})
+}
+
+func Test_stream_to_cmd(t *testing.T) {
+	stream := newStreamEntity("s")
+	for i := 1; i <= 10; i++ {
+		stream.Add(streamID{ms: uint64(i), seq: 1}, [][]byte{[]byte("f"), []byte(cast.ToString(i))})
+	}
+	stream.Del(streamID{ms: 10, seq: 1})
+
+	t.Run("entries", func(t *testing.T) {
+		cmds := append([][][]byte{stream.ToCmd()}, stream.ExtraCmds()...)
+		assert.Equal(t, 10, len(cmds))
+		for i, cmd := range cmds[:9] {
+			assert.Equal(t, database.CmdTypeXAdd, database.CmdType(cmd[0]))
+			assert.Equal(t, "s", string(cmd[1]))
+			assert.Equal(t, streamID{ms: uint64(i + 1), seq: 1}.String(), string(cmd[2]))
+			assert.Equal(t, cast.ToString(i+1), string(cmd[4]))
+		}
+		// 被删除的末尾 entry 需要通过 xsetid 还原 last id
+		assert.Equal(t, [][]byte{[]byte(database.CmdTypeXSetID), []byte("s"), []byte("10-1")}, cmds[9])
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		stream.TrimMaxLen(0, 0)
+		cmd := stream.ToCmd()
+		assert.Equal(t, database.CmdTypeXAdd, database.CmdType(cmd[0]))
+		assert.Equal(t, "10-1", string(cmd[4]))
+		assert.Nil(t, stream.ExtraCmds())
+	})
+}
+
+func Test_stream_group(t *testing.T) {
+	group := newStreamGroup("g", streamID{})
+	now := lib.TimeNow()
+	c1, created := group.consumer("c1", now)
+	assert.True(t, created)
+	c2, _ := group.consumer("c2", now)
+
+	rander := rand.New(rand.NewSource(now.UnixNano()))
+	ids := rander.Perm(100)
+	for _, id := range ids {
+		c := c1
+		if id&1 == 1 {
+			c = c2
+		}
+		group.deliver(streamID{ms: uint64(id)}, c, now)
+	}
+
+	t.Run("deliver", func(t *testing.T) {
+		assert.Equal(t, 100, len(group.pel))
+		for i, pe := range group.pel {
+			assert.Equal(t, streamID{ms: uint64(i)}, pe.id)
+		}
+		assert.Equal(t, int64(50), c1.pending)
+
+		// 重复投递时转移归属并累加投递次数
+		pe := group.deliver(streamID{ms: 0}, c2, now)
+		assert.Equal(t, int64(2), pe.deliveryCount)
+		assert.Equal(t, "c2", pe.consumer)
+		assert.Equal(t, int64(49), c1.pending)
+		assert.Equal(t, int64(51), c2.pending)
+	})
+
+	t.Run("range", func(t *testing.T) {
+		pes := group.pendingRange(streamID{ms: 10}, streamID{ms: 19}, -1, "c1", 0, now)
+		assert.Equal(t, 5, len(pes))
+		for _, pe := range pes {
+			assert.Equal(t, uint64(0), pe.id.ms&1)
+		}
+		assert.Equal(t, 3, len(group.pendingRange(streamID{}, maxStreamID, 3, "", 0, now)))
+		assert.Equal(t, 0, len(group.pendingRange(streamID{}, maxStreamID, -1, "", time.Hour, now)))
+	})
+
+	t.Run("ack", func(t *testing.T) {
+		assert.Equal(t, int64(1), group.ack(streamID{ms: 2}))
+		assert.Equal(t, int64(0), group.ack(streamID{ms: 2}))
+		assert.Nil(t, group.pending(streamID{ms: 2}))
+		assert.Equal(t, int64(48), c1.pending)
+		assert.Equal(t, int64(48), group.delConsumer("c1"))
+		assert.Equal(t, 51, len(group.pel))
+	})
+
+	t.Run("to cmds", func(t *testing.T) {
+		cmds := group.toCmds("s")
+		assert.Equal(t, 1+1+51, len(cmds))
+		assert.Equal(t, "create", string(cmds[0][1]))
+		assert.Equal(t, "c2", string(cmds[1][4]))
+		for i, cmd := range cmds[2:] {
+			assert.Equal(t, database.CmdTypeXClaim, database.CmdType(cmd[0]))
+			assert.Equal(t, group.pel[i].id.String(), string(cmd[5]))
+			assert.Equal(t, cast.ToString(group.pel[i].deliveryCount), string(cmd[9]))
+		}
+	})
+}
@@ -1,10 +1,25 @@
 package datastore
 
 import (
+	"errors"
+	"math"
+	"strconv"
+
 	"github.com/AlphaMinZ/myredis_go/database"
 	"github.com/AlphaMinZ/myredis_go/handler"
 )
 
+// 字符串长度上限 512MB，与 redis 保持一致
+const maxStringLen = 512 << 20
+
+var (
+	errNotInteger    = errors.New("ERR value is not an integer or out of range")
+	errNotFloat      = errors.New("ERR value is not a valid float")
+	errIncrOverflow  = errors.New("ERR increment or decrement would overflow")
+	errIncrNaNOrInf  = errors.New("ERR increment would produce NaN or Infinity")
+	errStringTooLong = errors.New("ERR string exceeds maximum allowed size (512MB)")
+)
+
 func (k *KVStore) getAsString(key string) (String, error) {
 	v, ok := k.data[key]
 	if !ok {
@@ -19,32 +34,208 @@ func (k *KVStore) getAsString(key string) (String, error) {
 	return str, nil
 }
 
-func (k *KVStore) put(key, value string, insertStrategy bool) int64 {
-	if _, ok := k.data[key]; ok && insertStrategy {
-		return 0
-	}
-
-	k.data[key] = NewString(key, value)
-	return 1
+func (k *KVStore) put(key, value string) {
+	k.putData(key, NewString(key, value))
 }
 
 type String interface {
 	Bytes() []byte
+	Len() int64
+	Incr(delta int64) (int64, error)
+	IncrFloat(delta float64) (float64, error)
+	Append(value []byte) int64
+	GetRange(start, end int64) []byte
+	SetRange(offset int64, value []byte) int64
+	GetBits(offset int64, bits int) uint64
+	SetBits(offset int64, bits int, value uint64)
 	database.CmdAdapter
 }
 
+// 能够无损表示为 int64 的值采用整数编码，避免 incr 时反复解析；其余采用字节数组编码
 type stringEntity struct {
-	key, str string
+	key   string
+	isInt bool
+	num   int64
+	raw   []byte
 }
 
 func NewString(key, str string) String {
-	return &stringEntity{key: key, str: str}
+	s := stringEntity{key: key}
+	if num, ok := parseStrictInt([]byte(str)); ok {
+		s.isInt, s.num = true, num
+		return &s
+	}
+	s.raw = []byte(str)
+	return &s
 }
 
+// 返回的是数据副本，reply 的序列化与 executor 不在同一个 goroutine 中
 func (s *stringEntity) Bytes() []byte {
-	return []byte(s.str)
+	if s.isInt {
+		return strconv.AppendInt(nil, s.num, 10)
+	}
+	return append(make([]byte, 0, len(s.raw)), s.raw...)
+}
+
+// 与 redis 保持一致，44 字节以内的字符串视为 embstr
+func (s *stringEntity) Encoding() string {
+	switch {
+	case s.isInt:
+		return "int"
+	case len(s.raw) <= 44:
+		return "embstr"
+	default:
+		return "raw"
+	}
+}
+
+func (s *stringEntity) Len() int64 {
+	if s.isInt {
+		return int64(len(strconv.FormatInt(s.num, 10)))
+	}
+	return int64(len(s.raw))
+}
+
+func (s *stringEntity) Incr(delta int64) (int64, error) {
+	num := s.num
+	if !s.isInt {
+		var ok bool
+		if num, ok = parseStrictInt(s.raw); !ok {
+			return 0, errNotInteger
+		}
+	}
+
+	if (delta > 0 && num > math.MaxInt64-delta) || (delta < 0 && num < math.MinInt64-delta) {
+		return 0, errIncrOverflow
+	}
+
+	s.isInt, s.num, s.raw = true, num+delta, nil
+	return s.num, nil
+}
+
+func (s *stringEntity) IncrFloat(delta float64) (float64, error) {
+	num, err := strconv.ParseFloat(string(s.Bytes()), 64)
+	if err != nil || math.IsNaN(num) || math.IsInf(num, 0) {
+		return 0, errNotFloat
+	}
+
+	num += delta
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return 0, errIncrNaNOrInf
+	}
+
+	formatted := []byte(formatFloat(num))
+	if n, ok := parseStrictInt(formatted); ok {
+		s.isInt, s.num, s.raw = true, n, nil
+		return num, nil
+	}
+	s.isInt, s.raw = false, formatted
+	return num, nil
+}
+
+func (s *stringEntity) Append(value []byte) int64 {
+	s.toRaw()
+	s.raw = append(s.raw, value...)
+	return int64(len(s.raw))
+}
+
+// [start,end]，支持负数下标
+func (s *stringEntity) GetRange(start, end int64) []byte {
+	b := s.Bytes()
+	length := int64(len(b))
+	if start < 0 {
+		start += length
+	}
+	if end < 0 {
+		end += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= length {
+		end = length - 1
+	}
+	if start > end || length == 0 {
+		return []byte{}
+	}
+	return b[start : end+1]
+}
+
+// 自 offset 处覆写 value，长度不足时使用 0 字节填充
+func (s *stringEntity) SetRange(offset int64, value []byte) int64 {
+	s.toRaw()
+	if end := offset + int64(len(value)); end > int64(len(s.raw)) {
+		s.raw = append(s.raw, make([]byte, end-int64(len(s.raw)))...)
+	}
+	copy(s.raw[offset:], value)
+	return int64(len(s.raw))
+}
+
+// 读取自 offset 位起的 bits 个 bit，高位在前. 超出长度的部分视为 0
+func (s *stringEntity) GetBits(offset int64, bits int) uint64 {
+	b := s.raw
+	if s.isInt {
+		b = s.Bytes()
+	}
+
+	var v uint64
+	for i := int64(0); i < int64(bits); i++ {
+		v <<= 1
+		pos := offset + i
+		if idx := pos >> 3; idx < int64(len(b)) {
+			v |= uint64(b[idx]>>(7-pos&7)) & 1
+		}
+	}
+	return v
+}
+
+// 将 value 的低 bits 位写入自 offset 位起的位置，长度不足时使用 0 字节填充
+func (s *stringEntity) SetBits(offset int64, bits int, value uint64) {
+	s.toRaw()
+	if end := (offset + int64(bits) + 7) >> 3; end > int64(len(s.raw)) {
+		s.raw = append(s.raw, make([]byte, end-int64(len(s.raw)))...)
+	}
+
+	for i := int64(0); i < int64(bits); i++ {
+		pos := offset + i
+		mask := byte(1) << (7 - pos&7)
+		if value>>(int64(bits)-1-i)&1 == 1 {
+			s.raw[pos>>3] |= mask
+		} else {
+			s.raw[pos>>3] &^= mask
+		}
+	}
 }
 
 func (s *stringEntity) ToCmd() [][]byte {
-	return [][]byte{[]byte(database.CmdTypeSet), []byte(s.key), []byte(s.str)}
+	return [][]byte{[]byte(database.CmdTypeSet), []byte(s.key), s.Bytes()}
+}
+
+func (s *stringEntity) setKey(key string) {
+	s.key = key
+}
+
+// 由整数编码转为字节数组编码
+func (s *stringEntity) toRaw() {
+	if !s.isInt {
+		return
+	}
+	s.raw = strconv.AppendInt(nil, s.num, 10)
+	s.isInt, s.num = false, 0
+}
+
+// 只有与 int64 格式化结果完全一致的字符串才视为整数，例如 "007"、"+1" 均不满足
+func parseStrictInt(b []byte) (int64, bool) {
+	if len(b) == 0 || len(b) > 20 {
+		return 0, false
+	}
+	num, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || strconv.FormatInt(num, 10) != string(b) {
+		return 0, false
+	}
+	return num, true
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
 }
@@ -0,0 +1,145 @@
+package datastore
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AlphaMinZ/myredis_go/handler"
+	"github.com/AlphaMinZ/myredis_go/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_string_int_encoding(t *testing.T) {
+	// 只有能够无损表示为 int64 的值采用整数编码
+	for str, encoding := range map[string]string{
+		"123":                  "int",
+		"-9223372036854775808": "int",
+		"9223372036854775808":  "embstr",
+		"0123":                 "embstr",
+		"-0":                   "embstr",
+		" 1":                   "embstr",
+		"1.5":                  "embstr",
+	} {
+		s := NewString("s", str)
+		assert.Equal(t, encoding, s.(encoder).Encoding(), str)
+		assert.Equal(t, str, string(s.Bytes()))
+		assert.Equal(t, int64(len(str)), s.Len())
+	}
+
+	s := NewString("s", "12")
+	assert.Equal(t, int64(3), s.Append([]byte("3")))
+	assert.Equal(t, "embstr", s.(encoder).Encoding())
+	n, err := s.Incr(1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(124), n)
+	assert.Equal(t, "int", s.(encoder).Encoding())
+
+	_, err = NewString("s", strconv.FormatInt(math.MaxInt64, 10)).Incr(1)
+	assert.Equal(t, errIncrOverflow, err)
+	_, err = NewString("s", "0123").Incr(1)
+	assert.Equal(t, errNotInteger, err)
+
+	// 浮点运算的结果为整数时恢复整数编码
+	s = NewString("s", "1.5")
+	_, err = s.IncrFloat(1.5)
+	assert.Nil(t, err)
+	assert.Equal(t, "int", s.(encoder).Encoding())
+	assert.Equal(t, "3", string(s.Bytes()))
+	_, err = s.IncrFloat(0.25)
+	assert.Nil(t, err)
+	assert.Equal(t, "3.25", string(s.Bytes()))
+}
+
+func Test_string_incr_replay(t *testing.T) {
+	db := newTestDB(t)
+	assert.Equal(t, "+OK\r\n", db.do("set", "f", "10", "EX", "100"))
+	assert.Equal(t, "$4\r\n10.5\r\n", db.do("incrbyfloat", "f", "0.5"))
+	assert.Equal(t, "$2\r\n11\r\n", db.do("incrbyfloat", "f", "0.5"))
+	assert.Equal(t, "$3\r\nint\r\n", db.do("object", "encoding", "f"))
+
+	// incrbyfloat 以保留过期时间的 set 持久化运算结果
+	assert.Equal(t, [][]byte{[]byte("set"), []byte("f"), []byte("11"), []byte("keepttl")}, db.persister.cmds[len(db.persister.cmds)-1])
+
+	assert.Equal(t, "+OK\r\n", db.do("set", "i", "10"))
+	assert.Equal(t, ":11\r\n", db.do("incr", "i"))
+	assert.Equal(t, ":1\r\n", db.do("decrby", "i", "10"))
+	assert.Equal(t, "-ERR increment or decrement would overflow\r\n", db.do("incrby", "i", strconv.FormatInt(math.MaxInt64, 10)))
+	assert.Equal(t, "$3\r\nint\r\n", db.do("object", "encoding", "i"))
+
+	replayed := db.replay(t)
+	assert.Equal(t, "$2\r\n11\r\n", replayed.do("get", "f"))
+	assert.Equal(t, ":100\r\n", replayed.do("ttl", "f"))
+	assert.Equal(t, "$1\r\n1\r\n", replayed.do("get", "i"))
+	assert.Equal(t, "$3\r\nint\r\n", replayed.do("object", "encoding", "i"))
+}
+
+func Test_string_set_options(t *testing.T) {
+	db := newTestDB(t)
+	syntaxErr := string(handler.NewSyntaxErrReply().ToBytes())
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"NX", "XX"},
+			{"EX", "10", "PX", "100"},
+			{"EX", "10", "KEEPTTL"},
+			{"KEEPTTL", "PXAT", "100"},
+			{"EX"},
+			{"FOO"},
+		} {
+			assert.Equal(t, syntaxErr, db.do(append([]string{"set", "k", "v"}, args...)...), args)
+		}
+		assert.Equal(t, "-ERR invalid expire time\r\n", db.do("set", "k", "v", "EX", "0"))
+		assert.Equal(t, "-ERR value is not an integer or out of range\r\n", db.do("set", "k", "v", "PX", "x"))
+		assert.Equal(t, ":0\r\n", db.do("exists", "k"))
+	})
+
+	t.Run("nx xx get", func(t *testing.T) {
+		assert.Equal(t, "$-1\r\n", db.do("set", "k", "v1", "XX"))
+		assert.Equal(t, "+OK\r\n", db.do("set", "k", "v1", "NX"))
+		assert.Equal(t, "$-1\r\n", db.do("set", "k", "v2", "NX"))
+		assert.Equal(t, "$2\r\nv1\r\n", db.do("set", "k", "v2", "NX", "GET"))
+		assert.Equal(t, "$2\r\nv1\r\n", db.do("set", "k", "v2", "XX", "GET"))
+		assert.Equal(t, "$-1\r\n", db.do("set", "none", "v", "GET"))
+		assert.Equal(t, ":1\r\n", db.do("rpush", "list", "x"))
+		assert.Equal(t, string(handler.NewWrongTypeErrReply().ToBytes()), db.do("set", "list", "v", "GET"))
+		assert.Equal(t, "+list\r\n", db.do("type", "list"))
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		unix := lib.TimeNow().Add(time.Hour).Unix()
+		assert.Equal(t, "+OK\r\n", db.do("set", "k", "v", "EX", "100"))
+		assert.Equal(t, ":100\r\n", db.do("ttl", "k"))
+		assert.Equal(t, "+OK\r\n", db.do("set", "k", "v", "PX", "200000"))
+		assert.Equal(t, ":200\r\n", db.do("ttl", "k"))
+		assert.Equal(t, "+OK\r\n", db.do("set", "k", "v", "EXAT", strconv.FormatInt(unix, 10)))
+		assert.Equal(t, ":"+strconv.FormatInt(unix, 10)+"\r\n", db.do("expiretime", "k"))
+		assert.Equal(t, "+OK\r\n", db.do("set", "k", "v", "PXAT", strconv.FormatInt(unix*1000+1, 10)))
+		assert.Equal(t, ":"+strconv.FormatInt(unix*1000+1, 10)+"\r\n", db.do("pexpiretime", "k"))
+
+		// keepttl 保留原有的过期时间，覆盖写入时清除过期时间
+		assert.Equal(t, "+OK\r\n", db.do("set", "k", "v2", "KEEPTTL"))
+		assert.Equal(t, ":"+strconv.FormatInt(unix*1000+1, 10)+"\r\n", db.do("pexpiretime", "k"))
+		assert.Equal(t, "+OK\r\n", db.do("set", "k", "v3"))
+		assert.Equal(t, ":-1\r\n", db.do("ttl", "k"))
+
+		// 过期时间已经过去时，等价于写入后立即过期
+		assert.Equal(t, "+OK\r\n", db.do("set", "gone", "v"))
+		assert.Equal(t, "+OK\r\n", db.do("set", "gone", "v", "PXAT", "1"))
+		assert.Equal(t, ":0\r\n", db.do("exists", "gone"))
+
+		assert.Equal(t, "+OK\r\n", db.do("set", "kept", "v", "EX", "100"))
+		assert.Equal(t, "+OK\r\n", db.do("set", "kept", "v2", "KEEPTTL", "XX"))
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		replayed := db.replay(t)
+		for _, key := range []string{"k", "none", "list", "gone", "kept"} {
+			assert.Equal(t, db.do("type", key), replayed.do("type", key), key)
+			assert.Equal(t, db.do("pexpiretime", key), replayed.do("pexpiretime", key), key)
+		}
+		assert.Equal(t, "$2\r\nv3\r\n", replayed.do("get", "k"))
+		assert.Equal(t, "$2\r\nv2\r\n", replayed.do("get", "kept"))
+	})
+}
@@ -0,0 +1,246 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/AlphaMinZ/myredis_go/database"
+	"github.com/AlphaMinZ/myredis_go/handler"
+)
+
+// 与 redisbloom 保持一致的默认参数
+const (
+	topKDefaultWidth = 8
+	topKDefaultDepth = 7
+	topKDefaultDecay = 0.9
+	topKMaxIncrement = 100000
+	topKFpSeed       = 0x9747b28c
+	topKRandSeed     = 0x2545f4914f6cdd1d
+)
+
+var (
+	errTopKNotFound = errors.New("TopK: key does not exist")
+	errTopKExists   = errors.New("TopK: key already exists")
+	errTopKBadData  = errors.New("TopK: received bad data")
+)
+
+func (k *KVStore) getAsTopK(key string) (TopK, error) {
+	v, ok := k.data[key]
+	if !ok {
+		return nil, nil
+	}
+
+	topK, ok := v.(TopK)
+	if !ok {
+		return nil, handler.NewWrongTypeErrReply()
+	}
+
+	return topK, nil
+}
+
+func (k *KVStore) putAsTopK(key string, topK TopK) {
+	k.putData(key, topK)
+}
+
+type TopK interface {
+	IncrBy(item []byte, incr int64) (expelled []byte)
+	Query(item []byte) bool
+	List() ([][]byte, []int64)
+	Load(data []byte) error
+	database.MultiCmdAdapter
+}
+
+type topKBucket struct {
+	fp    uint32
+	count int64
+}
+
+type topKEntry struct {
+	item  string
+	count int64
+}
+
+// 基于 HeavyKeeper 算法. 指纹冲突时计数器以 decay^count 的概率衰减，
+// 衰减使用的伪随机数状态随数据一同持久化，保证指令重放的结果一致
+type topK struct {
+	key     string
+	k       int64
+	width   int64
+	depth   int64
+	decay   float64
+	rand    uint64
+	buckets []topKBucket
+	heap    []*topKEntry // 按照 count 降序排列，count 相同时按照 item 升序
+}
+
+func newTopK(key string, k, width, depth int64, decay float64) TopK {
+	return &topK{
+		key:     key,
+		k:       k,
+		width:   width,
+		depth:   depth,
+		decay:   decay,
+		rand:    topKRandSeed,
+		buckets: make([]topKBucket, width*depth),
+	}
+}
+
+// xorshift64*，返回 [0,1) 之间的随机数
+func (t *topK) random() float64 {
+	t.rand ^= t.rand >> 12
+	t.rand ^= t.rand << 25
+	t.rand ^= t.rand >> 27
+	return float64((t.rand*0x2545f4914f6cdd1d)>>11) / (1 << 53)
+}
+
+// 返回被挤出 top k 的元素
+func (t *topK) IncrBy(item []byte, incr int64) []byte {
+	fp := uint32(murmurHash64A(item, topKFpSeed))
+	var maxCount int64
+	for row := int64(0); row < t.depth; row++ {
+		b := &t.buckets[row*t.width+int64(murmurHash64A(item, uint64(row))%uint64(t.width))]
+		switch {
+		case b.count == 0:
+			b.fp, b.count = fp, incr
+		case b.fp == fp:
+			b.count += incr
+		default:
+			for remain := incr; remain > 0; remain-- {
+				if t.random() >= math.Pow(t.decay, float64(b.count)) {
+					continue
+				}
+				if b.count--; b.count == 0 {
+					b.fp, b.count = fp, remain
+					break
+				}
+			}
+		}
+		if b.fp == fp {
+			maxCount = max(maxCount, b.count)
+		}
+	}
+
+	key := string(item)
+	for _, e := range t.heap {
+		if e.item == key {
+			e.count = maxCount
+			t.sortHeap()
+			return nil
+		}
+	}
+
+	if int64(len(t.heap)) < t.k {
+		if maxCount > 0 {
+			t.heap = append(t.heap, &topKEntry{item: key, count: maxCount})
+			t.sortHeap()
+		}
+		return nil
+	}
+
+	last := t.heap[len(t.heap)-1]
+	if maxCount <= last.count {
+		return nil
+	}
+	t.heap[len(t.heap)-1] = &topKEntry{item: key, count: maxCount}
+	t.sortHeap()
+	return []byte(last.item)
+}
+
+func (t *topK) sortHeap() {
+	sort.Slice(t.heap, func(i, j int) bool {
+		if t.heap[i].count != t.heap[j].count {
+			return t.heap[i].count > t.heap[j].count
+		}
+		return t.heap[i].item < t.heap[j].item
+	})
+}
+
+func (t *topK) Query(item []byte) bool {
+	key := string(item)
+	for _, e := range t.heap {
+		if e.item == key {
+			return true
+		}
+	}
+	return false
+}
+
+// 按照 count 降序返回 top k 元素
+func (t *topK) List() ([][]byte, []int64) {
+	items := make([][]byte, 0, len(t.heap))
+	counts := make([]int64, 0, len(t.heap))
+	for _, e := range t.heap {
+		items = append(items, []byte(e.item))
+		counts = append(counts, e.count)
+	}
+	return items, counts
+}
+
+// 【rand】+ 每个桶的【fp、count】+【top k 个数】+ 每个元素的【count、item 长度、item】，均为小端序
+func (t *topK) dump() []byte {
+	data := make([]byte, 0, 8+12*len(t.buckets)+4)
+	data = binary.LittleEndian.AppendUint64(data, t.rand)
+	for _, b := range t.buckets {
+		data = binary.LittleEndian.AppendUint32(data, b.fp)
+		data = binary.LittleEndian.AppendUint64(data, uint64(b.count))
+	}
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(t.heap)))
+	for _, e := range t.heap {
+		data = binary.LittleEndian.AppendUint64(data, uint64(e.count))
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(e.item)))
+		data = append(data, e.item...)
+	}
+	return data
+}
+
+func (t *topK) Load(data []byte) error {
+	r := chunkReader(data)
+	rand := r.uint64()
+	buckets := make([]topKBucket, len(t.buckets))
+	for i := range buckets {
+		buckets[i].fp = r.uint32()
+		buckets[i].count = int64(r.uint64())
+	}
+
+	n := r.uint32()
+	if r.broken() || int64(n) > t.k {
+		return errTopKBadData
+	}
+	heap := make([]*topKEntry, 0, n)
+	for i := uint32(0); i < n; i++ {
+		count, size := int64(r.uint64()), r.uint32()
+		if r.broken() || int64(size) > int64(len(r)) {
+			return errTopKBadData
+		}
+		heap = append(heap, &topKEntry{item: string(r[:size]), count: count})
+		r = r[size:]
+	}
+	if len(r) != 0 {
+		return errTopKBadData
+	}
+
+	t.rand, t.buckets, t.heap = rand, buckets, heap
+	t.sortHeap()
+	return nil
+}
+
+func (t *topK) Encoding() string {
+	return "raw"
+}
+
+func (t *topK) setKey(key string) {
+	t.key = key
+}
+
+// 以 topk.reserve 创建，再通过 topk.loadchunk 导入桶、top k 元素以及随机数状态
+func (t *topK) ToCmd() [][]byte {
+	return [][]byte{[]byte(database.CmdTypeTopKReserve), []byte(t.key), []byte(strconv.FormatInt(t.k, 10)),
+		[]byte(strconv.FormatInt(t.width, 10)), []byte(strconv.FormatInt(t.depth, 10)), []byte(formatFloat(t.decay))}
+}
+
+func (t *topK) ExtraCmds() [][][]byte {
+	return [][][]byte{{[]byte(database.CmdTypeTopKLoadChunk), []byte(t.key), t.dump()}}
+}
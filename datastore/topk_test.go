@@ -0,0 +1,58 @@
+package datastore
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/AlphaMinZ/myredis_go/lib"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_topk(t *testing.T) {
+	rander := rand.New(rand.NewSource(lib.TimeNow().UnixNano()))
+	prefix := cast.ToString(rander.Int63())
+	topk := newTopK("topk", 5, 100, 5, 0.9)
+
+	t.Run("heavy hitters", func(t *testing.T) {
+		// 5 个高频元素混杂在大量低频元素中
+		for i := 0; i < 20000; i++ {
+			if rander.Intn(2) == 0 {
+				topk.IncrBy([]byte(prefix+"heavy"+cast.ToString(rander.Intn(5))), 1)
+				continue
+			}
+			topk.IncrBy([]byte(prefix+cast.ToString(rander.Intn(5000))), 1)
+		}
+
+		items, counts := topk.List()
+		assert.Len(t, items, 5)
+		for i := 0; i < 5; i++ {
+			assert.True(t, topk.Query([]byte(prefix+"heavy"+cast.ToString(i))))
+			if i > 0 {
+				assert.GreaterOrEqual(t, counts[i-1], counts[i])
+			}
+		}
+	})
+
+	t.Run("expel", func(t *testing.T) {
+		topk := newTopK("topk", 1, 8, 7, 0.9)
+		assert.Nil(t, topk.IncrBy([]byte("a"), 1))
+		assert.Equal(t, []byte("a"), topk.IncrBy([]byte("b"), 2))
+		assert.False(t, topk.Query([]byte("a")))
+	})
+
+	t.Run("load", func(t *testing.T) {
+		loaded := newTopK("topk", 5, 100, 5, 0.9)
+		assert.Nil(t, loaded.Load(topk.ExtraCmds()[0][2]))
+		assert.Equal(t, topk.ExtraCmds(), loaded.ExtraCmds())
+
+		// 随机数状态一并还原，后续写入的结果一致
+		for i := 0; i < 1000; i++ {
+			item := []byte(prefix + cast.ToString(rander.Intn(5000)))
+			assert.Equal(t, topk.IncrBy(item, 1), loaded.IncrBy(item, 1))
+		}
+		assert.Equal(t, topk.ExtraCmds(), loaded.ExtraCmds())
+
+		assert.Equal(t, errTopKBadData, loaded.Load([]byte("x")))
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"github.com/AlphaMinZ/myredis_go/lib/pool"
 	"github.com/AlphaMinZ/myredis_go/log"
 	"github.com/AlphaMinZ/myredis_go/server"
 )
@@ -62,8 +63,12 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 }
 
 func (h *Handler) handle(ctx context.Context, conn io.ReadWriter) {
+	// 连接断开时取消 connCtx，使得阻塞中的指令能够及时退出
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// 持续处理
-	stream := h.parser.ParseStream(conn)
+	stream := h.watch(ctx, cancel, h.parser.ParseStream(conn))
 	for {
 		select {
 		case <-ctx.Done():
@@ -71,7 +76,7 @@ func (h *Handler) handle(ctx context.Context, conn io.ReadWriter) {
 			return
 
 		case droplet := <-stream:
-			if err := h.handleDroplet(ctx, conn, droplet); err != nil {
+			if err := h.handleDroplet(connCtx, conn, droplet); err != nil {
 				h.logger.Errorf("[handler]conn terminated, err: %s", droplet.Err.Error())
 				return
 			}
@@ -79,6 +84,36 @@ func (h *Handler) handle(ctx context.Context, conn io.ReadWriter) {
 	}
 }
 
+// 转发解析结果. 连接断开时先执行 cancel，因此指令阻塞期间同样能够感知到
+func (h *Handler) watch(ctx context.Context, cancel context.CancelFunc, stream <-chan *Droplet) <-chan *Droplet {
+	ch := make(chan *Droplet)
+	pool.Submit(func() {
+		for {
+			var droplet *Droplet
+			select {
+			case <-ctx.Done():
+				return
+			case droplet = <-stream:
+			}
+
+			if droplet.Terminated() {
+				cancel()
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- droplet:
+			}
+
+			if droplet.Terminated() {
+				return
+			}
+		}
+	})
+	return ch
+}
+
 func (h *Handler) handleDroplet(ctx context.Context, conn io.ReadWriter, droplet *Droplet) error {
 	if droplet.Terminated() {
 		return droplet.Err
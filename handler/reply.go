@@ -167,6 +167,26 @@ func (m *MultiBulkReply) ToBytes() []byte {
 	return []byte(strBuf.String())
 }
 
+// 嵌套数组类型. 协议为 【*】【arr.length】【CRLF】+ 各元素自身的协议内容
+type MultiRawReply struct {
+	Replies []Reply
+}
+
+func NewMultiRawReply(replies []Reply) *MultiRawReply {
+	return &MultiRawReply{
+		Replies: replies,
+	}
+}
+
+func (m *MultiRawReply) ToBytes() []byte {
+	var strBuf strings.Builder
+	strBuf.WriteString("*" + strconv.Itoa(len(m.Replies)) + CRLF)
+	for _, reply := range m.Replies {
+		strBuf.Write(reply.ToBytes())
+	}
+	return []byte(strBuf.String())
+}
+
 var emptyMultiBulkBytes = []byte("*0\r\n")
 
 // 空数组类型. 采用单例，协议固定为【*】【0】【CRLF】
@@ -179,3 +199,18 @@ func NewEmptyMultiBulkReply() *EmptyMultiBulkReply {
 func (r *EmptyMultiBulkReply) ToBytes() []byte {
 	return emptyMultiBulkBytes
 }
+
+var nullMultiBulkBytes = []byte("*-1\r\n")
+
+// 空数组类型，用于阻塞指令超时等场景. 采用单例，协议固定为【*】【-1】【CRLF】
+type NullMultiBulkReply struct{}
+
+var theNullMultiBulkReply = &NullMultiBulkReply{}
+
+func NewNullMultiBulkReply() *NullMultiBulkReply {
+	return theNullMultiBulkReply
+}
+
+func (r *NullMultiBulkReply) ToBytes() []byte {
+	return nullMultiBulkBytes
+}
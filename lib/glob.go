@@ -0,0 +1,96 @@
+package lib
+
+// GlobMatch 判断 str 能否匹配 redis 风格的 glob 表达式.
+// 支持 * ? [abc] [^abc] [a-z] 以及 \ 转义
+func GlobMatch(pattern, str string) bool {
+	var (
+		p, s         int
+		starP, starS = -1, 0
+	)
+
+	for s < len(str) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				// 记录 * 的位置，匹配失败时回溯
+				starP, starS = p, s
+				p++
+				continue
+			case '?':
+				p++
+				s++
+				continue
+			case '[':
+				if next, ok := matchClass(pattern, p, str[s]); ok {
+					p = next
+					s++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == str[s] {
+					p += 2
+					s++
+					continue
+				}
+				if p+1 == len(pattern) && str[s] == '\\' {
+					p++
+					s++
+					continue
+				}
+			default:
+				if pattern[p] == str[s] {
+					p++
+					s++
+					continue
+				}
+			}
+		}
+
+		// 回溯到上一个 *，令其多吞掉一个字符
+		if starP < 0 {
+			return false
+		}
+		starS++
+		s = starS
+		p = starP + 1
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// 匹配 [...] 字符集合，返回集合结束后的下标以及是否匹配
+func matchClass(pattern string, p int, c byte) (int, bool) {
+	p++
+	not := p < len(pattern) && pattern[p] == '^'
+	if not {
+		p++
+	}
+
+	var matched bool
+	for p < len(pattern) && pattern[p] != ']' {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			matched = matched || pattern[p+1] == c
+			p += 2
+		case p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']':
+			lo, hi := pattern[p], pattern[p+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			matched = matched || (c >= lo && c <= hi)
+			p += 3
+		default:
+			matched = matched || pattern[p] == c
+			p++
+		}
+	}
+
+	// 缺失 ] 时视作集合延伸到表达式末尾
+	if p < len(pattern) {
+		p++
+	}
+	return p, matched != not
+}
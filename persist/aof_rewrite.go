@@ -3,12 +3,12 @@ package persist
 import (
 	"io"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/AlphaMinZ/myredis_go/database"
 	"github.com/AlphaMinZ/myredis_go/datastore"
 	"github.com/AlphaMinZ/myredis_go/handler"
-	"github.com/AlphaMinZ/myredis_go/lib"
 	"github.com/AlphaMinZ/myredis_go/log"
 	"github.com/AlphaMinZ/myredis_go/protocol"
 )
@@ -60,11 +60,19 @@ func (a *aofPersister) doRewrite(tmpFile *os.File, fileSize int64) error {
 	forkedDB.ForEach(func(key string, adapter database.CmdAdapter, expireAt *time.Time) {
 		_, _ = tmpFile.Write(handler.NewMultiBulkReply(adapter.ToCmd()).ToBytes())
 
+		// 如 hash 中 field 的过期时间
+		if multiAdapter, ok := adapter.(database.MultiCmdAdapter); ok {
+			for _, extraCmd := range multiAdapter.ExtraCmds() {
+				_, _ = tmpFile.Write(handler.NewMultiBulkReply(extraCmd).ToBytes())
+			}
+		}
+
 		if expireAt == nil {
 			return
 		}
 
-		expireCmd := [][]byte{[]byte(database.CmdTypeExpireAt), []byte(key), []byte(lib.TimeSecondFormat(*expireAt))}
+		// 过期时间以毫秒时间戳的形式重写，不受时区影响
+		expireCmd := [][]byte{[]byte(database.CmdTypePExpireAt), []byte(key), []byte(strconv.FormatInt(expireAt.UnixMilli(), 10))}
 		_, _ = tmpFile.Write(handler.NewMultiBulkReply(expireCmd).ToBytes())
 	})
 
@@ -80,7 +88,7 @@ func (a *aofPersister) forkDB(fileSize int64) (database.DataStore, error) {
 	logger := log.GetDefaultLogger()
 	reloader := readCloserAdapter(io.LimitReader(file, fileSize), file.Close)
 	fakePerisister := newFakePersister(reloader)
-	tmpKVStore := datastore.NewKVStore(fakePerisister)
+	tmpKVStore := datastore.NewKVStore(fakePerisister, nil)
 	executor := database.NewDBExecutor(tmpKVStore)
 	trigger := database.NewDBTrigger(executor)
 	h, err := handler.NewHandler(trigger, fakePerisister, protocol.NewParser(logger), logger)